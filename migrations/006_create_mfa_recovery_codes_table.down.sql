@@ -0,0 +1,2 @@
+-- Drop mfa_recovery_codes table
+DROP TABLE IF EXISTS mfa_recovery_codes;
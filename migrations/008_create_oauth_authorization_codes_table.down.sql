@@ -0,0 +1,2 @@
+-- Drop oauth_authorization_codes table
+DROP TABLE IF EXISTS oauth_authorization_codes;
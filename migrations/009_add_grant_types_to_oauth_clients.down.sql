@@ -0,0 +1,2 @@
+-- Remove grant types from oauth_clients
+ALTER TABLE oauth_clients DROP COLUMN IF EXISTS grant_types;
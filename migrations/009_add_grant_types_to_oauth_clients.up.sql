@@ -0,0 +1,2 @@
+-- Record which OAuth grants each client may use
+ALTER TABLE oauth_clients ADD COLUMN IF NOT EXISTS grant_types TEXT NOT NULL DEFAULT 'authorization_code';
@@ -0,0 +1,2 @@
+-- Drop linked_identities table
+DROP TABLE IF EXISTS linked_identities;
@@ -0,0 +1,14 @@
+-- Create linked_identities table
+CREATE TABLE IF NOT EXISTS linked_identities (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    provider VARCHAR(64) NOT NULL,
+    subject VARCHAR(255) NOT NULL,
+    email VARCHAR(255),
+    last_login_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Create indexes for performance
+CREATE UNIQUE INDEX IF NOT EXISTS idx_linked_identities_provider_subject ON linked_identities(provider, subject);
+CREATE INDEX IF NOT EXISTS idx_linked_identities_user_id ON linked_identities(user_id);
@@ -0,0 +1,5 @@
+-- Record the device behind each refresh token so users can manage their sessions
+ALTER TABLE refresh_tokens ADD COLUMN IF NOT EXISTS user_agent VARCHAR(512);
+ALTER TABLE refresh_tokens ADD COLUMN IF NOT EXISTS ip_address VARCHAR(64);
+ALTER TABLE refresh_tokens ADD COLUMN IF NOT EXISTS label VARCHAR(128);
+ALTER TABLE refresh_tokens ADD COLUMN IF NOT EXISTS last_used_at TIMESTAMP;
@@ -0,0 +1,6 @@
+-- Rotated tokens are only kept for reuse detection and are not sessions
+DELETE FROM refresh_tokens WHERE rotated_at IS NOT NULL;
+
+DROP INDEX IF EXISTS idx_refresh_tokens_family_id;
+ALTER TABLE refresh_tokens DROP COLUMN IF EXISTS rotated_at;
+ALTER TABLE refresh_tokens DROP COLUMN IF EXISTS family_id;
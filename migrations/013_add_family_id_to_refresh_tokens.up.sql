@@ -0,0 +1,9 @@
+-- Group refresh tokens into rotation families and keep rotated tokens to detect replays
+ALTER TABLE refresh_tokens ADD COLUMN IF NOT EXISTS family_id VARCHAR(64);
+ALTER TABLE refresh_tokens ADD COLUMN IF NOT EXISTS rotated_at TIMESTAMP;
+
+-- Every token issued before families existed starts a family of its own
+UPDATE refresh_tokens SET family_id = 'legacy-' || id WHERE family_id IS NULL;
+ALTER TABLE refresh_tokens ALTER COLUMN family_id SET NOT NULL;
+
+CREATE INDEX IF NOT EXISTS idx_refresh_tokens_family_id ON refresh_tokens(family_id);
@@ -0,0 +1,12 @@
+-- Digests cannot be turned back into tokens, so every outstanding token is invalidated
+DELETE FROM email_verification_tokens;
+ALTER INDEX IF EXISTS idx_email_verification_tokens_token_hash RENAME TO idx_email_verification_tokens_token;
+ALTER TABLE email_verification_tokens RENAME COLUMN token_hash TO token;
+
+DELETE FROM password_reset_tokens;
+ALTER INDEX IF EXISTS idx_password_reset_tokens_token_hash RENAME TO idx_password_reset_tokens_token;
+ALTER TABLE password_reset_tokens RENAME COLUMN token_hash TO token;
+
+DELETE FROM refresh_tokens;
+ALTER INDEX IF EXISTS idx_refresh_tokens_token_hash RENAME TO idx_refresh_tokens_token;
+ALTER TABLE refresh_tokens RENAME COLUMN token_hash TO token;
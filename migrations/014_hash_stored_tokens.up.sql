@@ -0,0 +1,13 @@
+-- Store refresh, password reset and email verification tokens as SHA-256 digests.
+-- Existing rows are converted in place, so outstanding tokens keep working.
+ALTER TABLE refresh_tokens RENAME COLUMN token TO token_hash;
+UPDATE refresh_tokens SET token_hash = encode(sha256(convert_to(token_hash, 'UTF8')), 'hex');
+ALTER INDEX IF EXISTS idx_refresh_tokens_token RENAME TO idx_refresh_tokens_token_hash;
+
+ALTER TABLE password_reset_tokens RENAME COLUMN token TO token_hash;
+UPDATE password_reset_tokens SET token_hash = encode(sha256(convert_to(token_hash, 'UTF8')), 'hex');
+ALTER INDEX IF EXISTS idx_password_reset_tokens_token RENAME TO idx_password_reset_tokens_token_hash;
+
+ALTER TABLE email_verification_tokens RENAME COLUMN token TO token_hash;
+UPDATE email_verification_tokens SET token_hash = encode(sha256(convert_to(token_hash, 'UTF8')), 'hex');
+ALTER INDEX IF EXISTS idx_email_verification_tokens_token RENAME TO idx_email_verification_tokens_token_hash;
@@ -0,0 +1,2 @@
+-- Drop access_tokens table
+DROP TABLE IF EXISTS access_tokens;
@@ -0,0 +1,21 @@
+-- Create access_tokens table for opaque reference access tokens
+CREATE TABLE IF NOT EXISTS access_tokens (
+    id SERIAL PRIMARY KEY,
+    token_hash VARCHAR(64) UNIQUE NOT NULL,
+    subject_type VARCHAR(16) NOT NULL,
+    user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+    client_id VARCHAR(255),
+    scope TEXT,
+    audience TEXT,
+    roles TEXT,
+    permissions TEXT,
+    session_id VARCHAR(64),
+    issued_at TIMESTAMP NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    revoked_at TIMESTAMP
+);
+
+-- Create indexes for performance
+CREATE INDEX IF NOT EXISTS idx_access_tokens_user_id ON access_tokens(user_id);
+CREATE INDEX IF NOT EXISTS idx_access_tokens_session_id ON access_tokens(session_id);
+CREATE INDEX IF NOT EXISTS idx_access_tokens_expires_at ON access_tokens(expires_at);
@@ -0,0 +1,2 @@
+-- Remove the per-user token watermark
+ALTER TABLE users DROP COLUMN IF EXISTS tokens_valid_after;
@@ -0,0 +1,2 @@
+-- Tokens issued before this time are rejected, which revokes every session of a user at once
+ALTER TABLE users ADD COLUMN IF NOT EXISTS tokens_valid_after TIMESTAMP;
@@ -0,0 +1,2 @@
+-- Remove the last accepted TOTP time step
+ALTER TABLE users DROP COLUMN IF EXISTS mfa_last_step;
@@ -0,0 +1,2 @@
+-- Last accepted TOTP time step, so a code cannot be replayed while it is still inside the skew window
+ALTER TABLE users ADD COLUMN IF NOT EXISTS mfa_last_step BIGINT;
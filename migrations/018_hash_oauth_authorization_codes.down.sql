@@ -0,0 +1,4 @@
+-- Digests cannot be turned back into codes, so every outstanding code is invalidated
+DELETE FROM oauth_authorization_codes;
+ALTER INDEX IF EXISTS idx_oauth_authorization_codes_code_hash RENAME TO idx_oauth_authorization_codes_code;
+ALTER TABLE oauth_authorization_codes RENAME COLUMN code_hash TO code;
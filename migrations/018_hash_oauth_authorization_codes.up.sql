@@ -0,0 +1,5 @@
+-- Store authorization codes as SHA-256 digests, like the token tables.
+-- Existing rows are converted in place, so outstanding codes keep working.
+ALTER TABLE oauth_authorization_codes RENAME COLUMN code TO code_hash;
+UPDATE oauth_authorization_codes SET code_hash = encode(sha256(convert_to(code_hash, 'UTF8')), 'hex');
+ALTER INDEX IF EXISTS idx_oauth_authorization_codes_code RENAME TO idx_oauth_authorization_codes_code_hash;
@@ -1,97 +1,524 @@
 package config
 
 import (
+	"errors"
+	"fmt"
 	"os"
-	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 )
 
-var (
-	port         string
-	databaseURL  string
-	redisURL     string
-	jwtSecret    string
-	emailService string
-	smtpHost     string
-	smtpPort     int
-	smtpUsername string
-	smtpPassword string
+const (
+	// DefaultJWTSecret is only good for development; production refuses to start with it
+	DefaultJWTSecret = "your-super-secret-jwt-key-change-in-production"
+
+	// minProductionSecretLength is the shortest JWT_SECRET or CSRF_SECRET accepted in production
+	minProductionSecretLength = 32
+)
+
+// Config is the complete service configuration. Values come from the environment, which
+// includes a .env file, then from the optional CONFIG_FILE, then from the defaults.
+type Config struct {
+	// Mode is GIN_MODE; "release" marks a production deployment
+	Mode        string
+	Port        string
+	DatabaseURL string
+	Redis       RedisConfig
+	// TokenStore is the backend of the blacklist, sessions and rate limits: redis or memory
+	TokenStore string
+	// StoreFailure decides how requests are treated while the token store is unreachable
+	StoreFailure StoreFailureConfig
+	// RateLimits are the rate limit policies by name, see RateLimitPublic and the others
+	RateLimits map[string]RateLimitPolicy
+
+	JWT               JWTConfig
+	AccessTokenFormat string
+	TokenDelivery     string
+	IssuerURL         string
+
+	CSRFSecret string
+	CORS       CORSConfig
+
+	Email EmailConfig
+
+	OAuthProviders []OAuthProviderConfig
+}
+
+// JWTConfig describes how tokens are signed
+type JWTConfig struct {
+	Secret         string
+	SigningAlg     string
+	SigningKeyFile string
+	SigningKeyID   string
+	// SecretNotAfter is when HS256 tokens signed with Secret stop verifying once an asymmetric
+	// JWT_SIGNING_ALG is used. When it is zero they are not accepted at all.
+	SecretNotAfter time.Time
+	RetiringKeys   []RetiringKeyConfig
+}
+
+// RetiringKeyConfig is a previous signing key that keeps verifying tokens until NotAfter
+type RetiringKeyConfig struct {
+	ID       string
+	Path     string
+	NotAfter time.Time
+}
+
+// Failure policies: fail open lets the request through unchecked, fail closed rejects it
+const (
+	FailOpen   = "open"
+	FailClosed = "closed"
 )
 
-func Load() {
+// StoreFailureConfig is the degradation policy for token store outages. Each concern has its
+// own policy, and a circuit breaker stops calling the store after repeated failures.
+type StoreFailureConfig struct {
+	RateLimitPolicy  string
+	RevocationPolicy string
+	BreakerThreshold int
+	BreakerCooldown  time.Duration
+}
+
+// RateLimitFailsOpen reports whether requests skip rate limiting when the store is down.
+// Unless configured otherwise they do, so an outage does not take public endpoints down.
+func (f StoreFailureConfig) RateLimitFailsOpen() bool {
+	return f.RateLimitPolicy != FailClosed
+}
+
+// RevocationFailsOpen reports whether tokens are accepted when their revocation status cannot
+// be checked. Unless configured otherwise they are rejected, so revoked tokens stay revoked.
+func (f StoreFailureConfig) RevocationFailsOpen() bool {
+	return f.RevocationPolicy == FailOpen
+}
+
+// EmailConfig is the outgoing mail server
+type EmailConfig struct {
+	Service      string
+	SMTPHost     string
+	SMTPPort     int
+	SMTPUsername string
+	SMTPPassword string
+}
+
+// OAuthProviderConfig describes an upstream identity provider users can sign in with. Setting
+// Issuer enables OIDC discovery; the explicit endpoint URLs cover plain OAuth2 providers.
+type OAuthProviderConfig struct {
+	Name         string
+	ClientID     string
+	ClientSecret string
+	Issuer       string
+	AuthURL      string
+	TokenURL     string
+	UserInfoURL  string
+	Scopes       []string
+	RedirectURL  string
+}
+
+// CORSConfig is the cross-origin policy for browser clients. AllowedOrigins is shared with the
+// CSRF origin checks.
+type CORSConfig struct {
+	AllowedOrigins   []string
+	AllowedMethods   []string
+	AllowedHeaders   []string
+	ExposedHeaders   []string
+	AllowCredentials bool
+	MaxAge           time.Duration
+}
+
+// current is the configuration installed by the last successful Load
+var current Config
+
+// Load reads the configuration, validates it and installs it for the Get* accessors. The
+// returned error lists every problem found, so a broken deployment can be fixed in one go.
+func Load() (*Config, error) {
 	// Load .env file if exists
 	_ = godotenv.Load(".env")
 
-	port = os.Getenv("PORT")
-	if port == "" {
-		port = "8080" // default port
+	source, err := newSource(os.Getenv("CONFIG_FILE"))
+	if err != nil {
+		return nil, err
+	}
+
+	// Malformed values keep their default, so validation still reports everything else
+	cfg, err := source.config()
+	if err = errors.Join(err, cfg.Validate()); err != nil {
+		return nil, err
+	}
+
+	current = *cfg
+	return cfg, nil
+}
+
+// Get returns the installed configuration
+func Get() Config {
+	return current
+}
+
+// config builds a Config from the source, collecting malformed values as errors
+func (s source) config() (*Config, error) {
+	var errs []error
+
+	cfg := &Config{
+		Mode:        s.get("GIN_MODE"),
+		Port:        s.getOr("PORT", "8080"),
+		DatabaseURL: s.get("DATABASE_URL"),
 	}
 
-	databaseURL = os.Getenv("DATABASE_URL")
-	redisURL = os.Getenv("REDIS_URL")
-	jwtSecret = os.Getenv("JWT_SECRET")
+	redisConfig, err := ParseRedisURL(s.getOr("REDIS_URL", DefaultRedisURL))
+	if err != nil {
+		errs = append(errs, err)
+	}
+	cfg.Redis = redisConfig
+
+	// The in-memory store suits development and single-instance deployments only
+	cfg.TokenStore = strings.ToLower(s.getOr("TOKEN_STORE", "redis"))
 
-	emailService = os.Getenv("EMAIL_SERVICE")
-	smtpHost = os.Getenv("SMTP_HOST")
-	smtpUsername = os.Getenv("SMTP_USERNAME")
-	smtpPassword = os.Getenv("SMTP_PASSWORD")
+	// Store outages: rate limiting fails open and revocation checks fail closed by default
+	cfg.StoreFailure = StoreFailureConfig{
+		RateLimitPolicy:  strings.ToLower(s.getOr("RATE_LIMIT_FAILURE_POLICY", FailOpen)),
+		RevocationPolicy: strings.ToLower(s.getOr("REVOCATION_FAILURE_POLICY", FailClosed)),
+	}
+	if cfg.StoreFailure.BreakerThreshold, err = s.getInt("STORE_BREAKER_THRESHOLD", 5); err != nil {
+		errs = append(errs, err)
+	}
+	breakerCooldown, err := s.getInt("STORE_BREAKER_COOLDOWN", 30)
+	if err != nil {
+		errs = append(errs, err)
+	}
+	cfg.StoreFailure.BreakerCooldown = time.Duration(breakerCooldown) * time.Second
 
-	// Set default SMTP values if not provided
-	if smtpHost == "" {
-		smtpHost = "smtp.gmail.com" // Def
-		// ault to Gmail SMTP
+	// Rate limit policies, e.g. RATE_LIMIT_LOGIN="5/15m per ip sliding-log"
+	if cfg.RateLimits, err = s.rateLimits(); err != nil {
+		errs = append(errs, err)
 	}
 
-	// Parse SMTP port
-	if portStr := os.Getenv("SMTP_PORT"); portStr != "" {
-		if parsedPort, err := strconv.Atoi(portStr); err == nil {
-			smtpPort = parsedPort
-		} else {
-			smtpPort = 587 // default SMTP port
+	// Asymmetric signing: HS256 (default), RS256 or EdDSA. Previous signing keys are
+	// comma-separated "path@time" or "kid=path@time" entries, retired at an RFC 3339 time.
+	cfg.JWT = JWTConfig{
+		Secret:         s.getOr("JWT_SECRET", DefaultJWTSecret),
+		SigningAlg:     s.getOr("JWT_SIGNING_ALG", "HS256"),
+		SigningKeyFile: s.get("JWT_SIGNING_KEY_FILE"),
+		SigningKeyID:   s.get("JWT_SIGNING_KEY_ID"),
+	}
+	if cfg.JWT.SecretNotAfter, err = s.getTime("JWT_SECRET_NOT_AFTER"); err != nil {
+		errs = append(errs, err)
+	}
+	for _, entry := range splitList(s.get("JWT_RETIRING_KEY_FILES"), nil) {
+		key, err := parseRetiringKey(entry)
+		if err != nil {
+			errs = append(errs, err)
+			continue
 		}
-	} else {
-		smtpPort = 587 // default SMTP port
+		cfg.JWT.RetiringKeys = append(cfg.JWT.RetiringKeys, key)
+	}
+
+	// Access tokens are JWTs unless opaque reference tokens are requested
+	cfg.AccessTokenFormat = strings.ToLower(s.getOr("ACCESS_TOKEN_FORMAT", "jwt"))
+
+	// Tokens go in the response body unless browser clients should get them as cookies
+	cfg.TokenDelivery = strings.ToLower(s.getOr("TOKEN_DELIVERY", "body"))
+
+	// Public base URL of this service, used as the OpenID Connect issuer
+	cfg.IssuerURL = strings.TrimRight(s.getOr("ISSUER_URL", "http://localhost:"+cfg.Port), "/")
+
+	// CSRF tokens are signed with their own secret
+	cfg.CSRFSecret = s.get("CSRF_SECRET")
+
+	// Browser origins other than this service that may call it, e.g. the web frontend
+	var allowedOrigins []string
+	for _, origin := range splitList(s.get("ALLOWED_ORIGINS"), nil) {
+		allowedOrigins = append(allowedOrigins, strings.TrimRight(origin, "/"))
 	}
 
-	// Set default JWT secret if not provided
-	if jwtSecret == "" {
-		jwtSecret = "your-super-secret-jwt-key-change-in-production"
+	// Cross-origin policy; only the origins above get CORS headers
+	cfg.CORS = CORSConfig{
+		AllowedOrigins:   allowedOrigins,
+		AllowedMethods:   splitList(s.get("CORS_ALLOWED_METHODS"), []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"}),
+		AllowedHeaders:   splitList(s.get("CORS_ALLOWED_HEADERS"), []string{"Origin", "Content-Type", "Accept", "Authorization", "X-CSRF-Token", "X-Token-Delivery"}),
+		ExposedHeaders:   splitList(s.get("CORS_EXPOSED_HEADERS"), []string{"RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "Retry-After"}),
+		AllowCredentials: s.get("CORS_ALLOW_CREDENTIALS") == "true",
+	}
+	maxAge, err := s.getInt("CORS_MAX_AGE", 600)
+	if err != nil {
+		errs = append(errs, err)
 	}
+	cfg.CORS.MaxAge = time.Duration(maxAge) * time.Second
+
+	cfg.Email = EmailConfig{
+		Service:      s.get("EMAIL_SERVICE"),
+		SMTPHost:     s.getOr("SMTP_HOST", "smtp.gmail.com"),
+		SMTPUsername: s.get("SMTP_USERNAME"),
+		SMTPPassword: s.get("SMTP_PASSWORD"),
+	}
+	if cfg.Email.SMTPPort, err = s.getInt("SMTP_PORT", 587); err != nil {
+		errs = append(errs, err)
+	}
+
+	// External identity providers, e.g. OAUTH_PROVIDERS=google,keycloak
+	for _, name := range splitList(s.get("OAUTH_PROVIDERS"), nil) {
+		cfg.OAuthProviders = append(cfg.OAuthProviders, s.oauthProvider(strings.ToLower(name), cfg.IssuerURL))
+	}
+
+	return cfg, errors.Join(errs...)
+}
+
+// IsProduction reports whether the service runs as a production deployment
+func (c *Config) IsProduction() bool {
+	return c.Mode == "release"
+}
+
+// Validate checks settings that would otherwise fail on first use, and refuses insecure
+// development defaults when running in production.
+func (c *Config) Validate() error {
+	var errs []error
+
+	switch c.Mode {
+	case "", "debug", "release", "test":
+	default:
+		errs = append(errs, fmt.Errorf("GIN_MODE must be debug, release or test, got %q", c.Mode))
+	}
+
+	switch strings.ToUpper(c.JWT.SigningAlg) {
+	case "HS256":
+	case "RS256", "EDDSA":
+		if c.IsProduction() && c.JWT.SigningKeyFile == "" {
+			errs = append(errs, fmt.Errorf("JWT_SIGNING_KEY_FILE is required for %s in production", c.JWT.SigningAlg))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("JWT_SIGNING_ALG must be HS256, RS256 or EdDSA, got %q", c.JWT.SigningAlg))
+	}
+
+	switch c.AccessTokenFormat {
+	case "jwt", "opaque":
+	default:
+		errs = append(errs, fmt.Errorf("ACCESS_TOKEN_FORMAT must be jwt or opaque, got %q", c.AccessTokenFormat))
+	}
+
+	switch c.TokenStore {
+	case "redis", "memory":
+	default:
+		errs = append(errs, fmt.Errorf("TOKEN_STORE must be redis or memory, got %q", c.TokenStore))
+	}
+
+	for _, policy := range []struct{ key, value string }{
+		{"RATE_LIMIT_FAILURE_POLICY", c.StoreFailure.RateLimitPolicy},
+		{"REVOCATION_FAILURE_POLICY", c.StoreFailure.RevocationPolicy},
+	} {
+		if policy.value != FailOpen && policy.value != FailClosed {
+			errs = append(errs, fmt.Errorf("%s must be open or closed, got %q", policy.key, policy.value))
+		}
+	}
+
+	if c.StoreFailure.BreakerThreshold < 1 {
+		errs = append(errs, fmt.Errorf("STORE_BREAKER_THRESHOLD must be at least 1, got %d", c.StoreFailure.BreakerThreshold))
+	}
+	if c.StoreFailure.BreakerCooldown < 0 {
+		errs = append(errs, fmt.Errorf("STORE_BREAKER_COOLDOWN cannot be negative, got %d", int(c.StoreFailure.BreakerCooldown.Seconds())))
+	}
+
+	switch c.TokenDelivery {
+	case "body", "cookie":
+	default:
+		errs = append(errs, fmt.Errorf("TOKEN_DELIVERY must be body or cookie, got %q", c.TokenDelivery))
+	}
+
+	if c.Email.SMTPPort < 1 || c.Email.SMTPPort > 65535 {
+		errs = append(errs, fmt.Errorf("SMTP_PORT must be between 1 and 65535, got %d", c.Email.SMTPPort))
+	}
+
+	if c.CORS.MaxAge < 0 {
+		errs = append(errs, fmt.Errorf("CORS_MAX_AGE cannot be negative, got %d", int(c.CORS.MaxAge.Seconds())))
+	}
+
+	if c.CORS.AllowCredentials {
+		for _, origin := range c.CORS.AllowedOrigins {
+			if origin == "*" {
+				errs = append(errs, errors.New("ALLOWED_ORIGINS cannot contain * when CORS_ALLOW_CREDENTIALS is true"))
+			}
+		}
+	}
+
+	if c.IsProduction() {
+		// The legacy HMAC key can stay accepted for verification with asymmetric signing, see
+		// JWT_SECRET_NOT_AFTER, so the secret matters whatever JWT_SIGNING_ALG is
+		switch {
+		case c.JWT.Secret == DefaultJWTSecret:
+			errs = append(errs, errors.New("JWT_SECRET must be changed from its default in production"))
+		case len(c.JWT.Secret) < minProductionSecretLength:
+			errs = append(errs, fmt.Errorf("JWT_SECRET must be at least %d characters in production", minProductionSecretLength))
+		}
+		// Without a shared secret each instance signs CSRF tokens with its own random key, so
+		// tokens fail on every other instance and after each restart
+		switch {
+		case c.CSRFSecret == "":
+			errs = append(errs, errors.New("CSRF_SECRET is required in production"))
+		case len(c.CSRFSecret) < minProductionSecretLength:
+			errs = append(errs, fmt.Errorf("CSRF_SECRET must be at least %d characters in production", minProductionSecretLength))
+		}
+		if c.DatabaseURL == "" {
+			errs = append(errs, errors.New("DATABASE_URL is required in production"))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// parseRetiringKey parses a JWT_RETIRING_KEY_FILES entry. The retirement time is required so
+// that it stays fixed across restarts instead of moving with every deploy.
+func parseRetiringKey(entry string) (RetiringKeyConfig, error) {
+	var key RetiringKeyConfig
+	at := strings.LastIndex(entry, "@")
+	if at < 0 {
+		return key, fmt.Errorf("JWT_RETIRING_KEY_FILES entry %q needs a retirement time, e.g. %s@2025-01-31T00:00:00Z", entry, entry)
+	}
+	notAfter, err := time.Parse(time.RFC3339, strings.TrimSpace(entry[at+1:]))
+	if err != nil {
+		return key, fmt.Errorf("JWT_RETIRING_KEY_FILES entry %q has an invalid retirement time, expected RFC 3339", entry)
+	}
+
+	key.Path, key.NotAfter = entry[:at], notAfter
+	if i := strings.Index(key.Path, "="); i > 0 {
+		key.ID, key.Path = key.Path[:i], key.Path[i+1:]
+	}
+	if key.Path == "" {
+		return key, fmt.Errorf("JWT_RETIRING_KEY_FILES entry %q has no key file", entry)
+	}
+	return key, nil
+}
+
+// splitList parses a comma-separated setting, falling back to the defaults when it is empty
+func splitList(value string, defaults []string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	if len(items) == 0 {
+		return defaults
+	}
+	return items
+}
+
+// oauthProvider reads the OAUTH_<NAME>_* settings for a single provider
+func (s source) oauthProvider(name, issuerURL string) OAuthProviderConfig {
+	prefix := "OAUTH_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_")) + "_"
+
+	provider := OAuthProviderConfig{
+		Name:         name,
+		ClientID:     s.get(prefix + "CLIENT_ID"),
+		ClientSecret: s.get(prefix + "CLIENT_SECRET"),
+		Issuer:       strings.TrimRight(s.get(prefix+"ISSUER"), "/"),
+		AuthURL:      s.get(prefix + "AUTH_URL"),
+		TokenURL:     s.get(prefix + "TOKEN_URL"),
+		UserInfoURL:  s.get(prefix + "USERINFO_URL"),
+		Scopes:       strings.Fields(strings.ReplaceAll(s.get(prefix+"SCOPES"), ",", " ")),
+		RedirectURL:  s.getOr(prefix+"REDIRECT_URL", issuerURL+"/auth/oauth/"+name+"/callback"),
+	}
+
+	if len(provider.Scopes) == 0 && provider.Issuer != "" {
+		provider.Scopes = []string{"openid", "email", "profile"}
+	}
+	return provider
 }
 
 func GetPort() string {
-	return port
+	return current.Port
 }
 
 func GetDatabaseURL() string {
-	return databaseURL
+	return current.DatabaseURL
 }
 
 func GetRedisURL() string {
-	return redisURL
+	return current.Redis.URL
+}
+
+func GetRedis() RedisConfig {
+	return current.Redis
+}
+
+func GetTokenStore() string {
+	return current.TokenStore
+}
+
+func GetStoreFailure() StoreFailureConfig {
+	return current.StoreFailure
+}
+
+func GetRateLimits() map[string]RateLimitPolicy {
+	return current.RateLimits
 }
 
 func GetJWTSecret() string {
-	return jwtSecret
+	return current.JWT.Secret
+}
+
+func GetJWTSigningAlg() string {
+	return current.JWT.SigningAlg
+}
+
+func GetJWTSigningKeyFile() string {
+	return current.JWT.SigningKeyFile
+}
+
+func GetJWTSigningKeyID() string {
+	return current.JWT.SigningKeyID
+}
+
+func GetJWTSecretNotAfter() time.Time {
+	return current.JWT.SecretNotAfter
+}
+
+func GetJWTRetiringKeys() []RetiringKeyConfig {
+	return current.JWT.RetiringKeys
+}
+
+func GetAccessTokenFormat() string {
+	return current.AccessTokenFormat
+}
+
+func GetTokenDelivery() string {
+	return current.TokenDelivery
+}
+
+func GetIssuerURL() string {
+	return current.IssuerURL
+}
+
+func GetCSRFSecret() string {
+	return current.CSRFSecret
+}
+
+func GetAllowedOrigins() []string {
+	return current.CORS.AllowedOrigins
+}
+
+func GetCORS() CORSConfig {
+	return current.CORS
+}
+
+func GetOAuthProviders() []OAuthProviderConfig {
+	return current.OAuthProviders
 }
 
 func GetEmailService() string {
-	return emailService
+	return current.Email.Service
 }
 
 func GetSMTPHost() string {
-	return smtpHost
+	return current.Email.SMTPHost
 }
 
 func GetSMTPPort() int {
-	return smtpPort
+	return current.Email.SMTPPort
 }
 
 func GetSMTPUsername() string {
-	return smtpUsername
+	return current.Email.SMTPUsername
 }
 
 func GetSMTPPassword() string {
-	return smtpPassword
+	return current.Email.SMTPPassword
 }
@@ -0,0 +1,131 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Rate limit policies the routes apply. Each is configured with RATE_LIMIT_<NAME>, e.g.
+// RATE_LIMIT_LOGIN or rate_limit.login in a config file.
+const (
+	// RateLimitPublic covers every public route
+	RateLimitPublic = "public"
+	// RateLimitOAuth covers the OAuth token, introspection and revocation endpoints
+	RateLimitOAuth = "oauth"
+	// RateLimitLogin is the login attempt budget shared by password, MFA and social logins
+	RateLimitLogin = "login"
+	// RateLimitPasswordReset covers password reset requests
+	RateLimitPasswordReset = "password_reset"
+	// RateLimitAccount covers the routes of logged-in users, such as /auth/me, sessions, MFA
+	// enrollment, /user and /admin
+	RateLimitAccount = "account"
+)
+
+// defaultRateLimits are the policies used unless configured otherwise. authenticated marks the
+// policies the routes apply after AuthMiddleware; only those know the user to limit per user.
+var defaultRateLimits = []struct {
+	name, rule    string
+	authenticated bool
+}{
+	{name: RateLimitPublic, rule: "100/15m per ip token-bucket"},
+	{name: RateLimitOAuth, rule: "100/15m per ip token-bucket"},
+	{name: RateLimitLogin, rule: "5/15m per ip sliding-log"},
+	{name: RateLimitPasswordReset, rule: "3/1h per ip sliding-log"},
+	{name: RateLimitAccount, rule: "300/15m per user token-bucket", authenticated: true},
+}
+
+// minRateLimitWindow rejects windows that can only be a unit mistake
+const minRateLimitWindow = time.Second
+
+// RateLimitPolicy allows Limit requests per Window for every client, where clients are told
+// apart by Key: ip, or user for authenticated routes. Strategy is sliding-log or token-bucket.
+type RateLimitPolicy struct {
+	Name     string
+	Key      string
+	Strategy string
+	Limit    int
+	Window   time.Duration
+	// Disabled turns the policy off, its routes are not limited
+	Disabled bool
+}
+
+// String formats the policy the way it is configured
+func (p RateLimitPolicy) String() string {
+	if p.Disabled {
+		return "off"
+	}
+	return fmt.Sprintf("%d/%s per %s %s", p.Limit, p.Window, p.Key, p.Strategy)
+}
+
+// ParseRateLimitPolicy parses a rule of the form "<limit>/<window> per <ip|user> [strategy]",
+// e.g. "5/15m per ip sliding-log". The window needs a unit (30s, 15m, 1h) and the strategy
+// defaults to sliding-log. "off" disables the policy.
+func ParseRateLimitPolicy(name, rule string) (RateLimitPolicy, error) {
+	key := "RATE_LIMIT_" + strings.ToUpper(name)
+	policy := RateLimitPolicy{Name: name, Key: "ip", Strategy: "sliding-log"}
+
+	fields := strings.Fields(strings.ToLower(rule))
+	if len(fields) == 1 && fields[0] == "off" {
+		policy.Disabled = true
+		return policy, nil
+	}
+	if len(fields) < 3 || len(fields) > 4 || fields[1] != "per" {
+		return policy, fmt.Errorf("%s must look like \"5/15m per ip sliding-log\", got %q", key, rule)
+	}
+
+	limit, window, found := strings.Cut(fields[0], "/")
+	if !found {
+		return policy, fmt.Errorf("%s must give a limit and a window such as 5/15m, got %q", key, fields[0])
+	}
+	var err error
+	if policy.Limit, err = strconv.Atoi(limit); err != nil || policy.Limit < 1 {
+		return policy, fmt.Errorf("%s limit must be a positive number, got %q", key, limit)
+	}
+	if policy.Window, err = time.ParseDuration(window); err != nil {
+		return policy, fmt.Errorf("%s window must be a duration with a unit such as 30s, 15m or 1h, got %q", key, window)
+	}
+	if policy.Window < minRateLimitWindow {
+		return policy, fmt.Errorf("%s window must be at least %s, got %s", key, minRateLimitWindow, policy.Window)
+	}
+
+	switch policy.Key = fields[2]; policy.Key {
+	case "ip", "user":
+	default:
+		return policy, fmt.Errorf("%s must limit per ip or per user, got %q", key, policy.Key)
+	}
+
+	if len(fields) == 4 {
+		switch policy.Strategy = fields[3]; policy.Strategy {
+		case "sliding-log", "token-bucket":
+		default:
+			return policy, fmt.Errorf("%s strategy must be sliding-log or token-bucket, got %q", key, policy.Strategy)
+		}
+	}
+
+	return policy, nil
+}
+
+// rateLimits reads every policy, falling back to the defaults
+func (s source) rateLimits() (map[string]RateLimitPolicy, error) {
+	policies := make(map[string]RateLimitPolicy, len(defaultRateLimits))
+	var errs []error
+
+	for _, defaults := range defaultRateLimits {
+		policy, err := ParseRateLimitPolicy(defaults.name, s.getOr("RATE_LIMIT_"+strings.ToUpper(defaults.name), defaults.rule))
+		if err == nil && policy.Key == "user" && !defaults.authenticated {
+			// Before authentication there is no user, so the policy would never limit anything
+			err = fmt.Errorf("RATE_LIMIT_%s applies before authentication, so it can only limit per ip", strings.ToUpper(defaults.name))
+		}
+		if err != nil {
+			errs = append(errs, err)
+			// Keep the default, so the other settings are still checked
+			policy, _ = ParseRateLimitPolicy(defaults.name, defaults.rule)
+		}
+		policies[defaults.name] = policy
+	}
+
+	return policies, errors.Join(errs...)
+}
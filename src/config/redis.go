@@ -0,0 +1,122 @@
+package config
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// DefaultRedisURL points at the Redis service of the Docker Compose stack
+const DefaultRedisURL = "redis://cache:6379/0"
+
+// RedisConfig is where the blacklist, sessions and rate limit counters live, parsed from
+// REDIS_URL. The scheme picks the deployment:
+//
+//	redis://[user:password@]host:port/db                   a single server
+//	rediss://...                                           the same over TLS
+//	redis-sentinel://[:password@]host:port,host:port/db?master=name
+//	redis-cluster://[:password@]host:port,host:port
+//
+// The sentinel and cluster schemes have TLS variants as well, rediss-sentinel and rediss-cluster.
+type RedisConfig struct {
+	URL        string
+	Addrs      []string
+	Username   string
+	Password   string
+	DB         int
+	TLS        bool
+	MasterName string // set for Sentinel, the name of the monitored master
+	Cluster    bool
+}
+
+// ParseRedisURL reads a REDIS_URL. A bare host:port is accepted as well.
+func ParseRedisURL(value string) (RedisConfig, error) {
+	if !strings.Contains(value, "://") {
+		return RedisConfig{URL: value, Addrs: []string{value}}, nil
+	}
+
+	// url.Parse errors quote the URL, password included, so they are not passed on
+	u, err := url.Parse(value)
+	if err != nil {
+		return RedisConfig{}, errors.New("REDIS_URL is not a valid URL")
+	}
+	invalid := func(format string, args ...interface{}) (RedisConfig, error) {
+		return RedisConfig{}, fmt.Errorf("REDIS_URL %s: %s", u.Redacted(), fmt.Sprintf(format, args...))
+	}
+
+	cfg := RedisConfig{URL: value}
+	defaultPort := "6379"
+	switch u.Scheme {
+	case "redis", "rediss":
+	case "redis-sentinel", "rediss-sentinel":
+		cfg.MasterName = u.Query().Get("master")
+		if cfg.MasterName == "" {
+			return invalid("the master query parameter is required for Sentinel")
+		}
+		defaultPort = "26379"
+	case "redis-cluster", "rediss-cluster":
+		cfg.Cluster = true
+	default:
+		return invalid("unsupported scheme %q", u.Scheme)
+	}
+	cfg.TLS = strings.HasPrefix(u.Scheme, "rediss")
+
+	if u.User != nil {
+		cfg.Username = u.User.Username()
+		cfg.Password, _ = u.User.Password()
+	}
+
+	for _, addr := range strings.Split(u.Host, ",") {
+		if addr = strings.TrimSpace(addr); addr == "" {
+			continue
+		}
+		if _, _, err := net.SplitHostPort(addr); err != nil {
+			addr = net.JoinHostPort(addr, defaultPort)
+		}
+		cfg.Addrs = append(cfg.Addrs, addr)
+	}
+	if len(cfg.Addrs) == 0 {
+		return invalid("no host")
+	}
+	if len(cfg.Addrs) > 1 && cfg.MasterName == "" && !cfg.Cluster {
+		return invalid("several hosts need the redis-sentinel or redis-cluster scheme")
+	}
+
+	if db := strings.Trim(u.Path, "/"); db != "" {
+		if cfg.DB, err = strconv.Atoi(db); err != nil || cfg.DB < 0 {
+			return invalid("database %q is not a number", db)
+		}
+	}
+	if cfg.Cluster && cfg.DB != 0 {
+		return invalid("Redis Cluster only has database 0")
+	}
+
+	return cfg, nil
+}
+
+// Options returns the client options for the configured Redis. The zero value, as seen before
+// Load has run, points at the default address.
+func (r RedisConfig) Options() *redis.UniversalOptions {
+	if len(r.Addrs) == 0 {
+		r, _ = ParseRedisURL(DefaultRedisURL)
+	}
+
+	options := &redis.UniversalOptions{
+		Addrs:      r.Addrs,
+		Username:   r.Username,
+		Password:   r.Password,
+		DB:         r.DB,
+		MasterName: r.MasterName,
+	}
+	if r.TLS {
+		// The server name is taken from each address when dialing
+		options.TLSConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+	return options
+}
@@ -0,0 +1,136 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// source looks settings up by their environment variable name. The environment wins over the
+// config file, so a deployment can override a single value without editing the file.
+type source struct {
+	file map[string]string
+}
+
+// newSource reads the optional config file. Its keys are the environment variable names,
+// either flat (SMTP_PORT: 587) or nested by their underscore-separated parts:
+//
+//	smtp:
+//	  port: 587
+func newSource(path string) (source, error) {
+	if path == "" {
+		return source{}, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return source{}, fmt.Errorf("failed to read CONFIG_FILE: %w", err)
+	}
+
+	var values map[string]interface{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &values)
+	case ".toml":
+		err = toml.Unmarshal(data, &values)
+	default:
+		return source{}, fmt.Errorf("CONFIG_FILE %s must be a .yaml, .yml or .toml file", path)
+	}
+	if err != nil {
+		return source{}, fmt.Errorf("failed to parse CONFIG_FILE %s: %w", path, err)
+	}
+
+	file := map[string]string{}
+	if err := flatten(file, "", values); err != nil {
+		return source{}, fmt.Errorf("invalid CONFIG_FILE %s: %w", path, err)
+	}
+	return source{file: file}, nil
+}
+
+// flatten turns nested tables into KEY_SUBKEY entries and lists into comma-separated values
+func flatten(into map[string]string, prefix string, values map[string]interface{}) error {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		name := strings.ToUpper(strings.ReplaceAll(key, "-", "_"))
+		if prefix != "" {
+			name = prefix + "_" + name
+		}
+
+		switch value := values[key].(type) {
+		case map[string]interface{}:
+			if err := flatten(into, name, value); err != nil {
+				return err
+			}
+		case []interface{}:
+			items := make([]string, 0, len(value))
+			for _, item := range value {
+				if _, nested := item.(map[string]interface{}); nested {
+					return fmt.Errorf("%s: lists can only hold plain values", name)
+				}
+				items = append(items, fmt.Sprint(item))
+			}
+			into[name] = strings.Join(items, ",")
+		case time.Time:
+			// TOML parses offset date-times itself; keep them in the RFC 3339 form getTime reads
+			into[name] = value.Format(time.RFC3339Nano)
+		case nil:
+		default:
+			into[name] = fmt.Sprint(value)
+		}
+	}
+	return nil
+}
+
+// get returns the setting, or "" when neither the environment nor the file sets it
+func (s source) get(key string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return s.file[key]
+}
+
+func (s source) getOr(key, fallback string) string {
+	if value := s.get(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
+// getInt parses a numeric setting. A value that is set but not a number is an error rather
+// than a silent fallback to the default.
+func (s source) getInt(key string, fallback int) (int, error) {
+	value := strings.TrimSpace(s.get(key))
+	if value == "" {
+		return fallback, nil
+	}
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		return fallback, fmt.Errorf("%s must be a number, got %q", key, value)
+	}
+	return parsed, nil
+}
+
+// getTime parses an RFC 3339 timestamp setting, returning the zero time when it is not set
+func (s source) getTime(key string) (time.Time, error) {
+	value := strings.TrimSpace(s.get(key))
+	if value == "" {
+		return time.Time{}, nil
+	}
+	parsed, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%s must be an RFC 3339 time such as 2025-01-31T00:00:00Z, got %q", key, value)
+	}
+	return parsed, nil
+}
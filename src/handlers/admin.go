@@ -0,0 +1,190 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"go-auth-system/src/models"
+	"go-auth-system/src/utils"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+var errLastAdmin = errors.New("cannot remove the last admin")
+
+// AdminHandler exposes role management. Every route is guarded by RequirePermission in SetupRoutes,
+// or by RequireScope for the service routes that machine tokens call.
+type AdminHandler struct {
+	DB             *gorm.DB
+	SecurityLogger *utils.SecurityLogger
+}
+
+func NewAdminHandler(db *gorm.DB) *AdminHandler {
+	return &AdminHandler{
+		DB:             db,
+		SecurityLogger: utils.NewSecurityLogger(),
+	}
+}
+
+// ListRoles returns every role with the permissions it grants
+func (h *AdminHandler) ListRoles(c *gin.Context) {
+	var roles []models.Role
+	if err := h.DB.Preload("Permissions").Order("name").Find(&roles).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not load roles"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"roles": roles})
+}
+
+// GetUser returns the admin view of a user, including lockout and verification state
+func (h *AdminHandler) GetUser(c *gin.Context) {
+	user, ok := h.targetUser(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, user.AdminView())
+}
+
+// GetUserRoles returns the roles and effective permissions of a user
+func (h *AdminHandler) GetUserRoles(c *gin.Context) {
+	user, ok := h.targetUser(c)
+	if !ok {
+		return
+	}
+
+	access, err := models.LoadUserAccess(h.DB, user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not load roles"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"user_id":     user.ID,
+		"roles":       access.Roles,
+		"permissions": access.Permissions,
+	})
+}
+
+// AssignUserRole grants a role to a user
+func (h *AdminHandler) AssignUserRole(c *gin.Context) {
+	var input struct {
+		Role string `json:"role" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+
+	user, ok := h.targetUser(c)
+	if !ok {
+		return
+	}
+
+	if err := models.AssignRole(h.DB, user.ID, input.Role); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Role not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not assign role"})
+		return
+	}
+
+	h.SecurityLogger.LogRoleChange("role_assigned", c.GetUint("userID"), user.ID, input.Role, c.ClientIP(), c.GetHeader("User-Agent"))
+	c.JSON(http.StatusOK, gin.H{"message": "Role assigned"})
+}
+
+// RemoveUserRole revokes a role from a user. The last admin cannot be demoted, so the
+// system can never lock itself out of role management.
+func (h *AdminHandler) RemoveUserRole(c *gin.Context) {
+	user, ok := h.targetUser(c)
+	if !ok {
+		return
+	}
+
+	var role models.Role
+	if err := h.DB.Where("name = ?", c.Param("role")).First(&role).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Role not found"})
+		return
+	}
+
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("user_id = ? AND role_id = ?", user.ID, role.ID).Delete(&models.UserRole{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+
+		if role.Name == models.RoleAdmin {
+			var admins int64
+			if err := tx.Model(&models.UserRole{}).Where("role_id = ?", role.ID).Count(&admins).Error; err != nil {
+				return err
+			}
+			if admins == 0 {
+				return errLastAdmin
+			}
+		}
+		return nil
+	})
+
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "User does not have this role"})
+		return
+	case errors.Is(err, errLastAdmin):
+		c.JSON(http.StatusConflict, gin.H{"error": "Cannot remove the last admin"})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not remove role"})
+		return
+	}
+
+	h.SecurityLogger.LogRoleChange("role_removed", c.GetUint("userID"), user.ID, role.Name, c.ClientIP(), c.GetHeader("User-Agent"))
+	c.JSON(http.StatusOK, gin.H{"message": "Role removed"})
+}
+
+// RevokeUserTokens logs a user out everywhere: every token issued to them so far stops working
+func (h *AdminHandler) RevokeUserTokens(c *gin.Context) {
+	user, ok := h.targetUser(c)
+	if !ok {
+		return
+	}
+
+	if err := models.RevokeUserTokens(h.DB, user.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not revoke tokens"})
+		return
+	}
+
+	h.SecurityLogger.LogAllTokensRevoked(user.ID, fmt.Sprintf("revoked by admin %d", c.GetUint("userID")), c.ClientIP(), c.GetHeader("User-Agent"))
+	c.JSON(http.StatusOK, gin.H{"message": "Tokens revoked"})
+}
+
+func (h *AdminHandler) targetUser(c *gin.Context) (*models.User, bool) {
+	id, ok := userIDParam(c)
+	if !ok {
+		return nil, false
+	}
+
+	var user models.User
+	if err := h.DB.First(&user, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return nil, false
+	}
+	return &user, true
+}
+
+// userIDParam parses the :id path parameter. It must be parsed before it reaches gorm, which
+// treats a string primary key argument as raw SQL.
+func userIDParam(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 0)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return 0, false
+	}
+	return uint(id), true
+}
@@ -1,35 +1,57 @@
 package handlers
 
 import (
-	"context"
+	"errors"
 	"fmt"
 	"net/http"
-	"strings"
 	"time"
 
+	"go-auth-system/src/middleware"
 	"go-auth-system/src/models"
+	"go-auth-system/src/services"
 	"go-auth-system/src/utils"
 
 	"github.com/gin-gonic/gin"
-	"github.com/go-redis/redis/v8"
 	"gorm.io/gorm"
 )
 
+var errRefreshTokenRotated = errors.New("refresh token already rotated")
+
+// errRevocationNotStored marks a revocation the token store failed to record
+var errRevocationNotStored = errors.New("revocation not stored")
+
+// revocationNotStored wraps a failed blacklist or session revocation write
+func revocationNotStored(err error) error {
+	if err == nil {
+		return nil
+	}
+	return fmt.Errorf("%w: %w", errRevocationNotStored, err)
+}
+
+// revocationFailed answers a revocation that did not go through. A token the store failed to
+// mark keeps working, so the client gets 503 and retries instead of believing it is done.
+func revocationFailed(c *gin.Context, err error) bool {
+	switch {
+	case err == nil:
+		return false
+	case errors.Is(err, errRevocationNotStored):
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Token revocation is temporarily unavailable, please try again"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not revoke token"})
+	}
+	return true
+}
+
 type AuthHandler struct {
 	DB             *gorm.DB
-	RedisClient    *redis.Client
+	Store          services.TokenStore
 	SecurityLogger *utils.SecurityLogger
 }
 
-func NewAuthHandler(db *gorm.DB) *AuthHandler {
-	rdb := redis.NewClient(&redis.Options{
-		Addr:     "cache:6379",
-		Password: "",
-		DB:       0,
-	})
+func NewAuthHandler(db *gorm.DB, store services.TokenStore) *AuthHandler {
 	return &AuthHandler{
 		DB:             db,
-		RedisClient:    rdb,
+		Store:          store,
 		SecurityLogger: utils.NewSecurityLogger(),
 	}
 }
@@ -96,7 +118,14 @@ func (h *AuthHandler) Register(c *gin.Context) {
 		UpdatedAt:        time.Now(),
 	}
 
-	if err := h.DB.Create(&user).Error; err != nil {
+	// Every account starts with the default role
+	err = h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&user).Error; err != nil {
+			return err
+		}
+		return models.AssignRole(tx, user.ID, models.RoleUser)
+	})
+	if err != nil {
 		fmt.Println("DB error:", err) // Debugging
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not create user"})
 		return
@@ -112,7 +141,7 @@ func (h *AuthHandler) Register(c *gin.Context) {
 	// Store email verification token
 	verificationTokenRecord := models.EmailVerificationToken{
 		UserID:    user.ID,
-		Token:     verificationToken,
+		TokenHash: utils.HashToken(verificationToken),
 		ExpiresAt: time.Now().Add(24 * time.Hour), // 24 hours expiry
 	}
 
@@ -173,33 +202,74 @@ func (h *AuthHandler) Login(c *gin.Context) {
 		return
 	}
 
+	h.startSession(c, &user)
+}
+
+// startSession finishes a first-factor login: users with MFA get a short-lived challenge token,
+// everyone else gets their token pair straight away
+func (h *AuthHandler) startSession(c *gin.Context, user *models.User) {
+	// Hold back the tokens until the second factor has been verified
+	if user.MFAEnabled {
+		mfaToken, err := utils.GenerateMFAPendingToken(user.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not generate MFA challenge"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"mfa_required": true,
+			"mfa_token":    mfaToken,
+			"token_type":   string(utils.MFAPendingToken),
+			"expires_in":   int(utils.MFAPendingTokenTTL.Seconds()),
+		})
+		return
+	}
+
+	h.completeLogin(c, user)
+}
+
+// completeLogin records a successful authentication and responds with a fresh token pair
+func (h *AuthHandler) completeLogin(c *gin.Context, user *models.User) {
 	// Reset failed login count on successful login
 	user.ResetFailedLoginCount()
 	now := time.Now()
 	user.LastLoginAt = &now
-	h.DB.Save(&user)
+	h.DB.Save(user)
 
 	// Log successful login
-	h.SecurityLogger.LogLoginAttempt(normalizedEmail, c.ClientIP(), c.GetHeader("User-Agent"), true, &user.ID)
+	h.SecurityLogger.LogLoginAttempt(user.Email, c.ClientIP(), c.GetHeader("User-Agent"), true, &user.ID)
 
-	// Generate tokens
-	accessToken, err := utils.GenerateAccessToken(user.ID)
+	h.respondWithTokens(c, user.ID)
+}
+
+// respondWithTokens starts a new session: it stores a refresh token carrying the device
+// details, issues an access token bound to that session and writes the response
+func (h *AuthHandler) respondWithTokens(c *gin.Context, userID uint) {
+	refreshToken, err := utils.GenerateRefreshToken(userID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not generate access token"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not generate refresh token"})
 		return
 	}
 
-	refreshToken, err := utils.GenerateRefreshToken(user.ID)
+	// Every login starts a new token family that all of its rotations belong to
+	familyID, err := utils.GenerateRandomToken(16)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not generate refresh token"})
 		return
 	}
 
 	// Store refresh token in database
+	userAgent := deviceUserAgent(c)
+	now := time.Now()
 	refreshTokenRecord := models.RefreshToken{
-		UserID:    user.ID,
-		Token:     refreshToken,
-		ExpiresAt: time.Now().Add(7 * 24 * time.Hour),
+		UserID:     userID,
+		TokenHash:  utils.HashToken(refreshToken),
+		FamilyID:   familyID,
+		ExpiresAt:  now.Add(7 * 24 * time.Hour),
+		UserAgent:  userAgent,
+		IPAddress:  c.ClientIP(),
+		Label:      utils.DeviceLabel(userAgent),
+		LastUsedAt: &now,
 	}
 
 	if err := h.DB.Create(&refreshTokenRecord).Error; err != nil {
@@ -207,6 +277,32 @@ func (h *AuthHandler) Login(c *gin.Context) {
 		return
 	}
 
+	accessToken, err := h.issueAccessToken(userID, refreshTokenRecord.SessionID())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not generate access token"})
+		return
+	}
+
+	writeTokens(c, accessToken, refreshToken, true)
+}
+
+// writeTokens hands a token pair to the client: in the response body, or as HttpOnly cookies
+// that scripts never see when the client uses cookie session mode. newSession is set for logins.
+func writeTokens(c *gin.Context, accessToken, refreshToken string, newSession bool) {
+	if middleware.CookieSessionRequested(c) {
+		csrfToken, err := middleware.SetSessionCookies(c, accessToken, refreshToken, newSession)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not start session"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"token_type": "cookie",
+			"expires_in": int(utils.AccessTokenTTL.Seconds()),
+			"csrf_token": csrfToken,
+		})
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"access_token":  accessToken,
 		"refresh_token": refreshToken,
@@ -215,12 +311,42 @@ func (h *AuthHandler) Login(c *gin.Context) {
 	})
 }
 
+// issueAccessToken generates a first-party access token carrying the user's current roles and
+// permissions and the session it belongs to
+func (h *AuthHandler) issueAccessToken(userID uint, sessionID string) (string, error) {
+	access, err := models.LoadUserAccess(h.DB, userID)
+	if err != nil {
+		return "", err
+	}
+
+	return utils.GenerateAccessTokenWithOptions(userID, utils.AccessTokenOptions{
+		Roles:       access.Roles,
+		Permissions: access.Permissions,
+		SessionID:   sessionID,
+	})
+}
+
 func (h *AuthHandler) RefreshToken(c *gin.Context) {
 	var input struct {
-		RefreshToken string `json:"refresh_token" binding:"required"`
+		RefreshToken string `json:"refresh_token"`
 	}
 
-	if err := c.ShouldBindJSON(&input); err != nil {
+	// Cookie sessions send no body; their refresh token comes from the cookie and, since the
+	// browser sends it on its own, the request has to pass the CSRF checks
+	if err := c.ShouldBindJSON(&input); err != nil && c.Request.ContentLength > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+	if input.RefreshToken == "" {
+		if cookie, err := c.Cookie(middleware.RefreshTokenCookie); err == nil && cookie != "" {
+			if !middleware.ValidCSRFRequest(c) {
+				c.JSON(http.StatusForbidden, gin.H{"error": "CSRF token invalid or missing"})
+				return
+			}
+			input.RefreshToken = cookie
+		}
+	}
+	if input.RefreshToken == "" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
 		return
 	}
@@ -232,24 +358,41 @@ func (h *AuthHandler) RefreshToken(c *gin.Context) {
 		return
 	}
 
+	// Look the token up first, rotated ones included, so that a replay is recognised even
+	// though rotation also blacklists the old token
+	var refreshTokenRecord models.RefreshToken
+	if err := h.DB.Where("token_hash = ?", utils.HashToken(input.RefreshToken)).First(&refreshTokenRecord).Error; err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
+		return
+	}
+
+	if refreshTokenRecord.IsRotated() {
+		h.revokeReusedTokenFamily(c, &refreshTokenRecord)
+		return
+	}
+
 	// Check if refresh token is blacklisted
-	blacklisted, err := h.RedisClient.Get(context.Background(), "blacklist:"+input.RefreshToken).Result()
-	if err == nil && blacklisted == "true" {
+	blacklisted, err := h.Store.IsTokenBlacklisted(input.RefreshToken)
+	if middleware.RevocationUnknown(c, err) {
+		return
+	}
+	if blacklisted {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Refresh token has been revoked"})
 		return
 	}
 
-	// Check if refresh token exists in database
-	var refreshTokenRecord models.RefreshToken
-	if err := h.DB.Where("token = ? AND expires_at > ?", input.RefreshToken, time.Now()).First(&refreshTokenRecord).Error; err != nil {
+	if !refreshTokenRecord.ExpiresAt.After(time.Now()) {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
 		return
 	}
 
+	if utils.IssuedBeforeWatermark(claims) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Refresh token has been revoked"})
+		return
+	}
+
 	// Blacklist the current access token (if provided) so it stops working immediately
-	authHeader := c.GetHeader("Authorization")
-	if strings.HasPrefix(authHeader, "Bearer ") {
-		currentAccessToken := strings.TrimPrefix(authHeader, "Bearer ")
+	if currentAccessToken, _ := middleware.AccessTokenFromRequest(c); currentAccessToken != "" {
 		// Default TTL for blacklist; will be overridden by remaining token lifetime if available
 		ttl := 15 * time.Minute
 		if accessClaims, err := utils.ValidateToken(currentAccessToken, utils.AccessToken); err == nil && accessClaims.ExpiresAt != nil {
@@ -258,11 +401,16 @@ func (h *AuthHandler) RefreshToken(c *gin.Context) {
 				ttl = remaining
 			}
 		}
-		_ = h.RedisClient.Set(context.Background(), "blacklist:"+currentAccessToken, "true", ttl).Err()
+		if revocationFailed(c, revocationNotStored(h.Store.BlacklistToken(currentAccessToken, ttl))) {
+			return
+		}
+		if revocationFailed(c, utils.RevokeReferenceToken(currentAccessToken)) {
+			return
+		}
 	}
 
-	// Generate new tokens (token rotation)
-	newAccessToken, err := utils.GenerateAccessToken(claims.UserID)
+	// Generate new tokens (token rotation); roles are reloaded so changes apply from the next refresh
+	newAccessToken, err := h.issueAccessToken(claims.UserID, refreshTokenRecord.SessionID())
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not generate access token"})
 		return
@@ -275,19 +423,44 @@ func (h *AuthHandler) RefreshToken(c *gin.Context) {
 	}
 
 	// Blacklist the old refresh token
-	h.RedisClient.Set(context.Background(), "blacklist:"+input.RefreshToken, "true", 7*24*time.Hour)
-
-	// Remove old refresh token from database
-	h.DB.Where("token = ?", input.RefreshToken).Delete(&models.RefreshToken{})
-
-	// Store new refresh token
-	newRefreshTokenRecord := models.RefreshToken{
-		UserID:    claims.UserID,
-		Token:     newRefreshToken,
-		ExpiresAt: time.Now().Add(7 * 24 * time.Hour),
+	if revocationFailed(c, revocationNotStored(h.Store.BlacklistToken(input.RefreshToken, 7*24*time.Hour))) {
+		return
 	}
 
-	if err := h.DB.Create(&newRefreshTokenRecord).Error; err != nil {
+	// Rotate the stored token in place so the session keeps its ID, and note where it was used.
+	// The old token stays behind in the same family, marked as rotated, so a replay is detected.
+	now := time.Now()
+	rotated := models.RefreshToken{
+		UserID:    refreshTokenRecord.UserID,
+		TokenHash: refreshTokenRecord.TokenHash,
+		FamilyID:  refreshTokenRecord.FamilyID,
+		ExpiresAt: refreshTokenRecord.ExpiresAt,
+		RotatedAt: &now,
+	}
+	err = h.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.RefreshToken{}).
+			Where("id = ? AND token_hash = ?", refreshTokenRecord.ID, refreshTokenRecord.TokenHash).
+			Updates(map[string]interface{}{
+				"token_hash":   utils.HashToken(newRefreshToken),
+				"expires_at":   now.Add(7 * 24 * time.Hour),
+				"user_agent":   deviceUserAgent(c),
+				"ip_address":   c.ClientIP(),
+				"last_used_at": now,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errRefreshTokenRotated
+		}
+		return tx.Create(&rotated).Error
+	})
+	if errors.Is(err, errRefreshTokenRotated) {
+		// A concurrent request rotated the same token first
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
+		return
+	}
+	if err != nil {
 		h.SecurityLogger.LogTokenRefresh(claims.UserID, c.ClientIP(), c.GetHeader("User-Agent"), false)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not store new refresh token"})
 		return
@@ -296,12 +469,7 @@ func (h *AuthHandler) RefreshToken(c *gin.Context) {
 	// Log successful token refresh
 	h.SecurityLogger.LogTokenRefresh(claims.UserID, c.ClientIP(), c.GetHeader("User-Agent"), true)
 
-	c.JSON(http.StatusOK, gin.H{
-		"access_token":  newAccessToken,
-		"refresh_token": newRefreshToken,
-		"token_type":    "Bearer",
-		"expires_in":    100000, // 100 seconds
-	})
+	writeTokens(c, newAccessToken, newRefreshToken, false)
 }
 
 func (h *AuthHandler) Logout(c *gin.Context) {
@@ -325,45 +493,130 @@ func (h *AuthHandler) Logout(c *gin.Context) {
 
 	// Try to bind JSON, but don't require it
 	c.ShouldBindJSON(&input)
+	if input.RefreshToken == "" {
+		input.RefreshToken, _ = c.Cookie(middleware.RefreshTokenCookie)
+	}
 
 	// If refresh token is provided, remove it from database and blacklist it
 	if input.RefreshToken != "" {
-		// Validate refresh token first
-		_, err := utils.ValidateToken(input.RefreshToken, utils.RefreshToken)
-		if err == nil {
-			// Remove refresh token from database
-			h.DB.Where("token = ?", input.RefreshToken).Delete(&models.RefreshToken{})
-
-			// Blacklist the refresh token in Redis
-			h.RedisClient.Set(context.Background(), "blacklist:"+input.RefreshToken, "true", 7*24*time.Hour)
+		if revocationFailed(c, h.revokeRefreshToken(input.RefreshToken, userID)) {
+			return
 		}
 	}
 
-	// Blacklist the current access token from Authorization header
-	authHeader := c.GetHeader("Authorization")
-	if strings.HasPrefix(authHeader, "Bearer ") {
-		currentAccessToken := strings.TrimPrefix(authHeader, "Bearer ")
-		// Calculate remaining token lifetime for proper TTL
-		ttl := 15 * time.Minute // Default TTL
-		if accessClaims, err := utils.ValidateToken(currentAccessToken, utils.AccessToken); err == nil && accessClaims.ExpiresAt != nil {
-			remaining := time.Until(accessClaims.ExpiresAt.Time)
-			if remaining > 0 {
-				ttl = remaining
-			}
+	// Blacklist the current access token from the Authorization header or cookie
+	if currentAccessToken, _ := middleware.AccessTokenFromRequest(c); currentAccessToken != "" {
+		if revocationFailed(c, h.revokeAccessToken(currentAccessToken)) {
+			return
+		}
+	}
+
+	// End the session the access token belongs to, even if the client did not send its refresh token
+	if sessionID := c.GetString("sessionID"); sessionID != "" {
+		var session models.RefreshToken
+		if err := h.DB.Where("id = ? AND user_id = ?", sessionID, userID).First(&session).Error; err == nil {
+			h.DB.Where("family_id = ?", session.FamilyID).Delete(&models.RefreshToken{})
 		}
-		// Blacklist the access token
-		h.RedisClient.Set(context.Background(), "blacklist:"+currentAccessToken, "true", ttl)
 	}
 
 	// Clear any cached user sessions
-	h.RedisClient.Del(context.Background(), fmt.Sprintf("user_session:%d", userID))
+	h.Store.DeleteUserSession(userID)
 
 	// Log logout
 	h.SecurityLogger.LogLogout(userID, c.ClientIP(), c.GetHeader("User-Agent"))
 
+	middleware.ClearSessionCookies(c)
+
 	c.JSON(http.StatusOK, gin.H{"message": "Logged out successfully"})
 }
 
+// Revoke is the OAuth 2.0 token revocation endpoint (RFC 7009). Holding the token is all the
+// proof needed, so SPAs and native apps can revoke tokens without an authenticated request.
+func (h *AuthHandler) Revoke(c *gin.Context) {
+	token := c.PostForm("token")
+	if token == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_request", "error_description": "token is required"})
+		return
+	}
+
+	// The hint only decides which kind of token is tried first
+	tokenTypes := []utils.TokenType{utils.AccessToken, utils.RefreshToken}
+	if c.PostForm("token_type_hint") == "refresh_token" {
+		tokenTypes[0], tokenTypes[1] = tokenTypes[1], tokenTypes[0]
+	}
+
+	for _, tokenType := range tokenTypes {
+		claims, err := utils.ValidateToken(token, tokenType)
+		if err != nil {
+			continue
+		}
+
+		if tokenType == utils.RefreshToken {
+			err = h.revokeRefreshToken(token, claims.UserID)
+		} else {
+			err = h.revokeAccessToken(token)
+		}
+		// The client has to assume the token is still valid and retry (RFC 7009, section 2.2.1)
+		if revocationFailed(c, err) {
+			return
+		}
+
+		var userID *uint
+		if !claims.IsClient() {
+			userID = &claims.UserID
+		}
+		h.SecurityLogger.LogTokenRevoked(userID, string(tokenType), c.ClientIP(), c.GetHeader("User-Agent"))
+		break
+	}
+
+	// Invalid, expired and already revoked tokens get the same answer (RFC 7009, section 2.2)
+	c.Status(http.StatusOK)
+}
+
+// revokeAccessToken blacklists a valid access token for the rest of its lifetime. Opaque
+// tokens are revoked in their store as well.
+func (h *AuthHandler) revokeAccessToken(accessToken string) error {
+	claims, err := utils.ValidateToken(accessToken, utils.AccessToken)
+	if err != nil {
+		return nil
+	}
+
+	// Calculate remaining token lifetime for proper TTL
+	ttl := 15 * time.Minute // Default TTL
+	if claims.ExpiresAt != nil {
+		if remaining := time.Until(claims.ExpiresAt.Time); remaining > 0 {
+			ttl = remaining
+		}
+	}
+	if err := h.Store.BlacklistToken(accessToken, ttl); err != nil {
+		return revocationNotStored(err)
+	}
+	return utils.RevokeReferenceToken(accessToken)
+}
+
+// revokeRefreshToken ends the session a valid refresh token of the user belongs to, removing
+// its whole family and the access tokens issued for it, and blacklists the token
+func (h *AuthHandler) revokeRefreshToken(refreshToken string, userID uint) error {
+	if _, err := utils.ValidateToken(refreshToken, utils.RefreshToken); err != nil {
+		return nil
+	}
+
+	if err := h.Store.BlacklistToken(refreshToken, 7*24*time.Hour); err != nil {
+		return revocationNotStored(err)
+	}
+
+	var refreshTokenRecord models.RefreshToken
+	if err := h.DB.Where("token_hash = ? AND user_id = ?", utils.HashToken(refreshToken), userID).First(&refreshTokenRecord).Error; err != nil {
+		return nil
+	}
+
+	var family []models.RefreshToken
+	if err := h.DB.Where("family_id = ?", refreshTokenRecord.FamilyID).Find(&family).Error; err != nil {
+		return err
+	}
+	return h.revokeSessions(userID, family)
+}
+
 func (h *AuthHandler) VerifyEmail(c *gin.Context) {
 	token := c.Query("token")
 	if token == "" {
@@ -372,7 +625,7 @@ func (h *AuthHandler) VerifyEmail(c *gin.Context) {
 	}
 
 	var verificationToken models.EmailVerificationToken
-	if err := h.DB.Where("token = ? AND expires_at > ? AND used = ?", token, time.Now(), false).First(&verificationToken).Error; err != nil {
+	if err := h.DB.Where("token_hash = ? AND expires_at > ? AND used = ?", utils.HashToken(token), time.Now(), false).First(&verificationToken).Error; err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired token"})
 		return
 	}
@@ -428,7 +681,7 @@ func (h *AuthHandler) ForgotPassword(c *gin.Context) {
 	// Store password reset token
 	resetTokenRecord := models.PasswordResetToken{
 		UserID:    user.ID,
-		Token:     resetToken,
+		TokenHash: utils.HashToken(resetToken),
 		ExpiresAt: time.Now().Add(1 * time.Hour), // 1 hour expiry
 	}
 
@@ -486,7 +739,7 @@ func (h *AuthHandler) ResetPassword(c *gin.Context) {
 	}
 
 	var resetToken models.PasswordResetToken
-	if err := h.DB.Where("token = ? AND expires_at > ? AND used = ?", input.Token, time.Now(), false).First(&resetToken).Error; err != nil {
+	if err := h.DB.Where("token_hash = ? AND expires_at > ? AND used = ?", utils.HashToken(input.Token), time.Now(), false).First(&resetToken).Error; err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired token"})
 		return
 	}
@@ -515,6 +768,13 @@ func (h *AuthHandler) ResetPassword(c *gin.Context) {
 		return
 	}
 
+	// Whoever knew the old password may still hold tokens, so every session ends here
+	if err := models.RevokeUserTokens(h.DB, user.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not revoke existing sessions"})
+		return
+	}
+	h.SecurityLogger.LogAllTokensRevoked(user.ID, "password reset", c.ClientIP(), c.GetHeader("User-Agent"))
+
 	c.JSON(http.StatusOK, gin.H{"message": "Password reset successfully"})
 }
 
@@ -538,10 +798,16 @@ func (h *AuthHandler) Me(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"id":         user.ID,
-		"email":      user.Email,
-		"first_name": user.FirstName,
-		"last_name":  user.LastName,
+	var recoveryCodesRemaining int64
+	if user.MFAEnabled {
+		h.DB.Model(&models.MFARecoveryCode{}).Where("user_id = ? AND used_at IS NULL", user.ID).Count(&recoveryCodesRemaining)
+	}
+
+	c.JSON(http.StatusOK, struct {
+		models.SelfUser
+		RecoveryCodesRemaining int64 `json:"recovery_codes_remaining"`
+	}{
+		SelfUser:               user.SelfView(),
+		RecoveryCodesRemaining: recoveryCodesRemaining,
 	})
 }
@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+
+	"go-auth-system/src/config"
+	"go-auth-system/src/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// HealthHandler reports whether the service and the token store it depends on are usable
+type HealthHandler struct {
+	Store services.TokenStore
+}
+
+func NewHealthHandler(store services.TokenStore) *HealthHandler {
+	return &HealthHandler{Store: store}
+}
+
+// Health answers 200 while the service can serve requests. A token store outage only degrades
+// it, so the status says "degraded" and shows how requests are being treated meanwhile. The
+// endpoint is public, so the store's error only goes to the log.
+func (h *HealthHandler) Health(c *gin.Context) {
+	response := gin.H{"status": "healthy"}
+
+	if reporter, ok := h.Store.(services.StoreHealthReporter); ok {
+		store := reporter.Health()
+		response["token_store"] = store
+		if store.Degraded() {
+			log.Printf("[warning] token store degraded, %d consecutive failures: %s", store.ConsecutiveFailures, store.LastError)
+			failure := config.GetStoreFailure()
+			response["status"] = "degraded"
+			response["failure_policy"] = gin.H{
+				"rate_limit": policyName(failure.RateLimitFailsOpen()),
+				"revocation": policyName(failure.RevocationFailsOpen()),
+			}
+		}
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+func policyName(failsOpen bool) string {
+	if failsOpen {
+		return config.FailOpen
+	}
+	return config.FailClosed
+}
@@ -0,0 +1,291 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"go-auth-system/src/models"
+	"go-auth-system/src/utils"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	mfaIssuer         = "go-auth-system"
+	recoveryCodeCount = 10
+)
+
+// EnrollMFA generates a new TOTP secret for the authenticated user. The factor stays
+// inactive until the user proves possession of it through ConfirmMFA.
+func (h *AuthHandler) EnrollMFA(c *gin.Context) {
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+
+	if user.MFAEnabled {
+		c.JSON(http.StatusConflict, gin.H{"error": "MFA is already enabled"})
+		return
+	}
+
+	secret, err := utils.GenerateTOTPSecret()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not generate MFA secret"})
+		return
+	}
+
+	user.MFASecret = secret
+	if err := h.DB.Save(user).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not store MFA secret"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"secret":      secret,
+		"otpauth_uri": utils.TOTPProvisioningURI(secret, user.Email, mfaIssuer),
+	})
+}
+
+// ConfirmMFA activates a pending TOTP enrollment once the user submits a valid code
+func (h *AuthHandler) ConfirmMFA(c *gin.Context) {
+	var input struct {
+		Code string `json:"code" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+
+	if user.MFAEnabled {
+		c.JSON(http.StatusConflict, gin.H{"error": "MFA is already enabled"})
+		return
+	}
+
+	if user.MFASecret == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No pending MFA enrollment"})
+		return
+	}
+
+	if !h.acceptTOTPCode(user, input.Code) {
+		h.SecurityLogger.LogMFAEvent("mfa_enrollment", user.ID, c.ClientIP(), c.GetHeader("User-Agent"), false)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid verification code"})
+		return
+	}
+
+	now := time.Now()
+	user.MFAEnabled = true
+	user.MFAEnabledAt = &now
+	if err := h.DB.Save(user).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not enable MFA"})
+		return
+	}
+
+	recoveryCodes, err := h.replaceRecoveryCodes(user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not generate recovery codes"})
+		return
+	}
+
+	h.SecurityLogger.LogMFAEvent("mfa_enrollment", user.ID, c.ClientIP(), c.GetHeader("User-Agent"), true)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":        "MFA enabled successfully",
+		"recovery_codes": recoveryCodes, // Shown once, only the hashes are stored
+	})
+}
+
+// RegenerateRecoveryCodes replaces the user's recovery codes, invalidating the previous set
+func (h *AuthHandler) RegenerateRecoveryCodes(c *gin.Context) {
+	var input struct {
+		Code string `json:"code" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+
+	if !user.MFAEnabled {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "MFA is not enabled"})
+		return
+	}
+
+	if !h.acceptTOTPCode(user, input.Code) {
+		h.SecurityLogger.LogMFAEvent("mfa_recovery_codes_regenerated", user.ID, c.ClientIP(), c.GetHeader("User-Agent"), false)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid verification code"})
+		return
+	}
+
+	recoveryCodes, err := h.replaceRecoveryCodes(user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not generate recovery codes"})
+		return
+	}
+
+	h.SecurityLogger.LogMFAEvent("mfa_recovery_codes_regenerated", user.ID, c.ClientIP(), c.GetHeader("User-Agent"), true)
+
+	c.JSON(http.StatusOK, gin.H{"recovery_codes": recoveryCodes})
+}
+
+// VerifyMFA exchanges an mfa_pending challenge and either a TOTP code or a recovery code
+// for an access/refresh token pair
+func (h *AuthHandler) VerifyMFA(c *gin.Context) {
+	var input struct {
+		MFAToken     string `json:"mfa_token" binding:"required"`
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+
+	if (input.Code == "") == (input.RecoveryCode == "") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Provide either a code or a recovery_code"})
+		return
+	}
+
+	claims, err := utils.ValidateToken(input.MFAToken, utils.MFAPendingToken)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired MFA token"})
+		return
+	}
+
+	var user models.User
+	if err := h.DB.First(&user, claims.UserID).Error; err != nil || !user.MFAEnabled {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired MFA token"})
+		return
+	}
+
+	if user.IsAccountLocked() {
+		h.SecurityLogger.LogAccountLockout(user.Email, c.ClientIP(), c.GetHeader("User-Agent"))
+		c.JSON(http.StatusLocked, gin.H{"error": "Account is temporarily locked due to too many failed login attempts"})
+		return
+	}
+
+	eventType := "mfa_verification"
+	var verified bool
+	if input.RecoveryCode != "" {
+		eventType = "mfa_recovery_code_used"
+		verified = h.consumeRecoveryCode(user.ID, input.RecoveryCode)
+	} else {
+		verified = h.acceptTOTPCode(&user, input.Code)
+	}
+
+	if !verified {
+		// Failed codes count towards the regular lockout to stop brute forcing the 6 digits
+		user.IncrementFailedLogin()
+		h.DB.Save(&user)
+		h.SecurityLogger.LogMFAEvent(eventType, user.ID, c.ClientIP(), c.GetHeader("User-Agent"), false)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid verification code"})
+		return
+	}
+
+	h.SecurityLogger.LogMFAEvent(eventType, user.ID, c.ClientIP(), c.GetHeader("User-Agent"), true)
+
+	h.completeLogin(c, &user)
+}
+
+// acceptTOTPCode validates a TOTP code and claims its time step, so each code works only once
+// even though it stays valid for the whole skew window
+func (h *AuthHandler) acceptTOTPCode(user *models.User, code string) bool {
+	step, ok := utils.ValidateTOTPCode(user.MFASecret, code)
+	if !ok {
+		return false
+	}
+	claimed, err := user.ClaimTOTPStep(h.DB, step)
+	return err == nil && claimed
+}
+
+// replaceRecoveryCodes generates a new set of recovery codes for the user, storing only their hashes
+// and deleting any previous set
+func (h *AuthHandler) replaceRecoveryCodes(userID uint) ([]string, error) {
+	codes := make([]string, 0, recoveryCodeCount)
+	records := make([]models.MFARecoveryCode, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		code, err := utils.GenerateRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		hash, err := utils.HashPassword(code)
+		if err != nil {
+			return nil, err
+		}
+		codes = append(codes, code)
+		records = append(records, models.MFARecoveryCode{UserID: userID, CodeHash: hash})
+	}
+
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&models.MFARecoveryCode{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&records).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+// consumeRecoveryCode marks the matching unused recovery code as used, reporting whether one was found
+func (h *AuthHandler) consumeRecoveryCode(userID uint, code string) bool {
+	code = strings.ToLower(strings.TrimSpace(code))
+
+	var records []models.MFARecoveryCode
+	if err := h.DB.Where("user_id = ? AND used_at IS NULL", userID).Find(&records).Error; err != nil {
+		return false
+	}
+
+	for _, record := range records {
+		if !utils.CheckPasswordHash(code, record.CodeHash) {
+			continue
+		}
+
+		// Guard against the same code being redeemed concurrently
+		result := h.DB.Model(&models.MFARecoveryCode{}).
+			Where("id = ? AND used_at IS NULL", record.ID).
+			Update("used_at", time.Now())
+		return result.Error == nil && result.RowsAffected == 1
+	}
+
+	return false
+}
+
+// currentUser loads the authenticated user from the userID set by AuthMiddleware,
+// writing the error response itself when that is not possible
+func (h *AuthHandler) currentUser(c *gin.Context) (*models.User, bool) {
+	userIDVal, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return nil, false
+	}
+
+	userID, ok := userIDVal.(uint)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user context"})
+		return nil, false
+	}
+
+	var user models.User
+	if err := h.DB.First(&user, userID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return nil, false
+	}
+
+	return &user, true
+}
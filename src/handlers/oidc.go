@@ -0,0 +1,473 @@
+package handlers
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-auth-system/src/config"
+	"go-auth-system/src/models"
+	"go-auth-system/src/services"
+	"go-auth-system/src/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
+)
+
+const authorizationCodeTTL = 5 * time.Minute
+
+// OIDCHandler implements the OpenID Connect provider endpoints on top of the regular token issuer
+type OIDCHandler struct {
+	DB             *gorm.DB
+	Store          services.TokenStore
+	SecurityLogger *utils.SecurityLogger
+}
+
+// NewOIDCHandler creates the handler. The store is the one holding the token blacklist and
+// revoked sessions, which introspection has to honour.
+func NewOIDCHandler(db *gorm.DB, store services.TokenStore) *OIDCHandler {
+	return &OIDCHandler{
+		DB:             db,
+		Store:          store,
+		SecurityLogger: utils.NewSecurityLogger(),
+	}
+}
+
+// Authorize handles the authorization code request. It runs behind AuthMiddleware, so the user is
+// already logged in; registered clients are first-party apps and no consent screen is shown.
+// Browsers are redirected here without an Authorization header, so they are authenticated by
+// the access token cookie of a cookie session (TOKEN_DELIVERY=cookie). There is no login page to
+// redirect to: without a session the request gets 401, and the client has to have the user log
+// in first.
+func (h *OIDCHandler) Authorize(c *gin.Context) {
+	userID := c.GetUint("userID")
+
+	var client models.OAuthClient
+	if err := h.DB.Where("client_id = ?", c.Query("client_id")).First(&client).Error; err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_client", "error_description": "Unknown client"})
+		return
+	}
+
+	// Never redirect to a URI that has not been registered for the client
+	redirectURI := c.Query("redirect_uri")
+	if !client.AllowsRedirectURI(redirectURI) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_request", "error_description": "Unregistered redirect_uri"})
+		return
+	}
+
+	state := c.Query("state")
+	redirectError := func(code, description string) {
+		params := url.Values{}
+		params.Set("error", code)
+		params.Set("error_description", description)
+		if state != "" {
+			params.Set("state", state)
+		}
+		c.Redirect(http.StatusFound, appendQuery(redirectURI, params))
+	}
+
+	if c.Query("response_type") != "code" {
+		redirectError("unsupported_response_type", "Only the authorization code flow is supported")
+		return
+	}
+	if !client.AllowsGrantType("authorization_code") {
+		redirectError("unauthorized_client", "The client is not registered for the authorization code grant")
+		return
+	}
+
+	scopes := strings.Fields(c.Query("scope"))
+	if !containsScope(scopes, "openid") {
+		redirectError("invalid_scope", "The openid scope is required")
+		return
+	}
+	if !client.AllowsScopes(scopes) {
+		redirectError("invalid_scope", "The client is not allowed to request these scopes")
+		return
+	}
+
+	// PKCE is mandatory for every client, confidential or not
+	codeChallenge := c.Query("code_challenge")
+	if codeChallenge == "" || c.Query("code_challenge_method") != "S256" {
+		redirectError("invalid_request", "A S256 code_challenge is required")
+		return
+	}
+
+	var user models.User
+	if err := h.DB.First(&user, userID).Error; err != nil {
+		redirectError("access_denied", "User not found")
+		return
+	}
+
+	code, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		redirectError("server_error", "Could not generate authorization code")
+		return
+	}
+
+	authorizationCode := models.OAuthAuthorizationCode{
+		CodeHash:            utils.HashToken(code),
+		ClientID:            client.ClientID,
+		UserID:              user.ID,
+		RedirectURI:         redirectURI,
+		Scope:               strings.Join(scopes, " "),
+		Nonce:               c.Query("nonce"),
+		CodeChallenge:       codeChallenge,
+		CodeChallengeMethod: "S256",
+		AuthTime:            user.LastLoginAt,
+		ExpiresAt:           time.Now().Add(authorizationCodeTTL),
+	}
+
+	if err := h.DB.Create(&authorizationCode).Error; err != nil {
+		redirectError("server_error", "Could not store authorization code")
+		return
+	}
+
+	params := url.Values{}
+	params.Set("code", code)
+	if state != "" {
+		params.Set("state", state)
+	}
+	c.Redirect(http.StatusFound, appendQuery(redirectURI, params))
+}
+
+// Token is the OAuth 2.0 token endpoint
+func (h *OIDCHandler) Token(c *gin.Context) {
+	// Token responses must never be cached (RFC 6749 section 5.1)
+	c.Header("Cache-Control", "no-store")
+	c.Header("Pragma", "no-cache")
+
+	switch c.PostForm("grant_type") {
+	case "authorization_code":
+		h.authorizationCodeGrant(c)
+	case "client_credentials":
+		h.clientCredentialsGrant(c)
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "unsupported_grant_type"})
+	}
+}
+
+func (h *OIDCHandler) authorizationCodeGrant(c *gin.Context) {
+	client, ok := h.authenticateClient(c)
+	if !ok {
+		return
+	}
+
+	var authorizationCode models.OAuthAuthorizationCode
+	if err := h.DB.Where("code_hash = ? AND client_id = ?", utils.HashToken(c.PostForm("code")), client.ClientID).First(&authorizationCode).Error; err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_grant", "error_description": "Invalid authorization code"})
+		return
+	}
+
+	if authorizationCode.Used || time.Now().After(authorizationCode.ExpiresAt) {
+		h.SecurityLogger.LogSuspiciousActivity("authorization_code_replay", c.ClientIP(), c.GetHeader("User-Agent"),
+			"Expired or already used authorization code presented by client "+client.ClientID)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_grant", "error_description": "Invalid authorization code"})
+		return
+	}
+
+	if authorizationCode.RedirectURI != c.PostForm("redirect_uri") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_grant", "error_description": "redirect_uri does not match"})
+		return
+	}
+
+	if !utils.VerifyPKCE(c.PostForm("code_verifier"), authorizationCode.CodeChallenge) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_grant", "error_description": "Invalid code_verifier"})
+		return
+	}
+
+	// Codes are single use; the conditional update wins exactly once under concurrency
+	result := h.DB.Model(&models.OAuthAuthorizationCode{}).
+		Where("id = ? AND used = ?", authorizationCode.ID, false).
+		Update("used", true)
+	if result.Error != nil || result.RowsAffected != 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_grant", "error_description": "Invalid authorization code"})
+		return
+	}
+
+	var user models.User
+	if err := h.DB.First(&user, authorizationCode.UserID).Error; err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_grant", "error_description": "User no longer exists"})
+		return
+	}
+
+	accessToken, err := utils.GenerateAccessTokenWithOptions(user.ID, utils.AccessTokenOptions{
+		Scope:    authorizationCode.Scope,
+		Audience: []string{client.ClientID},
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+		return
+	}
+
+	scopes := strings.Fields(authorizationCode.Scope)
+	idClaims := &utils.IDTokenClaims{
+		Nonce: authorizationCode.Nonce,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:  strconv.FormatUint(uint64(user.ID), 10),
+			Audience: jwt.ClaimStrings{client.ClientID},
+		},
+	}
+	if authorizationCode.AuthTime != nil {
+		idClaims.AuthTime = jwt.NewNumericDate(*authorizationCode.AuthTime)
+	}
+	applyUserClaims(idClaims, &user, scopes)
+
+	idToken, err := utils.GenerateIDToken(idClaims)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"access_token": accessToken,
+		"id_token":     idToken,
+		"token_type":   "Bearer",
+		"expires_in":   int(utils.AccessTokenTTL.Seconds()),
+		"scope":        authorizationCode.Scope,
+	})
+}
+
+// clientCredentialsGrant issues a machine token to a confidential client acting on its own behalf (RFC 6749 section 4.4)
+func (h *OIDCHandler) clientCredentialsGrant(c *gin.Context) {
+	client, ok := h.authenticateClient(c)
+	if !ok {
+		return
+	}
+
+	if client.IsPublic || !client.AllowsGrantType("client_credentials") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "unauthorized_client"})
+		return
+	}
+
+	// Without an explicit scope the client receives everything it has been granted
+	scopes := strings.Fields(c.PostForm("scope"))
+	if len(scopes) == 0 {
+		scopes = strings.Fields(client.AllowedScopes)
+	}
+	if !client.AllowsScopes(scopes) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_scope"})
+		return
+	}
+	scope := strings.Join(scopes, " ")
+
+	accessToken, err := utils.GenerateClientAccessToken(client.ClientID, scope)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"access_token": accessToken,
+		"token_type":   "Bearer",
+		"expires_in":   int(utils.AccessTokenTTL.Seconds()),
+		"scope":        scope,
+	})
+}
+
+// UserInfo returns the claims about the authenticated user allowed by the access token's scope.
+// It runs behind RequireScope("openid"), so only tokens issued to OAuth clients get here.
+func (h *OIDCHandler) UserInfo(c *gin.Context) {
+	// Machine tokens can hold the openid scope too, but have no user to describe
+	if _, exists := c.Get("userID"); !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid_token"})
+		return
+	}
+
+	var user models.User
+	if err := h.DB.First(&user, c.GetUint("userID")).Error; err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid_token"})
+		return
+	}
+
+	scopes := strings.Fields(c.GetString("scope"))
+	if !containsScope(scopes, "openid") {
+		c.JSON(http.StatusForbidden, gin.H{"error": "insufficient_scope"})
+		return
+	}
+
+	claims := &utils.IDTokenClaims{
+		RegisteredClaims: jwt.RegisteredClaims{Subject: strconv.FormatUint(uint64(user.ID), 10)},
+	}
+	applyUserClaims(claims, &user, scopes)
+
+	response := gin.H{"sub": claims.Subject}
+	if containsScope(scopes, "email") {
+		response["email"] = claims.Email
+		response["email_verified"] = claims.EmailVerified
+	}
+	if containsScope(scopes, "profile") {
+		response["name"] = claims.Name
+		response["given_name"] = claims.GivenName
+		response["family_name"] = claims.FamilyName
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// Introspect is the OAuth 2.0 token introspection endpoint (RFC 7662). Resource servers
+// authenticate as confidential clients and learn whether a token is active and what it grants,
+// which is the only way to read an opaque access token.
+func (h *OIDCHandler) Introspect(c *gin.Context) {
+	c.Header("Cache-Control", "no-store")
+	c.Header("Pragma", "no-cache")
+
+	client, ok := h.authenticateClient(c)
+	if !ok {
+		return
+	}
+	if client.IsPublic {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid_client", "error_description": "Public clients cannot introspect tokens"})
+		return
+	}
+
+	token := c.PostForm("token")
+	if token == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_request", "error_description": "token is required"})
+		return
+	}
+
+	// The hint only decides which kind of token is tried first
+	introspectors := []func(string) gin.H{h.introspectAccessToken, h.introspectRefreshToken}
+	if c.PostForm("token_type_hint") == "refresh_token" {
+		introspectors[0], introspectors[1] = introspectors[1], introspectors[0]
+	}
+	for _, introspect := range introspectors {
+		if response := introspect(token); response != nil {
+			c.JSON(http.StatusOK, response)
+			return
+		}
+	}
+
+	// Anything unknown, expired or revoked is simply inactive, with no further detail
+	c.JSON(http.StatusOK, gin.H{"active": false})
+}
+
+func (h *OIDCHandler) introspectAccessToken(token string) gin.H {
+	claims, err := utils.ValidateToken(token, utils.AccessToken)
+	if err != nil || utils.IssuedBeforeWatermark(claims) {
+		return nil
+	}
+
+	// Reference tokens are checked against their store by ValidateToken; JWTs need the blacklist.
+	// A token whose revocation status cannot be checked is inactive unless revocation fails open.
+	failsOpen := config.GetStoreFailure().RevocationFailsOpen()
+	if !utils.IsReferenceToken(token) {
+		if blacklisted, err := h.Store.IsTokenBlacklisted(token); blacklisted || (err != nil && !failsOpen) {
+			return nil
+		}
+	}
+	if claims.SessionID != "" {
+		if revoked, err := h.Store.IsSessionRevoked(claims.SessionID); revoked || (err != nil && !failsOpen) {
+			return nil
+		}
+	}
+
+	response := introspectionResponse(claims)
+	response["token_type"] = "Bearer"
+	return response
+}
+
+func (h *OIDCHandler) introspectRefreshToken(token string) gin.H {
+	claims, err := utils.ValidateToken(token, utils.RefreshToken)
+	if err != nil || utils.IssuedBeforeWatermark(claims) {
+		return nil
+	}
+
+	var refreshToken models.RefreshToken
+	if err := h.DB.Where("token_hash = ? AND rotated_at IS NULL AND expires_at > ?", utils.HashToken(token), time.Now()).
+		First(&refreshToken).Error; err != nil {
+		return nil
+	}
+
+	response := introspectionResponse(claims)
+	response["token_type"] = "refresh_token"
+	return response
+}
+
+// introspectionResponse lists the members of RFC 7662 section 2.2 that the claims provide
+func introspectionResponse(claims *utils.Claims) gin.H {
+	response := gin.H{"active": true, "iss": claims.Issuer}
+	if claims.IsClient() {
+		response["sub"] = claims.ClientID
+		response["client_id"] = claims.ClientID
+	} else {
+		response["sub"] = strconv.FormatUint(uint64(claims.UserID), 10)
+	}
+	if claims.Scope != "" {
+		response["scope"] = claims.Scope
+	}
+	if len(claims.Audience) > 0 {
+		response["aud"] = []string(claims.Audience)
+	}
+	if claims.ExpiresAt != nil {
+		response["exp"] = claims.ExpiresAt.Unix()
+	}
+	if claims.IssuedAt != nil {
+		response["iat"] = claims.IssuedAt.Unix()
+	}
+	if claims.NotBefore != nil {
+		response["nbf"] = claims.NotBefore.Unix()
+	}
+	if claims.ID != "" {
+		response["jti"] = claims.ID
+	}
+	return response
+}
+
+// authenticateClient resolves the calling client from HTTP Basic or form credentials (RFC 6749 section 2.3)
+func (h *OIDCHandler) authenticateClient(c *gin.Context) (*models.OAuthClient, bool) {
+	clientID, clientSecret, hasBasic := c.Request.BasicAuth()
+	if !hasBasic {
+		clientID = c.PostForm("client_id")
+		clientSecret = c.PostForm("client_secret")
+	}
+
+	var client models.OAuthClient
+	if clientID == "" || h.DB.Where("client_id = ?", clientID).First(&client).Error != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid_client"})
+		return nil, false
+	}
+
+	if !client.IsPublic && !client.CheckSecret(clientSecret) {
+		h.SecurityLogger.LogSuspiciousActivity("oauth_client_authentication_failed", c.ClientIP(), c.GetHeader("User-Agent"),
+			"Invalid secret for client "+clientID)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid_client"})
+		return nil, false
+	}
+
+	return &client, true
+}
+
+// applyUserClaims copies the profile claims permitted by scopes onto claims
+func applyUserClaims(claims *utils.IDTokenClaims, user *models.User, scopes []string) {
+	if containsScope(scopes, "email") {
+		verified := user.IsEmailVerified
+		claims.Email = user.Email
+		claims.EmailVerified = &verified
+	}
+	if containsScope(scopes, "profile") {
+		claims.GivenName = user.FirstName
+		claims.FamilyName = user.LastName
+		claims.Name = strings.TrimSpace(user.FirstName + " " + user.LastName)
+	}
+}
+
+func containsScope(scopes []string, scope string) bool {
+	for _, s := range scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+func appendQuery(rawURL string, params url.Values) string {
+	separator := "?"
+	if strings.Contains(rawURL, "?") {
+		separator = "&"
+	}
+	return rawURL + separator + params.Encode()
+}
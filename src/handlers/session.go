@@ -0,0 +1,157 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"go-auth-system/src/models"
+	"go-auth-system/src/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxUserAgentLength matches the user_agent column of refresh_tokens
+const maxUserAgentLength = 512
+
+// ListSessions returns the devices the user is logged in on, newest activity first
+func (h *AuthHandler) ListSessions(c *gin.Context) {
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+
+	var refreshTokens []models.RefreshToken
+	if err := h.DB.Where("user_id = ? AND rotated_at IS NULL AND expires_at > ?", user.ID, time.Now()).
+		Order("last_used_at DESC").Find(&refreshTokens).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not load sessions"})
+		return
+	}
+
+	currentSessionID := c.GetString("sessionID")
+	sessions := make([]models.Session, 0, len(refreshTokens))
+	for i := range refreshTokens {
+		sessions = append(sessions, refreshTokens[i].SessionView(currentSessionID))
+	}
+
+	c.JSON(http.StatusOK, gin.H{"sessions": sessions})
+}
+
+// RevokeSession logs the user out on a single device
+func (h *AuthHandler) RevokeSession(c *gin.Context) {
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+
+	var refreshToken models.RefreshToken
+	if err := h.DB.Where("id = ? AND user_id = ? AND rotated_at IS NULL", c.Param("id"), user.ID).First(&refreshToken).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+		return
+	}
+
+	switch err := h.revokeSessions(user.ID, []models.RefreshToken{refreshToken}); {
+	case errors.Is(err, errRevocationNotStored):
+		revocationFailed(c, err)
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not revoke session"})
+		return
+	}
+
+	h.SecurityLogger.LogSessionRevoked(user.ID, 1, c.ClientIP(), c.GetHeader("User-Agent"))
+	c.JSON(http.StatusOK, gin.H{"message": "Session revoked"})
+}
+
+// RevokeOtherSessions logs the user out everywhere except the session making the request.
+// Tokens that do not belong to a session (such as OIDC client tokens) end every session.
+func (h *AuthHandler) RevokeOtherSessions(c *gin.Context) {
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+
+	query := h.DB.Where("user_id = ? AND rotated_at IS NULL", user.ID)
+	if currentSessionID := c.GetString("sessionID"); currentSessionID != "" {
+		query = query.Where("id <> ?", currentSessionID)
+	}
+
+	var refreshTokens []models.RefreshToken
+	if err := query.Find(&refreshTokens).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not load sessions"})
+		return
+	}
+
+	switch err := h.revokeSessions(user.ID, refreshTokens); {
+	case errors.Is(err, errRevocationNotStored):
+		revocationFailed(c, err)
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not revoke sessions"})
+		return
+	}
+
+	h.SecurityLogger.LogSessionRevoked(user.ID, len(refreshTokens), c.ClientIP(), c.GetHeader("User-Agent"))
+	c.JSON(http.StatusOK, gin.H{"message": "Other sessions revoked", "revoked": len(refreshTokens)})
+}
+
+// revokeSessions marks the sessions of the given refresh tokens as revoked, so access tokens
+// already issued for them are rejected by AuthMiddleware until they expire, and deletes their
+// token families. The markers are written first: if the store fails, the records are still
+// there for the caller to retry with.
+func (h *AuthHandler) revokeSessions(userID uint, refreshTokens []models.RefreshToken) error {
+	if len(refreshTokens) == 0 {
+		return nil
+	}
+
+	// The refresh tokens go with their records; only access tokens need the marker
+	var sessionIDs []string
+	for _, refreshToken := range refreshTokens {
+		if !refreshToken.IsRotated() {
+			if err := h.Store.RevokeSession(refreshToken.SessionID(), utils.AccessTokenTTL); err != nil {
+				return revocationNotStored(err)
+			}
+			sessionIDs = append(sessionIDs, refreshToken.SessionID())
+		}
+	}
+	if err := utils.RevokeReferenceTokenSessions(sessionIDs); err != nil {
+		return err
+	}
+
+	familyIDs := make([]string, 0, len(refreshTokens))
+	for _, refreshToken := range refreshTokens {
+		familyIDs = append(familyIDs, refreshToken.FamilyID)
+	}
+	return h.DB.Where("user_id = ? AND family_id IN ?", userID, familyIDs).Delete(&models.RefreshToken{}).Error
+}
+
+// revokeReusedTokenFamily handles a rotated refresh token being presented again. Either the
+// legitimate client or an attacker holds a stolen copy and there is no telling which, so the
+// whole family is revoked and both have to log in again (OAuth 2.0 Security BCP, section 4.14).
+func (h *AuthHandler) revokeReusedTokenFamily(c *gin.Context, reused *models.RefreshToken) {
+	var family []models.RefreshToken
+	h.DB.Where("family_id = ? AND rotated_at IS NULL", reused.FamilyID).Find(&family)
+	family = append(family, *reused)
+
+	switch err := h.revokeSessions(reused.UserID, family); {
+	case errors.Is(err, errRevocationNotStored):
+		// The family is still there, so replaying the token again retries the revocation
+		revocationFailed(c, err)
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not revoke refresh token"})
+		return
+	}
+
+	h.SecurityLogger.LogRefreshTokenReuse(reused.UserID, reused.FamilyID, c.ClientIP(), c.GetHeader("User-Agent"))
+	c.JSON(http.StatusUnauthorized, gin.H{"error": "Refresh token has been revoked"})
+}
+
+// deviceUserAgent returns the caller's User-Agent, cut down to fit the refresh_tokens table
+func deviceUserAgent(c *gin.Context) string {
+	userAgent := c.GetHeader("User-Agent")
+	if len(userAgent) > maxUserAgentLength {
+		userAgent = userAgent[:maxUserAgentLength]
+	}
+	return userAgent
+}
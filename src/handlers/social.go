@@ -0,0 +1,308 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"go-auth-system/src/models"
+	"go-auth-system/src/services"
+	"go-auth-system/src/utils"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	socialStateTTL    = 10 * time.Minute
+	socialStateCookie = "oauth_state"
+)
+
+// SocialAuthHandler signs users in through external identity providers. Successful logins go
+// through the same session start as password logins, so lockout and MFA still apply.
+type SocialAuthHandler struct {
+	Auth      *AuthHandler
+	Providers *services.ProviderRegistry
+	States    services.SocialStateStore
+}
+
+func NewSocialAuthHandler(auth *AuthHandler, providers *services.ProviderRegistry, states services.SocialStateStore) *SocialAuthHandler {
+	return &SocialAuthHandler{
+		Auth:      auth,
+		Providers: providers,
+		States:    states,
+	}
+}
+
+// ListProviders returns the names of the providers users can sign in with
+func (h *SocialAuthHandler) ListProviders(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"providers": h.Providers.Names()})
+}
+
+// Login redirects the browser to the provider's authorization endpoint
+func (h *SocialAuthHandler) Login(c *gin.Context) {
+	authorizationURL, ok := h.begin(c, 0)
+	if !ok {
+		return
+	}
+	c.Redirect(http.StatusFound, authorizationURL)
+}
+
+// Link starts the same flow for a logged-in user; the identity is attached to their account
+// on callback instead of logging in. The URL is returned rather than redirected to, because
+// this call is made with a bearer token from script.
+func (h *SocialAuthHandler) Link(c *gin.Context) {
+	authorizationURL, ok := h.begin(c, c.GetUint("userID"))
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"authorization_url": authorizationURL})
+}
+
+// Callback completes the flow: the state is checked against the browser cookie and consumed,
+// the code is exchanged, and the external identity is resolved to a local user
+func (h *SocialAuthHandler) Callback(c *gin.Context) {
+	provider, ok := h.Providers.Get(c.Param("provider"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Unknown identity provider"})
+		return
+	}
+
+	if c.Query("error") != "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Sign in was cancelled or denied by the identity provider"})
+		return
+	}
+
+	// The state must come back to the browser that started the flow (login CSRF protection)
+	state := c.Query("state")
+	cookieState, _ := c.Cookie(socialStateCookie)
+	c.SetCookie(socialStateCookie, "", -1, "/auth/oauth", "", false, true)
+	if state == "" || subtle.ConstantTimeCompare([]byte(state), []byte(cookieState)) != 1 {
+		h.Auth.SecurityLogger.LogSuspiciousActivity("social_login_state_mismatch", c.ClientIP(), c.GetHeader("User-Agent"),
+			"OAuth state does not match the browser cookie for provider "+provider.Name())
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired state"})
+		return
+	}
+
+	pending, err := h.States.Consume(state)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not load login state"})
+		return
+	}
+	if pending == nil || pending.Provider != provider.Name() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired state"})
+		return
+	}
+
+	identity, err := provider.Exchange(c.Request.Context(), c.Query("code"), pending.CodeVerifier, pending.Nonce)
+	if err != nil {
+		h.Auth.SecurityLogger.LogSuspiciousActivity("social_login_failed", c.ClientIP(), c.GetHeader("User-Agent"),
+			"Identity provider "+provider.Name()+": "+err.Error())
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Could not verify identity with the provider"})
+		return
+	}
+
+	if pending.LinkUserID != 0 {
+		h.linkIdentity(c, pending.LinkUserID, identity)
+		return
+	}
+
+	user, status, message := h.resolveUser(identity)
+	if user == nil {
+		c.JSON(status, gin.H{"error": message})
+		return
+	}
+
+	if user.IsAccountLocked() {
+		h.Auth.SecurityLogger.LogAccountLockout(user.Email, c.ClientIP(), c.GetHeader("User-Agent"))
+		c.JSON(http.StatusLocked, gin.H{"error": "Account is temporarily locked due to too many failed login attempts"})
+		return
+	}
+
+	h.Auth.startSession(c, user)
+}
+
+// ListIdentities returns the external identities linked to the authenticated user
+func (h *SocialAuthHandler) ListIdentities(c *gin.Context) {
+	var identities []models.LinkedIdentity
+	if err := h.Auth.DB.Where("user_id = ?", c.GetUint("userID")).Order("created_at").Find(&identities).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not load identities"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"identities": identities})
+}
+
+// UnlinkIdentity removes a linked identity, unless it is the user's only way to sign in
+func (h *SocialAuthHandler) UnlinkIdentity(c *gin.Context) {
+	userID := c.GetUint("userID")
+
+	var identity models.LinkedIdentity
+	if err := h.Auth.DB.Where("id = ? AND user_id = ?", c.Param("id"), userID).First(&identity).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Identity not found"})
+		return
+	}
+
+	var user models.User
+	if err := h.Auth.DB.First(&user, userID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	var linked int64
+	h.Auth.DB.Model(&models.LinkedIdentity{}).Where("user_id = ?", userID).Count(&linked)
+	if user.PasswordHash == "" && linked <= 1 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Set a password before removing your last linked identity"})
+		return
+	}
+
+	if err := h.Auth.DB.Delete(&identity).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not unlink identity"})
+		return
+	}
+
+	h.Auth.SecurityLogger.LogIdentityEvent("identity_unlinked", identity.Provider, userID, c.ClientIP(), c.GetHeader("User-Agent"))
+	c.JSON(http.StatusOK, gin.H{"message": "Identity unlinked"})
+}
+
+// begin stores fresh state, nonce and PKCE verifier and returns the provider authorization URL
+func (h *SocialAuthHandler) begin(c *gin.Context, linkUserID uint) (string, bool) {
+	provider, ok := h.Providers.Get(c.Param("provider"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Unknown identity provider"})
+		return "", false
+	}
+
+	state, errState := utils.GenerateRandomToken(32)
+	nonce, errNonce := utils.GenerateRandomToken(32)
+	verifier, errVerifier := utils.GenerateRandomToken(32)
+	if errState != nil || errNonce != nil || errVerifier != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not start sign in"})
+		return "", false
+	}
+
+	authorizationURL, err := provider.AuthCodeURL(c.Request.Context(), state, nonce, utils.PKCEChallenge(verifier))
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Identity provider is unavailable"})
+		return "", false
+	}
+
+	pending := services.SocialLoginState{
+		Provider:     provider.Name(),
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		LinkUserID:   linkUserID,
+	}
+	if err := h.States.Save(state, pending, socialStateTTL); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not start sign in"})
+		return "", false
+	}
+
+	c.SetCookie(socialStateCookie, state, int(socialStateTTL.Seconds()), "/auth/oauth", "", false, true)
+	return authorizationURL, true
+}
+
+// resolveUser finds the local user for an external identity, linking or creating the account
+// on first sign in. On failure it returns the HTTP status and message to respond with.
+func (h *SocialAuthHandler) resolveUser(identity *services.ExternalIdentity) (*models.User, int, string) {
+	db := h.Auth.DB
+	now := time.Now()
+
+	var linked models.LinkedIdentity
+	err := db.Where("provider = ? AND subject = ?", identity.Provider, identity.Subject).First(&linked).Error
+	if err == nil {
+		var user models.User
+		if err := db.First(&user, linked.UserID).Error; err != nil {
+			return nil, http.StatusUnauthorized, "User not found"
+		}
+		db.Model(&linked).Update("last_login_at", now)
+		return &user, 0, ""
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, http.StatusInternalServerError, "Could not look up identity"
+	}
+
+	// Accounts are only matched or created by email when the provider vouches for the address
+	if identity.Email == "" || !identity.EmailVerified {
+		return nil, http.StatusForbidden, "The identity provider did not supply a verified email address"
+	}
+	email, err := utils.ValidateEmail(identity.Email)
+	if err != nil {
+		return nil, http.StatusForbidden, err.Error()
+	}
+
+	var user models.User
+	err = db.Where("email = ?", email).First(&user).Error
+	if err == nil && !user.IsEmailVerified {
+		// Linking here would let whoever registered the unverified account keep access to it
+		return nil, http.StatusConflict, "An account with this email already exists; log in with your password and link the provider from your account"
+	}
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, http.StatusInternalServerError, "Could not look up user"
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if user.ID == 0 {
+			firstName, _ := utils.ValidateName(identity.GivenName)
+			lastName, _ := utils.ValidateName(identity.FamilyName)
+			user = models.User{
+				Email:           email,
+				FirstName:       firstName,
+				LastName:        lastName,
+				IsEmailVerified: true,
+				EmailVerifiedAt: &now,
+			}
+			if err := tx.Create(&user).Error; err != nil {
+				return err
+			}
+			if err := models.AssignRole(tx, user.ID, models.RoleUser); err != nil {
+				return err
+			}
+		}
+
+		return tx.Create(&models.LinkedIdentity{
+			UserID:      user.ID,
+			Provider:    identity.Provider,
+			Subject:     identity.Subject,
+			Email:       email,
+			LastLoginAt: &now,
+		}).Error
+	})
+	if err != nil {
+		return nil, http.StatusInternalServerError, "Could not create account"
+	}
+
+	return &user, 0, ""
+}
+
+// linkIdentity attaches an external identity to the user who started the link flow
+func (h *SocialAuthHandler) linkIdentity(c *gin.Context, userID uint, identity *services.ExternalIdentity) {
+	db := h.Auth.DB
+
+	var existing models.LinkedIdentity
+	if err := db.Where("provider = ? AND subject = ?", identity.Provider, identity.Subject).First(&existing).Error; err == nil {
+		if existing.UserID != userID {
+			h.Auth.SecurityLogger.LogSuspiciousActivity("social_link_conflict", c.ClientIP(), c.GetHeader("User-Agent"),
+				"Identity at "+identity.Provider+" is already linked to another user")
+			c.JSON(http.StatusConflict, gin.H{"error": "This identity is already linked to another account"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Identity already linked", "provider": identity.Provider})
+		return
+	}
+
+	linked := models.LinkedIdentity{
+		UserID:   userID,
+		Provider: identity.Provider,
+		Subject:  identity.Subject,
+		Email:    strings.ToLower(identity.Email),
+	}
+	if err := db.Create(&linked).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not link identity"})
+		return
+	}
+
+	h.Auth.SecurityLogger.LogIdentityEvent("identity_linked", identity.Provider, userID, c.ClientIP(), c.GetHeader("User-Agent"))
+	c.JSON(http.StatusOK, gin.H{"message": "Identity linked", "provider": identity.Provider})
+}
@@ -1,10 +1,12 @@
 package handlers
 
 import (
+	"go-auth-system/src/middleware"
 	"go-auth-system/src/models"
+	"go-auth-system/src/utils"
 	//"go-auth-system/src/storage"
 	"net/http"
-	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
@@ -19,30 +21,109 @@ func NewUserHandler(storage *gorm.DB) *UserHandler {
 }
 
 func (h *UserHandler) GetUser(c *gin.Context) {
-	userID := c.Param("id")
+	id, ok := userIDParam(c)
+	if !ok {
+		return
+	}
+
 	var user models.User
-	if err := h.storage.First(&user, userID).Error; err != nil {
+	if err := h.storage.First(&user, id).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
 		return
 	}
-	c.JSON(http.StatusOK, user)
+	c.JSON(http.StatusOK, user.View(visibilityFor(c, &user)))
+}
+
+// visibilityFor picks how much of a user record the caller may see: holders of users:read get
+// the admin view, users get their own account, and everyone else only the public profile
+func visibilityFor(c *gin.Context, user *models.User) models.UserVisibility {
+	if middleware.HasPermission(c, models.PermissionUsersRead) {
+		return models.VisibilityAdmin
+	}
+	if c.GetUint("userID") == user.ID {
+		return models.VisibilitySelf
+	}
+	return models.VisibilityPublic
 }
 
+// UpdateUser applies a partial profile update. Only the fields in models.UpdateProfileRequest
+// can change; when the client sends the updated_at it last saw, the write only goes through if
+// nobody has changed the profile since, otherwise it gets 409 and the current updated_at.
 func (h *UserHandler) UpdateUser(c *gin.Context) {
-	userID := c.Param("id")
-	var user models.User
-	if err := c.ShouldBindJSON(&user); err != nil {
+	id, ok := userIDParam(c)
+	if !ok {
+		return
+	}
+
+	var input models.UpdateProfileRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
 		return
 	}
-	val, _ := strconv.ParseUint(userID, 10, 64)
 
-	// Then cast to uint (platform-dependent size)
+	updates := map[string]interface{}{}
+	if input.FirstName != nil {
+		firstName, err := utils.ValidateName(*input.FirstName)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		updates["first_name"] = firstName
+	}
+	if input.LastName != nil {
+		lastName, err := utils.ValidateName(*input.LastName)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		updates["last_name"] = lastName
+	}
+	if len(updates) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No editable fields provided"})
+		return
+	}
 
-	user.ID = uint(val)
-	if err := h.storage.Save(&user).Error; err != nil {
+	var user models.User
+	if err := h.storage.First(&user, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	if input.UpdatedAt != nil && !input.UpdatedAt.Equal(user.UpdatedAt) {
+		h.respondConflict(c, user.UpdatedAt)
+		return
+	}
+
+	// Compare-and-set on updated_at so a write that lands between the read above and this
+	// update is not overwritten. Microsecond precision survives every database we run on.
+	updates["updated_at"] = time.Now().Truncate(time.Microsecond)
+	result := h.storage.Model(&models.User{}).
+		Where("id = ? AND updated_at = ?", user.ID, user.UpdatedAt).
+		Updates(updates)
+	if result.Error != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not update user"})
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"message": "User updated successfully"})
+	if result.RowsAffected == 0 {
+		h.storage.First(&user, user.ID)
+		h.respondConflict(c, user.UpdatedAt)
+		return
+	}
+
+	if err := h.storage.First(&user, user.ID).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not load user"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "User updated successfully",
+		"user":    user.View(visibilityFor(c, &user)),
+	})
+}
+
+func (h *UserHandler) respondConflict(c *gin.Context, updatedAt time.Time) {
+	c.JSON(http.StatusConflict, gin.H{
+		"error":      "Profile was modified by another request",
+		"updated_at": updatedAt,
+	})
 }
@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"net/http"
+
+	"go-auth-system/src/config"
+	"go-auth-system/src/models"
+	"go-auth-system/src/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// WellKnownHandler serves the public discovery documents under /.well-known
+type WellKnownHandler struct{}
+
+func NewWellKnownHandler() *WellKnownHandler {
+	return &WellKnownHandler{}
+}
+
+// JWKS publishes the public keys downstream services use to verify our tokens
+func (h *WellKnownHandler) JWKS(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, utils.CurrentJWKS())
+}
+
+// OpenIDConfiguration serves the OpenID Connect discovery document
+func (h *WellKnownHandler) OpenIDConfiguration(c *gin.Context) {
+	issuer := config.GetIssuerURL()
+
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, gin.H{
+		"issuer":                                        issuer,
+		"authorization_endpoint":                        issuer + "/oauth/authorize",
+		"token_endpoint":                                issuer + "/oauth/token",
+		"userinfo_endpoint":                             issuer + "/userinfo",
+		"introspection_endpoint":                        issuer + "/oauth/introspect",
+		"jwks_uri":                                      issuer + "/.well-known/jwks.json",
+		"response_types_supported":                      []string{"code"},
+		"grant_types_supported":                         []string{"authorization_code", "client_credentials"},
+		"subject_types_supported":                       []string{"public"},
+		"id_token_signing_alg_values_supported":         []string{utils.ActiveSigningAlgorithm()},
+		"scopes_supported":                              []string{"openid", "profile", "email", models.PermissionUsersRead},
+		"token_endpoint_auth_methods_supported":         []string{"client_secret_basic", "client_secret_post", "none"},
+		"introspection_endpoint_auth_methods_supported": []string{"client_secret_basic", "client_secret_post"},
+		"code_challenge_methods_supported":              []string{"S256"},
+		"claims_supported": []string{
+			"sub", "iss", "aud", "exp", "iat", "auth_time", "nonce",
+			"email", "email_verified", "name", "given_name", "family_name",
+		},
+	})
+}
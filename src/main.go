@@ -2,11 +2,15 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"go-auth-system/src/config"
 	"go-auth-system/src/middleware"
+	"go-auth-system/src/models"
 	"go-auth-system/src/routes"
+	"go-auth-system/src/services"
 	"go-auth-system/src/utils"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/driver/postgres"
@@ -14,8 +18,13 @@ import (
 )
 
 func main() {
-	config.Load()
-	dsn := config.GetDatabaseURL()
+	// Refuse to start on a broken or insecure configuration rather than failing on first use
+	cfg, err := config.Load()
+	if err != nil {
+		fmt.Printf("[error] invalid configuration:\n%v\n", err)
+		panic("invalid configuration: " + err.Error())
+	}
+	dsn := cfg.DatabaseURL
 
 	fmt.Println("Loaded DB URL:", dsn) // Debug print
 
@@ -25,14 +34,69 @@ func main() {
 		panic("failed to connect database: " + err.Error())
 	}
 
+	// Load the JWT signing keys
+	keyRing, err := utils.NewKeyRingFromConfig()
+	if err != nil {
+		fmt.Printf("[error] failed to load JWT signing keys: %v\n", err)
+		panic("failed to load JWT signing keys: " + err.Error())
+	}
+	utils.SetKeyRing(keyRing)
+
+	// Opaque access tokens are looked up in the database on every request
+	if cfg.AccessTokenFormat == utils.AccessTokenFormatOpaque {
+		utils.SetReferenceTokenStore(models.NewReferenceTokenStore(db))
+	}
+
+	// CSRF tokens have to verify on every instance, which needs a shared secret
+	if secret := cfg.CSRFSecret; secret != "" {
+		utils.SetCSRFSecret([]byte(secret))
+	} else {
+		// Production refuses to start without it, see config.Validate
+		fmt.Println("[warning] CSRF_SECRET is not set, CSRF tokens will not survive a restart")
+	}
+
+	// Tokens issued before a user's tokens_valid_after are rejected
+	utils.SetTokenWatermarkStore(models.NewTokenWatermarkStore(db))
+
+	// External identity providers for social login
+	providers, err := services.NewProviderRegistry(cfg.OAuthProviders, nil)
+	if err != nil {
+		fmt.Printf("[error] invalid identity provider configuration: %v\n", err)
+		panic("invalid identity provider configuration: " + err.Error())
+	}
+
+	// One store holds the blacklist, sessions and rate limits for every route
+	var store services.TokenStore
+	switch cfg.TokenStore {
+	case "memory":
+		fmt.Println("[warning] TOKEN_STORE is memory, revocations and rate limits are not shared between instances")
+		store = services.NewMemoryStore(services.MemoryStoreJanitorInterval)
+	default:
+		redisStore := services.NewRedisService(cfg.Redis)
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		if err := redisStore.Ping(ctx); err != nil {
+			fmt.Printf("[warning] %v\n", err)
+		}
+		cancel()
+
+		// Stop calling Redis while it is down; the failure policies decide what requests get
+		breaker := services.NewCircuitBreaker("redis", cfg.StoreFailure.BreakerThreshold, cfg.StoreFailure.BreakerCooldown)
+		store = services.NewBreakerStore(redisStore, breaker)
+	}
+	defer store.Close()
+
 	// Run database migrations
 	if err := utils.RunMigrations(dsn); err != nil {
 		fmt.Printf("[error] failed to run migrations: %v\n", err)
 		panic("failed to run migrations: " + err.Error())
 	}
 
+	// Rotated refresh tokens and opaque access tokens would otherwise pile up forever
+	stopTokenCleanup := models.StartTokenCleanup(db, models.TokenCleanupInterval)
+	defer stopTokenCleanup()
+
 	// Set Gin to release mode in production
-	if config.GetPort() == "8080" {
+	if cfg.Port == "8080" {
 		gin.SetMode(gin.ReleaseMode)
 	}
 
@@ -41,22 +105,16 @@ func main() {
 	// Add security middleware
 	router.Use(middleware.SecureHeaders())
 
-	// Add CORS middleware for development
-	router.Use(func(c *gin.Context) {
-		c.Header("Access-Control-Allow-Origin", "*")
-		c.Header("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		c.Header("Access-Control-Allow-Headers", "Origin, Content-Type, Accept, Authorization, X-CSRF-Token")
-
-		if c.Request.Method == "OPTIONS" {
-			c.AbortWithStatus(204)
-			return
-		}
-
-		c.Next()
-	})
+	// Only the configured origins may call the API from a browser
+	cors, err := middleware.NewCORSMiddleware(cfg.CORS)
+	if err != nil {
+		fmt.Printf("[error] invalid CORS configuration: %v\n", err)
+		panic("invalid CORS configuration: " + err.Error())
+	}
+	router.Use(cors)
 
-	routes.SetupRoutes(router, db)
+	routes.SetupRoutes(router, db, store, providers)
 
-	fmt.Printf("Server starting on port %s\n", config.GetPort())
-	router.Run(":" + config.GetPort())
+	fmt.Printf("Server starting on port %s\n", cfg.Port)
+	router.Run(":" + cfg.Port)
 }
@@ -1,42 +1,49 @@
 package middleware
 
 import (
-	"context"
 	"net/http"
 	"strconv"
 	"strings"
 
 	"go-auth-system/src/config"
+	"go-auth-system/src/services"
 	"go-auth-system/src/utils"
 
 	"github.com/gin-gonic/gin"
-	"github.com/go-redis/redis/v8"
 )
 
-func AuthMiddleware() gin.HandlerFunc {
-	rdb := redis.NewClient(&redis.Options{
-		Addr:     "cache:6379",
-		Password: "",
-		DB:       0,
-	})
-
+// AuthMiddleware authenticates the access token and checks it against the blacklist and the
+// revoked sessions kept in the store
+func AuthMiddleware(store services.TokenStore) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		authHeader := c.GetHeader("Authorization")
-		if !strings.HasPrefix(authHeader, "Bearer ") {
+		tokenString, fromCookie := AccessTokenFromRequest(c)
+		if tokenString == "" {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
 			c.Abort()
 			return
 		}
-		tokenString := strings.TrimPrefix(authHeader, "Bearer ")
 
-		// Check if token is blacklisted
-		blacklisted, err := rdb.Get(context.Background(), "blacklist:"+tokenString).Result()
-		if err == nil && blacklisted == "true" {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Token has been revoked"})
+		// Browsers attach cookies to cross-site requests as well, so those need the CSRF checks
+		if fromCookie && !isSafeMethod(c.Request.Method) && !ValidCSRFRequest(c) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "CSRF token invalid or missing"})
 			c.Abort()
 			return
 		}
 
+		// Check if token is blacklisted. Opaque reference tokens are looked up in their store by
+		// ValidateToken, which already rejects revoked ones.
+		if !utils.IsReferenceToken(tokenString) {
+			blacklisted, err := store.IsTokenBlacklisted(tokenString)
+			if RevocationUnknown(c, err) {
+				return
+			}
+			if blacklisted {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Token has been revoked"})
+				c.Abort()
+				return
+			}
+		}
+
 		claims, err := utils.ValidateToken(tokenString, utils.AccessToken)
 		if err != nil {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
@@ -44,59 +51,149 @@ func AuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
-		c.Set("userID", claims.UserID)
-		c.Set("userIDString", strconv.FormatUint(uint64(claims.UserID), 10))
+		// Password resets and admins can revoke every token a user holds at once
+		if utils.IssuedBeforeWatermark(claims) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Token has been revoked"})
+			c.Abort()
+			return
+		}
+
+		// Access tokens of a session the user has logged out remotely stop working straight away
+		if claims.SessionID != "" {
+			revoked, err := store.IsSessionRevoked(claims.SessionID)
+			if RevocationUnknown(c, err) {
+				return
+			}
+			if revoked {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Session has been revoked"})
+				c.Abort()
+				return
+			}
+		}
+
+		setSubject(c, claims)
 		c.Next()
 	}
 }
 
-func OptionalAuthMiddleware() gin.HandlerFunc {
+// RevocationUnknown handles a store lookup that could not tell whether a token was revoked. Under
+// REVOCATION_FAILURE_POLICY=closed, the default, the request is rejected with 503 and true is
+// returned; failing open lets the token through as if it was not revoked.
+func RevocationUnknown(c *gin.Context, err error) bool {
+	if err == nil || config.GetStoreFailure().RevocationFailsOpen() {
+		return false
+	}
+	c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Token revocation status is temporarily unavailable"})
+	c.Abort()
+	return true
+}
+
+// setSubject exposes the token subject to handlers. Machine tokens never get a userID, so
+// handlers that look one up reject them.
+func setSubject(c *gin.Context, claims *utils.Claims) {
+	c.Set("scope", claims.Scope)
+	if claims.IsClient() {
+		c.Set("subjectType", utils.SubjectClient)
+		c.Set("clientID", claims.ClientID)
+		return
+	}
+
+	c.Set("subjectType", utils.SubjectUser)
+	c.Set("delegated", claims.IsDelegated())
+	c.Set("roles", claims.Roles)
+	c.Set("permissions", claims.Permissions)
+	c.Set("userID", claims.UserID)
+	c.Set("userIDString", strconv.FormatUint(uint64(claims.UserID), 10))
+	if claims.SessionID != "" {
+		c.Set("sessionID", claims.SessionID)
+	}
+}
+
+// RequireUser only lets through first-party user tokens. Machine tokens are rejected, and so are
+// user tokens issued to third-party OAuth clients: those are limited to the routes guarded by
+// RequireScope, such as /userinfo, and must not control the account.
+func RequireUser() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		tokenString := c.Request.Header.Get("Authorization")
-		if tokenString == "" || !strings.HasPrefix(tokenString, "Bearer ") {
-			c.Next()
+		if _, exists := c.Get("userID"); !exists {
+			c.JSON(http.StatusForbidden, gin.H{"error": "This endpoint requires a user token"})
+			c.Abort()
 			return
 		}
-
-		tokenString = strings.TrimPrefix(tokenString, "Bearer ")
-
-		claims, err := utils.ValidateToken(tokenString, utils.AccessToken)
-		if err != nil {
-			c.Next()
+		if c.GetBool("delegated") {
+			c.JSON(http.StatusForbidden, gin.H{"error": "This endpoint does not accept tokens issued to OAuth clients"})
+			c.Abort()
 			return
 		}
+		c.Next()
+	}
+}
 
-		c.Set("userID", claims.UserID)
-		c.Set("userIDString", strconv.FormatUint(uint64(claims.UserID), 10))
+// RequireClient only lets through machine tokens issued to OAuth clients with the
+// client_credentials grant, for service-to-service routes. User tokens never get here, even
+// when they carry the scope the route asks for.
+func RequireClient() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetString("clientID") == "" {
+			c.JSON(http.StatusForbidden, gin.H{"error": "This endpoint requires a client token"})
+			c.Abort()
+			return
+		}
 		c.Next()
 	}
 }
 
-// CSRFProtection middleware for protecting against CSRF attacks
-func CSRFProtection() gin.HandlerFunc {
+// RequirePermission only lets through users whose roles grant the given permission. Permissions
+// come from the access token, so role changes take effect when the token is next refreshed.
+func RequirePermission(permission string) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// Skip CSRF for GET, HEAD, OPTIONS requests
-		if c.Request.Method == "GET" || c.Request.Method == "HEAD" || c.Request.Method == "OPTIONS" {
+		if HasPermission(c, permission) {
 			c.Next()
 			return
 		}
+		c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions"})
+		c.Abort()
+	}
+}
 
-		// Check for CSRF token in header
-		csrfToken := c.GetHeader("X-CSRF-Token")
-		if csrfToken == "" {
-			c.JSON(http.StatusForbidden, gin.H{"error": "CSRF token missing"})
-			c.Abort()
+// HasPermission reports whether the authenticated user holds the given permission
+func HasPermission(c *gin.Context, permission string) bool {
+	for _, granted := range c.GetStringSlice("permissions") {
+		if granted == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// RequireScope only lets through tokens that were granted the given OAuth scope
+func RequireScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		for _, granted := range strings.Fields(c.GetString("scope")) {
+			if granted == scope {
+				c.Next()
+				return
+			}
+		}
+		c.JSON(http.StatusForbidden, gin.H{"error": "insufficient_scope"})
+		c.Abort()
+	}
+}
+
+func OptionalAuthMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tokenString, fromCookie := AccessTokenFromRequest(c)
+		if tokenString == "" || (fromCookie && !isSafeMethod(c.Request.Method) && !ValidCSRFRequest(c)) {
+			c.Next()
 			return
 		}
 
-		// In a real implementation, you would validate the CSRF token
-		// For now, we'll just check if it exists
-		if len(csrfToken) < 32 {
-			c.JSON(http.StatusForbidden, gin.H{"error": "Invalid CSRF token"})
-			c.Abort()
+		claims, err := utils.ValidateToken(tokenString, utils.AccessToken)
+		if err != nil || utils.IssuedBeforeWatermark(claims) {
+			c.Next()
 			return
 		}
 
+		setSubject(c, claims)
 		c.Next()
 	}
 }
@@ -128,20 +225,6 @@ func SecureHeaders() gin.HandlerFunc {
 	}
 }
 
-// CSRFMiddleware for validating CSRF tokens
-func CSRFMiddleware() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		csrfTokenFromHeader := c.GetHeader("X-CSRF-Token")
-		csrfTokenFromCookie, err := c.Cookie("csrf_token")
-		if err != nil || csrfTokenFromHeader == "" || csrfTokenFromHeader != csrfTokenFromCookie {
-			c.JSON(http.StatusForbidden, gin.H{"error": "CSRF token invalid or missing"})
-			c.Abort()
-			return
-		}
-		c.Next()
-	}
-}
-
 func UserMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		userID, exists := c.Get("userID")
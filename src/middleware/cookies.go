@@ -0,0 +1,102 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"go-auth-system/src/config"
+	"go-auth-system/src/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// TokenDeliveryBody returns tokens in the JSON response, for clients sending them as bearer tokens
+	TokenDeliveryBody = "body"
+	// TokenDeliveryCookie sets tokens as HttpOnly cookies, for browser clients
+	TokenDeliveryCookie = "cookie"
+
+	// TokenDeliveryHeader lets a client pick its token delivery, overriding TOKEN_DELIVERY
+	TokenDeliveryHeader = "X-Token-Delivery"
+
+	AccessTokenCookie  = "access_token"
+	RefreshTokenCookie = "refresh_token"
+
+	// refreshTokenCookiePath keeps the refresh token from being sent anywhere but the auth routes
+	refreshTokenCookiePath = "/auth"
+	refreshTokenCookieTTL  = 7 * 24 * time.Hour
+)
+
+// CookieSessionRequested reports whether tokens are delivered to the caller as cookies. The
+// X-Token-Delivery header decides for clients that send it, TOKEN_DELIVERY for everyone else.
+func CookieSessionRequested(c *gin.Context) bool {
+	switch strings.ToLower(c.GetHeader(TokenDeliveryHeader)) {
+	case TokenDeliveryCookie:
+		return true
+	case TokenDeliveryBody:
+		return false
+	}
+	return config.GetTokenDelivery() == TokenDeliveryCookie
+}
+
+// SetSessionCookies stores the token pair in HttpOnly cookies and returns a CSRF token, which
+// scripts send back in the X-CSRF-Token header. Logins pass newSession to start a new CSRF
+// session; refreshes keep the current one so tokens held by requests in flight stay valid.
+func SetSessionCookies(c *gin.Context, accessToken, refreshToken string, newSession bool) (string, error) {
+	var csrfToken string
+	var err error
+	if newSession {
+		csrfToken, err = startCSRFSession(c)
+	} else {
+		csrfToken, err = NewCSRFToken(c)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	setCookie(c, AccessTokenCookie, accessToken, "/", utils.AccessTokenTTL, true)
+	setCookie(c, RefreshTokenCookie, refreshToken, refreshTokenCookiePath, refreshTokenCookieTTL, true)
+	return csrfToken, nil
+}
+
+// ClearSessionCookies removes the cookies set by SetSessionCookies
+func ClearSessionCookies(c *gin.Context) {
+	setCookie(c, AccessTokenCookie, "", "/", -time.Second, true)
+	setCookie(c, RefreshTokenCookie, "", refreshTokenCookiePath, -time.Second, true)
+	setCookie(c, CSRFSessionCookie, "", "/", -time.Second, true)
+}
+
+func setCookie(c *gin.Context, name, value, path string, maxAge time.Duration, httpOnly bool) {
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     path,
+		MaxAge:   int(maxAge.Seconds()),
+		Secure:   true,
+		HttpOnly: httpOnly,
+		SameSite: http.SameSiteStrictMode,
+	})
+}
+
+// AccessTokenFromRequest returns the bearer token, or the access token cookie when no
+// Authorization header is present. fromCookie tells the caller that CSRF checks apply.
+func AccessTokenFromRequest(c *gin.Context) (token string, fromCookie bool) {
+	if authHeader := c.GetHeader("Authorization"); authHeader != "" {
+		if !strings.HasPrefix(authHeader, "Bearer ") {
+			return "", false
+		}
+		return strings.TrimPrefix(authHeader, "Bearer "), false
+	}
+
+	token, err := c.Cookie(AccessTokenCookie)
+	if err != nil || token == "" {
+		return "", false
+	}
+	return token, true
+}
+
+// isSafeMethod reports whether the request cannot change state, so needs no CSRF check
+func isSafeMethod(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions
+}
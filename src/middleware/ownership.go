@@ -0,0 +1,50 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"go-auth-system/src/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequireSelfOrPermission guards routes that act on a single user record identified by the
+// given path parameter. The authenticated user may always act on their own record; acting on
+// anyone else's requires the permission, e.g. users:read for reads and users:write for writes.
+// Non-owners get 403 whether or not the record exists, so ids cannot be probed; an id that is
+// not a number gets 400 before it can reach a query.
+func RequireSelfOrPermission(param, permission string) gin.HandlerFunc {
+	securityLogger := utils.NewSecurityLogger()
+
+	return func(c *gin.Context) {
+		userID, exists := c.Get("userID")
+		if !exists {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			c.Abort()
+			return
+		}
+
+		targetID, err := strconv.ParseUint(c.Param(param), 10, 0)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+			c.Abort()
+			return
+		}
+		if uint(targetID) == userID.(uint) {
+			c.Next()
+			return
+		}
+
+		if HasPermission(c, permission) {
+			c.Next()
+			return
+		}
+
+		securityLogger.LogSuspiciousActivity("unauthorized_user_access", c.ClientIP(), c.GetHeader("User-Agent"),
+			fmt.Sprintf("User %d attempted %s %s on user %s", userID, c.Request.Method, c.FullPath(), c.Param(param)))
+		c.JSON(http.StatusForbidden, gin.H{"error": "You do not have access to this user"})
+		c.Abort()
+	}
+}
@@ -1,83 +1,83 @@
 package middleware
 
 import (
-	"context"
 	"fmt"
+	"math"
 	"net/http"
+	"strconv"
 	"time"
 
+	"go-auth-system/src/config"
+	"go-auth-system/src/services"
+
 	"github.com/gin-gonic/gin"
-	"github.com/go-redis/redis/v8"
 )
 
+// RateLimiter applies the configured rate limit policies to routes
 type RateLimiter struct {
-	redisClient *redis.Client
+	store    services.TokenStore
+	policies map[string]config.RateLimitPolicy
+	// Clock is the time requests are counted at; tests replace it to move through a window
+	Clock func() time.Time
 }
 
-func NewRateLimiter() *RateLimiter {
-	rdb := redis.NewClient(&redis.Options{
-		Addr:     "cache:6379",
-		Password: "",
-		DB:       0,
-	})
-	return &RateLimiter{redisClient: rdb}
+// NewRateLimiter keeps its counters in the shared store, so limits hold across instances
+func NewRateLimiter(store services.TokenStore, policies map[string]config.RateLimitPolicy) *RateLimiter {
+	return &RateLimiter{store: store, policies: policies, Clock: time.Now}
 }
 
-func (rl *RateLimiter) RateLimitByIP(maxRequests int, window time.Duration) gin.HandlerFunc {
-	return func(c *gin.Context) {
-		clientIP := c.ClientIP()
-		key := fmt.Sprintf("rate_limit:ip:%s", clientIP)
-
-		count, err := rl.redisClient.Incr(context.Background(), key).Result()
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Rate limit error"})
-			c.Abort()
-			return
-		}
-
-		if count == 1 {
-			rl.redisClient.Expire(context.Background(), key, window)
-		}
+// rateLimitMessages tell clients which budget they ran out of
+var rateLimitMessages = map[string]string{
+	config.RateLimitLogin:         "Too many login attempts",
+	config.RateLimitPasswordReset: "Too many password reset attempts",
+}
 
-		if count > int64(maxRequests) {
-			c.JSON(http.StatusTooManyRequests, gin.H{
-				"error":       "Too many requests",
-				"retry_after": window.Seconds(),
-			})
-			c.Abort()
-			return
-		}
+// Limit applies the named policy. Per-user policies only limit authenticated requests, so they
+// belong behind AuthMiddleware; config refuses them for the policies mounted before it. Routes
+// are set up at startup, so an unknown policy stops the service there.
+func (rl *RateLimiter) Limit(name string) gin.HandlerFunc {
+	policy, ok := rl.policies[name]
+	if !ok {
+		panic(fmt.Sprintf("no %q rate limit policy is configured", name))
+	}
+	if policy.Disabled {
+		return func(c *gin.Context) { c.Next() }
+	}
 
-		c.Next()
+	limit := services.RateLimit{Strategy: services.RateLimitStrategy(policy.Strategy), Limit: policy.Limit, Window: policy.Window}
+	if err := limit.Validate(); err != nil {
+		panic(fmt.Sprintf("invalid %q rate limit policy: %v", name, err))
+	}
+	message, ok := rateLimitMessages[name]
+	if !ok {
+		message = "Too many requests"
 	}
-}
 
-func (rl *RateLimiter) RateLimitByUser(maxRequests int, window time.Duration) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		userID, exists := c.Get("userID")
-		if !exists {
-			c.Next()
-			return
+		var id string
+		switch policy.Key {
+		case "user":
+			userID, exists := c.Get("userID")
+			if !exists {
+				c.Next()
+				return
+			}
+			id = fmt.Sprint(userID)
+		default:
+			id = c.ClientIP()
 		}
 
-		key := fmt.Sprintf("rate_limit:user:%d", userID)
-
-		count, err := rl.redisClient.Incr(context.Background(), key).Result()
+		// The strategies keep different data, so each has its own keys
+		key := fmt.Sprintf("rate_limit:%s:%s:%s:%s", policy.Strategy, name, policy.Key, id)
+		result, err := rl.store.AllowRequest(key, limit, rl.Clock())
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Rate limit error"})
-			c.Abort()
+			rateLimitUnavailable(c)
 			return
 		}
 
-		if count == 1 {
-			rl.redisClient.Expire(context.Background(), key, window)
-		}
-
-		if count > int64(maxRequests) {
-			c.JSON(http.StatusTooManyRequests, gin.H{
-				"error":       "Too many requests",
-				"retry_after": window.Seconds(),
-			})
+		setRateLimitHeaders(c, result)
+		if !result.Allowed {
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": message})
 			c.Abort()
 			return
 		}
@@ -86,60 +86,34 @@ func (rl *RateLimiter) RateLimitByUser(maxRequests int, window time.Duration) gi
 	}
 }
 
-func (rl *RateLimiter) LoginRateLimit(maxAttempts int, window time.Duration) gin.HandlerFunc {
-	return func(c *gin.Context) {
-		clientIP := c.ClientIP()
-		key := fmt.Sprintf("login_attempts:%s", clientIP)
-
-		count, err := rl.redisClient.Incr(context.Background(), key).Result()
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Rate limit error"})
-			c.Abort()
-			return
-		}
-
-		if count == 1 {
-			rl.redisClient.Expire(context.Background(), key, window)
-		}
-
-		if count > int64(maxAttempts) {
-			c.JSON(http.StatusTooManyRequests, gin.H{
-				"error":       "Too many login attempts",
-				"retry_after": window.Seconds(),
-			})
-			c.Abort()
-			return
-		}
+// setRateLimitHeaders reports the limit in the RateLimit-Limit, RateLimit-Remaining and
+// RateLimit-Reset headers, plus Retry-After on rejections. Of several limits on a route the one
+// with the fewest requests remaining is reported, as that is the one the client runs into first.
+func setRateLimitHeaders(c *gin.Context, result services.RateLimitResult) {
+	if reported, err := strconv.Atoi(c.Writer.Header().Get("RateLimit-Remaining")); err == nil && reported < result.Remaining {
+		return
+	}
 
-		c.Next()
+	c.Header("RateLimit-Limit", strconv.Itoa(result.Limit))
+	c.Header("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+	c.Header("RateLimit-Reset", headerSeconds(result.Reset))
+	if !result.Allowed {
+		c.Header("Retry-After", headerSeconds(result.RetryAfter))
 	}
 }
 
-func (rl *RateLimiter) PasswordResetRateLimit(maxAttempts int, window time.Duration) gin.HandlerFunc {
-	return func(c *gin.Context) {
-		clientIP := c.ClientIP()
-		key := fmt.Sprintf("password_reset_attempts:%s", clientIP)
-
-		count, err := rl.redisClient.Incr(context.Background(), key).Result()
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Rate limit error"})
-			c.Abort()
-			return
-		}
-
-		if count == 1 {
-			rl.redisClient.Expire(context.Background(), key, window)
-		}
-
-		if count > int64(maxAttempts) {
-			c.JSON(http.StatusTooManyRequests, gin.H{
-				"error":       "Too many password reset attempts",
-				"retry_after": window.Seconds(),
-			})
-			c.Abort()
-			return
-		}
+// headerSeconds rounds up, so a client waiting that long is not turned away again
+func headerSeconds(d time.Duration) string {
+	return strconv.FormatInt(int64(math.Ceil(d.Seconds())), 10)
+}
 
+// rateLimitUnavailable applies RATE_LIMIT_FAILURE_POLICY when the store cannot count the request.
+// Failing open serves it without a limit; failing closed turns it away until the store is back.
+func rateLimitUnavailable(c *gin.Context) {
+	if config.GetStoreFailure().RateLimitFailsOpen() {
 		c.Next()
+		return
 	}
+	c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Rate limiting is temporarily unavailable"})
+	c.Abort()
 }
@@ -0,0 +1,108 @@
+package models
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"go-auth-system/src/utils"
+
+	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
+)
+
+// AccessToken is the server-side record of an opaque access token, holding everything a JWT
+// would otherwise carry. Only the digest of the token is stored.
+type AccessToken struct {
+	ID          uint       `gorm:"primaryKey" json:"id"`
+	TokenHash   string     `gorm:"uniqueIndex;not null" json:"-"`
+	SubjectType string     `gorm:"not null" json:"subject_type"`
+	UserID      *uint      `gorm:"index" json:"user_id"` // nil for tokens issued to OAuth clients
+	ClientID    string     `json:"client_id"`
+	Scope       string     `json:"scope"`       // space separated
+	Audience    string     `json:"audience"`    // space separated
+	Roles       string     `json:"roles"`       // space separated
+	Permissions string     `json:"permissions"` // space separated
+	SessionID   string     `gorm:"index" json:"session_id"`
+	IssuedAt    time.Time  `gorm:"not null" json:"issued_at"`
+	ExpiresAt   time.Time  `gorm:"not null;index" json:"expires_at"`
+	RevokedAt   *time.Time `json:"revoked_at"`
+}
+
+// ReferenceTokenStore implements utils.ReferenceTokenStore on the access_tokens table
+type ReferenceTokenStore struct {
+	DB *gorm.DB
+}
+
+func NewReferenceTokenStore(db *gorm.DB) *ReferenceTokenStore {
+	return &ReferenceTokenStore{DB: db}
+}
+
+func (s *ReferenceTokenStore) Save(tokenHash string, claims *utils.Claims) error {
+	record := AccessToken{
+		TokenHash:   tokenHash,
+		SubjectType: string(claims.SubjectType),
+		ClientID:    claims.ClientID,
+		Scope:       claims.Scope,
+		Audience:    strings.Join(claims.Audience, " "),
+		Roles:       strings.Join(claims.Roles, " "),
+		Permissions: strings.Join(claims.Permissions, " "),
+		SessionID:   claims.SessionID,
+		IssuedAt:    claims.IssuedAt.Time,
+		ExpiresAt:   claims.ExpiresAt.Time,
+	}
+	if !claims.IsClient() {
+		userID := claims.UserID
+		record.UserID = &userID
+	}
+	return s.DB.Create(&record).Error
+}
+
+func (s *ReferenceTokenStore) Load(tokenHash string) (*utils.Claims, error) {
+	var record AccessToken
+	if err := s.DB.Where("token_hash = ? AND revoked_at IS NULL", tokenHash).First(&record).Error; err != nil {
+		return nil, utils.ErrReferenceTokenNotFound
+	}
+	return record.Claims(), nil
+}
+
+func (s *ReferenceTokenStore) Revoke(tokenHash string) error {
+	return s.DB.Model(&AccessToken{}).
+		Where("token_hash = ? AND revoked_at IS NULL", tokenHash).
+		Update("revoked_at", time.Now()).Error
+}
+
+// RevokeSessions revokes every opaque access token issued for the given sessions
+func (s *ReferenceTokenStore) RevokeSessions(sessionIDs []string) error {
+	return s.DB.Model(&AccessToken{}).
+		Where("session_id IN ? AND revoked_at IS NULL", sessionIDs).
+		Update("revoked_at", time.Now()).Error
+}
+
+// Claims rebuilds the claims the token was issued with
+func (t *AccessToken) Claims() *utils.Claims {
+	claims := &utils.Claims{
+		TokenType:   utils.AccessToken,
+		SubjectType: utils.SubjectType(t.SubjectType),
+		ClientID:    t.ClientID,
+		Scope:       t.Scope,
+		Roles:       strings.Fields(t.Roles),
+		Permissions: strings.Fields(t.Permissions),
+		SessionID:   t.SessionID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Audience:  strings.Fields(t.Audience),
+			IssuedAt:  jwt.NewNumericDate(t.IssuedAt),
+			NotBefore: jwt.NewNumericDate(t.IssuedAt),
+			ExpiresAt: jwt.NewNumericDate(t.ExpiresAt),
+			Issuer:    "go-auth-system",
+		},
+	}
+
+	if t.UserID != nil {
+		claims.UserID = *t.UserID
+		claims.Subject = strconv.FormatUint(uint64(*t.UserID), 10)
+	} else {
+		claims.Subject = t.ClientID
+	}
+	return claims
+}
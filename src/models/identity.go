@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// LinkedIdentity ties an account at an external identity provider to a local user. A user can
+// have any number of them, but each provider subject belongs to exactly one user.
+type LinkedIdentity struct {
+	ID          uint       `gorm:"primaryKey" json:"id"`
+	UserID      uint       `gorm:"not null;index" json:"user_id"`
+	Provider    string     `gorm:"not null;uniqueIndex:idx_linked_identities_provider_subject" json:"provider"`
+	Subject     string     `gorm:"not null;uniqueIndex:idx_linked_identities_provider_subject" json:"-"`
+	Email       string     `json:"email"`
+	LastLoginAt *time.Time `json:"last_login_at"`
+	CreatedAt   time.Time  `json:"created_at"`
+	User        User       `gorm:"foreignKey:UserID" json:"-"`
+}
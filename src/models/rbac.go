@@ -0,0 +1,81 @@
+package models
+
+import (
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Built-in roles seeded by the migrations
+const (
+	RoleAdmin = "admin"
+	RoleUser  = "user"
+)
+
+// Permissions checked by the API. New permissions are added through a migration and granted to roles there.
+const (
+	PermissionUsersRead  = "users:read"
+	PermissionUsersWrite = "users:write"
+	PermissionRolesRead  = "roles:read"
+	PermissionRolesWrite = "roles:write"
+)
+
+type Role struct {
+	ID          uint         `gorm:"primaryKey" json:"id"`
+	Name        string       `gorm:"uniqueIndex;not null" json:"name"`
+	Description string       `json:"description"`
+	Permissions []Permission `gorm:"many2many:role_permissions" json:"permissions"`
+	CreatedAt   time.Time    `json:"created_at"`
+}
+
+type Permission struct {
+	ID          uint   `gorm:"primaryKey" json:"id"`
+	Name        string `gorm:"uniqueIndex;not null" json:"name"`
+	Description string `json:"description"`
+}
+
+type UserRole struct {
+	UserID    uint      `gorm:"primaryKey" json:"user_id"`
+	RoleID    uint      `gorm:"primaryKey" json:"role_id"`
+	CreatedAt time.Time `json:"created_at"`
+	Role      Role      `gorm:"foreignKey:RoleID" json:"role"`
+}
+
+// UserAccess is the flattened set of roles and permissions a user holds, as carried in access tokens
+type UserAccess struct {
+	Roles       []string
+	Permissions []string
+}
+
+// LoadUserAccess resolves the roles of a user and the union of their permissions
+func LoadUserAccess(db *gorm.DB, userID uint) (UserAccess, error) {
+	var userRoles []UserRole
+	if err := db.Preload("Role.Permissions").Where("user_id = ?", userID).Find(&userRoles).Error; err != nil {
+		return UserAccess{}, err
+	}
+
+	access := UserAccess{Roles: []string{}, Permissions: []string{}}
+	seen := make(map[string]struct{})
+	for _, userRole := range userRoles {
+		access.Roles = append(access.Roles, userRole.Role.Name)
+		for _, permission := range userRole.Role.Permissions {
+			if _, ok := seen[permission.Name]; !ok {
+				seen[permission.Name] = struct{}{}
+				access.Permissions = append(access.Permissions, permission.Name)
+			}
+		}
+	}
+	sort.Strings(access.Roles)
+	sort.Strings(access.Permissions)
+	return access, nil
+}
+
+// AssignRole grants the named role to a user. Granting a role the user already has is a no-op.
+func AssignRole(db *gorm.DB, userID uint, roleName string) error {
+	var role Role
+	if err := db.Where("name = ?", roleName).First(&role).Error; err != nil {
+		return err
+	}
+	return db.Where(UserRole{UserID: userID, RoleID: role.ID}).FirstOrCreate(&UserRole{}).Error
+}
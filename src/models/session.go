@@ -0,0 +1,43 @@
+package models
+
+import (
+	"strconv"
+	"time"
+)
+
+// Session is how a refresh token is shown to its owner. The token value is never part of it.
+type Session struct {
+	ID         uint       `json:"id"`
+	Label      string     `json:"label"`
+	UserAgent  string     `json:"user_agent"`
+	IPAddress  string     `json:"ip_address"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	Current    bool       `json:"current"`
+}
+
+// IsRotated reports whether the token has been exchanged already; such records only exist to
+// detect reuse and are never sessions themselves
+func (t *RefreshToken) IsRotated() bool {
+	return t.RotatedAt != nil
+}
+
+// SessionID is the value carried in the sid claim of access tokens issued for this session
+func (t *RefreshToken) SessionID() string {
+	return strconv.FormatUint(uint64(t.ID), 10)
+}
+
+// SessionView returns the session, flagged as current when it is the one the caller is using
+func (t *RefreshToken) SessionView(currentSessionID string) Session {
+	return Session{
+		ID:         t.ID,
+		Label:      t.Label,
+		UserAgent:  t.UserAgent,
+		IPAddress:  t.IPAddress,
+		CreatedAt:  t.CreatedAt,
+		LastUsedAt: t.LastUsedAt,
+		ExpiresAt:  t.ExpiresAt,
+		Current:    currentSessionID != "" && t.SessionID() == currentSessionID,
+	}
+}
@@ -0,0 +1,51 @@
+package models
+
+import (
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// TokenCleanupInterval is how often expired token records are purged from the database
+const TokenCleanupInterval = time.Hour
+
+// PurgeExpiredTokens deletes the refresh_tokens, access_tokens and oauth_authorization_codes
+// records that are past their expiry. Expired tokens fail validation before their record is
+// looked up, so this includes rotated refresh tokens and used authorization codes, which are
+// only kept to detect a replay while they could still pass.
+func PurgeExpiredTokens(db *gorm.DB, now time.Time) (int64, error) {
+	var purged int64
+	for _, record := range []interface{}{&RefreshToken{}, &AccessToken{}, &OAuthAuthorizationCode{}} {
+		result := db.Where("expires_at < ?", now).Delete(record)
+		if result.Error != nil {
+			return purged, result.Error
+		}
+		purged += result.RowsAffected
+	}
+	return purged, nil
+}
+
+// StartTokenCleanup purges expired token records every interval until the returned function
+// is called. Every instance runs it; deleting the same expired rows twice is harmless.
+func StartTokenCleanup(db *gorm.DB, interval time.Duration) (stop func()) {
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				if purged, err := PurgeExpiredTokens(db, time.Now()); err != nil {
+					log.Printf("token cleanup failed: %v", err)
+				} else if purged > 0 {
+					log.Printf("token cleanup purged %d expired token records", purged)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() { close(done) }
+}
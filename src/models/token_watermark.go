@@ -0,0 +1,54 @@
+package models
+
+import (
+	"time"
+
+	"go-auth-system/src/utils"
+
+	"gorm.io/gorm"
+)
+
+// TokenWatermarkStore implements utils.TokenWatermarkStore on the users table
+type TokenWatermarkStore struct {
+	DB *gorm.DB
+}
+
+func NewTokenWatermarkStore(db *gorm.DB) *TokenWatermarkStore {
+	return &TokenWatermarkStore{DB: db}
+}
+
+func (s *TokenWatermarkStore) TokensValidAfter(userID uint) (time.Time, error) {
+	var user User
+	if err := s.DB.Select("id", "tokens_valid_after").First(&user, userID).Error; err != nil {
+		return time.Time{}, err
+	}
+	if user.TokensValidAfter == nil {
+		return time.Time{}, nil
+	}
+	return *user.TokensValidAfter, nil
+}
+
+// RevokeUserTokens invalidates every token issued to the user so far by raising their
+// tokens_valid_after watermark, and removes their sessions and the authorization codes not yet
+// exchanged, which would otherwise still yield fresh tokens. Token issue times are truncated to
+// whole seconds, so the watermark is rounded up to the next second to cover tokens issued
+// earlier in the current one; tokens issued before that second has passed are rejected too.
+func RevokeUserTokens(db *gorm.DB, userID uint) error {
+	validAfter := time.Now().Truncate(time.Second).Add(time.Second)
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&User{}).Where("id = ?", userID).Update("tokens_valid_after", validAfter).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", userID).Delete(&RefreshToken{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", userID).Delete(&OAuthAuthorizationCode{}).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	utils.ForgetTokenWatermark(userID)
+	return nil
+}
@@ -3,12 +3,14 @@ package models
 import (
 	"go-auth-system/src/utils"
 	"time"
+
+	"gorm.io/gorm"
 )
 
 type User struct {
 	ID               uint   `gorm:"primaryKey"`
 	Email            string `gorm:"uniqueIndex;not null"`
-	PasswordHash     string `gorm:"not null"`
+	PasswordHash     string `gorm:"not null" json:"-"`
 	FirstName        string
 	LastName         string
 	IsEmailVerified  bool
@@ -18,21 +20,37 @@ type User struct {
 	CreatedAt        time.Time
 	UpdatedAt        time.Time
 	LastLoginAt      *time.Time
+	MFAEnabled       bool
+	MFASecret        string `json:"-"`
+	MFAEnabledAt     *time.Time
+	MFALastStep      *int64     `json:"-"` // last accepted TOTP time step, a code is never accepted twice
+	TokensValidAfter *time.Time // tokens issued before this time are rejected
 }
 
+// RefreshToken is one login session. The record is rotated in place on refresh, so its ID
+// identifies the session on a device for as long as the user stays logged in there. Each
+// rotation leaves the previous token behind as a rotated record of the same family, which is
+// how a replayed token is recognised. Like the other token tables it only stores the SHA-256
+// digest of the token.
 type RefreshToken struct {
-	ID        uint      `gorm:"primaryKey" json:"id"`
-	UserID    uint      `gorm:"not null;index" json:"user_id"`
-	Token     string    `gorm:"uniqueIndex;not null" json:"token"`
-	ExpiresAt time.Time `gorm:"not null" json:"expires_at"`
-	CreatedAt time.Time `json:"created_at"`
-	User      User      `gorm:"foreignKey:UserID" json:"user"`
+	ID         uint       `gorm:"primaryKey" json:"id"`
+	UserID     uint       `gorm:"not null;index" json:"user_id"`
+	TokenHash  string     `gorm:"uniqueIndex;not null" json:"-"`
+	FamilyID   string     `gorm:"not null;index" json:"family_id"`
+	ExpiresAt  time.Time  `gorm:"not null" json:"expires_at"`
+	RotatedAt  *time.Time `json:"rotated_at"`
+	UserAgent  string     `json:"user_agent"`
+	IPAddress  string     `json:"ip_address"`
+	Label      string     `json:"label"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+	User       User       `gorm:"foreignKey:UserID" json:"user"`
 }
 
 type PasswordResetToken struct {
 	ID        uint      `gorm:"primaryKey" json:"id"`
 	UserID    uint      `gorm:"not null;index" json:"user_id"`
-	Token     string    `gorm:"uniqueIndex;not null" json:"token"`
+	TokenHash string    `gorm:"uniqueIndex;not null" json:"-"`
 	ExpiresAt time.Time `gorm:"not null" json:"expires_at"`
 	Used      bool      `gorm:"default:false" json:"used"`
 	CreatedAt time.Time `json:"created_at"`
@@ -42,13 +60,22 @@ type PasswordResetToken struct {
 type EmailVerificationToken struct {
 	ID        uint      `gorm:"primaryKey" json:"id"`
 	UserID    uint      `gorm:"not null;index" json:"user_id"`
-	Token     string    `gorm:"uniqueIndex;not null" json:"token"`
+	TokenHash string    `gorm:"uniqueIndex;not null" json:"-"`
 	ExpiresAt time.Time `gorm:"not null" json:"expires_at"`
 	Used      bool      `gorm:"default:false" json:"used"`
 	CreatedAt time.Time `json:"created_at"`
 	User      User      `gorm:"foreignKey:UserID" json:"user"`
 }
 
+type MFARecoveryCode struct {
+	ID        uint       `gorm:"primaryKey" json:"id"`
+	UserID    uint       `gorm:"not null;index" json:"user_id"`
+	CodeHash  string     `gorm:"not null" json:"-"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at"`
+	User      User       `gorm:"foreignKey:UserID" json:"user"`
+}
+
 func (u *User) SetPassword(password string) error {
 	hash, err := utils.HashPassword(password)
 	if err != nil {
@@ -92,6 +119,23 @@ func (u *User) ResetFailedLoginCount() {
 	u.UnlockAccount()
 }
 
+// ClaimTOTPStep records step as the last TOTP time step the user authenticated with, reporting
+// false when that step or a later one was already accepted. The update is conditional so that
+// two requests racing with the same code cannot both succeed.
+func (u *User) ClaimTOTPStep(db *gorm.DB, step int64) (bool, error) {
+	result := db.Model(&User{}).
+		Where("id = ? AND (mfa_last_step IS NULL OR mfa_last_step < ?)", u.ID, step).
+		Update("mfa_last_step", step)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return false, nil
+	}
+	u.MFALastStep = &step
+	return true, nil
+}
+
 // RegisterRequest represents the request body for user registration
 type RegisterRequest struct {
 	Email     string `json:"email" binding:"required,email"`
@@ -105,3 +149,12 @@ type RegisterResponse struct {
 	Message string `json:"message"`
 	UserID  string `json:"user_id"`
 }
+
+// UpdateProfileRequest lists the profile fields a user may change. Fields left out of the
+// request keep their current value. UpdatedAt, when set, must match the stored profile so
+// that concurrent edits are rejected instead of overwriting each other.
+type UpdateProfileRequest struct {
+	FirstName *string    `json:"first_name"`
+	LastName  *string    `json:"last_name"`
+	UpdatedAt *time.Time `json:"updated_at"`
+}
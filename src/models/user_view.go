@@ -0,0 +1,89 @@
+package models
+
+import "time"
+
+// UserVisibility decides how much of a user record a caller gets to see
+type UserVisibility int
+
+const (
+	// VisibilityPublic is for anyone other than the user themselves
+	VisibilityPublic UserVisibility = iota
+	// VisibilitySelf is for the user looking at their own account
+	VisibilitySelf
+	// VisibilityAdmin is for callers holding users:read, and adds account state needed for support
+	VisibilityAdmin
+)
+
+// PublicUser is the profile any caller allowed to look a user up may see
+type PublicUser struct {
+	ID        uint   `json:"id"`
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+}
+
+// SelfUser is what users see about their own account
+type SelfUser struct {
+	PublicUser
+	Email           string     `json:"email"`
+	IsEmailVerified bool       `json:"is_email_verified"`
+	MFAEnabled      bool       `json:"mfa_enabled"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+	LastLoginAt     *time.Time `json:"last_login_at"`
+}
+
+// AdminUser adds the lockout and verification state of the account. Credentials and MFA
+// secrets are never part of any view.
+type AdminUser struct {
+	SelfUser
+	EmailVerifiedAt  *time.Time `json:"email_verified_at"`
+	MFAEnabledAt     *time.Time `json:"mfa_enabled_at"`
+	FailedLoginCount int        `json:"failed_login_count"`
+	LockedUntil      *time.Time `json:"locked_until"`
+	Locked           bool       `json:"locked"`
+	TokensValidAfter *time.Time `json:"tokens_valid_after"`
+}
+
+func (u *User) PublicView() PublicUser {
+	return PublicUser{
+		ID:        u.ID,
+		FirstName: u.FirstName,
+		LastName:  u.LastName,
+	}
+}
+
+func (u *User) SelfView() SelfUser {
+	return SelfUser{
+		PublicUser:      u.PublicView(),
+		Email:           u.Email,
+		IsEmailVerified: u.IsEmailVerified,
+		MFAEnabled:      u.MFAEnabled,
+		CreatedAt:       u.CreatedAt,
+		UpdatedAt:       u.UpdatedAt,
+		LastLoginAt:     u.LastLoginAt,
+	}
+}
+
+func (u *User) AdminView() AdminUser {
+	return AdminUser{
+		SelfUser:         u.SelfView(),
+		EmailVerifiedAt:  u.EmailVerifiedAt,
+		MFAEnabledAt:     u.MFAEnabledAt,
+		FailedLoginCount: u.FailedLoginCount,
+		LockedUntil:      u.LockedUntil,
+		Locked:           u.IsAccountLocked(),
+		TokensValidAfter: u.TokensValidAfter,
+	}
+}
+
+// View returns the representation of the user matching the given visibility
+func (u *User) View(visibility UserVisibility) interface{} {
+	switch visibility {
+	case VisibilityAdmin:
+		return u.AdminView()
+	case VisibilitySelf:
+		return u.SelfView()
+	default:
+		return u.PublicView()
+	}
+}
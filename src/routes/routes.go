@@ -1,43 +1,62 @@
 package routes
 
 import (
+	"go-auth-system/src/config"
 	"go-auth-system/src/handlers"
 	"go-auth-system/src/middleware"
+	"go-auth-system/src/models"
+	"go-auth-system/src/services"
 	"go-auth-system/src/utils"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
 )
 
-func SetupRoutes(router *gin.Engine, db *gorm.DB) {
+// SetupRoutes registers every endpoint. The store is shared by all handlers and middleware.
+func SetupRoutes(router *gin.Engine, db *gorm.DB, store services.TokenStore, providers *services.ProviderRegistry) {
 	// Initialize handlers
-	authHandler := handlers.NewAuthHandler(db)
+	authHandler := handlers.NewAuthHandler(db, store)
+	socialHandler := handlers.NewSocialAuthHandler(authHandler, providers, store.SocialStates())
 	userHandler := handlers.NewUserHandler(db)
-	rateLimiter := middleware.NewRateLimiter()
+	adminHandler := handlers.NewAdminHandler(db)
+	wellKnownHandler := handlers.NewWellKnownHandler()
+	oidcHandler := handlers.NewOIDCHandler(db, store)
+	healthHandler := handlers.NewHealthHandler(store)
+	rateLimiter := middleware.NewRateLimiter(store, config.GetRateLimits())
 
 	// Health check endpoint
-	router.GET("/health", func(c *gin.Context) {
-		c.JSON(200, gin.H{"status": "healthy"})
-	})
+	router.GET("/health", healthHandler.Health)
 
 	// Welcome endpoint
 	router.GET("/", func(c *gin.Context) {
 		c.JSON(200, gin.H{"message": "welcome to authorization system"})
 	})
 
+	// Public signing keys for token verification
+	router.GET("/.well-known/jwks.json", wellKnownHandler.JWKS)
+
+	// OpenID Connect discovery and token endpoint (clients authenticate themselves, no CSRF)
+	router.GET("/.well-known/openid-configuration", wellKnownHandler.OpenIDConfiguration)
+	router.POST("/oauth/token", rateLimiter.Limit(config.RateLimitOAuth), oidcHandler.Token)
+	router.POST("/oauth/introspect", rateLimiter.Limit(config.RateLimitOAuth), oidcHandler.Introspect)
+	router.POST("/oauth/revoke", rateLimiter.Limit(config.RateLimitOAuth), authHandler.Revoke)
+
 	// CSRF token endpoint
 	router.GET("/csrf-token", func(c *gin.Context) {
-		token := utils.GenerateCSRFToken()
-		// Set the CSRF token as a cookie
-		c.SetCookie("csrf_token", token, 3600, "/", "", false, true)
-		c.JSON(200, gin.H{"csrf_token": token})
+		// The token is bound to a CSRF session cookie, which is set if the caller has none yet
+		token, err := middleware.NewCSRFToken(c)
+		if err != nil {
+			c.JSON(500, gin.H{"error": "Could not generate CSRF token"})
+			return
+		}
+		c.JSON(200, gin.H{"csrf_token": token, "expires_in": int(utils.CSRFTokenTTL.Seconds())})
 	})
 
 	// Public routes with rate limiting
 	publicGroup := router.Group("/")
 	{
 		// General rate limiting for all public endpoints
-		publicGroup.Use(rateLimiter.RateLimitByIP(100, 15*60)) // 100 requests per 15 minutes per IP
+		publicGroup.Use(rateLimiter.Limit(config.RateLimitPublic))
 
 		// Auth routes
 		authGroup := publicGroup.Group("/auth")
@@ -45,26 +64,46 @@ func SetupRoutes(router *gin.Engine, db *gorm.DB) {
 			// Routes that don't need CSRF protection (GET requests)
 			authGroup.GET("/verify", authHandler.VerifyEmail)
 
+			// Social login; the OAuth state parameter protects the callback instead of a CSRF token
+			authGroup.GET("/oauth/providers", socialHandler.ListProviders)
+			authGroup.GET("/oauth/:provider/login", socialHandler.Login)
+			authGroup.GET("/oauth/:provider/callback",
+				rateLimiter.Limit(config.RateLimitLogin), // Social logins share the login attempt budget
+				socialHandler.Callback)
+
 			// Routes that need CSRF protection
 			csrfGroup := authGroup.Group("/")
 			csrfGroup.Use(middleware.CSRFProtection())
 			{
 				csrfGroup.POST("/register", authHandler.Register)
-				csrfGroup.POST("/login",
-					rateLimiter.LoginRateLimit(5, 15*60), // 5 login attempts per 15 minutes
-					authHandler.Login)
+				csrfGroup.POST("/login", rateLimiter.Limit(config.RateLimitLogin), authHandler.Login)
+				csrfGroup.POST("/mfa/verify",
+					rateLimiter.Limit(config.RateLimitLogin), // MFA codes share the login attempt budget
+					authHandler.VerifyMFA)
 				csrfGroup.POST("/refresh", authHandler.RefreshToken)
-				csrfGroup.POST("/password/forgot",
-					rateLimiter.PasswordResetRateLimit(3, 60*60), // 3 password reset attempts per hour
-					authHandler.ForgotPassword)
+				csrfGroup.POST("/password/forgot", rateLimiter.Limit(config.RateLimitPasswordReset), authHandler.ForgotPassword)
 				csrfGroup.POST("/password/reset", authHandler.ResetPassword)
 			}
 		}
 	}
 
-	// Protected routes
+	// Service-to-service routes for machine tokens (client_credentials grant). Scopes play the
+	// part of permissions, so a client needs e.g. users:read among its allowed scopes.
+	serviceGroup := router.Group("/service", middleware.AuthMiddleware(store), middleware.RequireClient())
+	{
+		serviceGroup.GET("/users/:id", middleware.RequireScope(models.PermissionUsersRead), adminHandler.GetUser)
+	}
+
+	// The only route that accepts user tokens issued to OAuth clients
+	userInfoGroup := router.Group("/userinfo", middleware.AuthMiddleware(store), middleware.RequireScope("openid"))
+	{
+		userInfoGroup.GET("", oidcHandler.UserInfo)
+		userInfoGroup.POST("", oidcHandler.UserInfo)
+	}
+
+	// Protected routes, for first-party user tokens only, limited per user
 	protectedGroup := router.Group("/")
-	protectedGroup.Use(middleware.AuthMiddleware())
+	protectedGroup.Use(middleware.AuthMiddleware(store), middleware.RequireUser(), rateLimiter.Limit(config.RateLimitAccount))
 	{
 		// Authenticated "me" endpoint
 		protectedGroup.GET("/auth/me", authHandler.Me)
@@ -72,11 +111,48 @@ func SetupRoutes(router *gin.Engine, db *gorm.DB) {
 		// Logout endpoint (requires authentication)
 		protectedGroup.POST("/auth/logout", authHandler.Logout)
 
+		// OpenID Connect authorization for the logged-in user; browsers need a cookie session
+		protectedGroup.GET("/oauth/authorize", oidcHandler.Authorize)
+
+		// Devices the user is logged in on
+		protectedGroup.GET("/auth/sessions", authHandler.ListSessions)
+		protectedGroup.DELETE("/auth/sessions/:id", authHandler.RevokeSession)
+		protectedGroup.POST("/auth/sessions/revoke-others", authHandler.RevokeOtherSessions)
+
+		// MFA enrollment
+		protectedGroup.POST("/auth/mfa/enroll", authHandler.EnrollMFA)
+		protectedGroup.POST("/auth/mfa/confirm", authHandler.ConfirmMFA)
+		protectedGroup.POST("/auth/mfa/recovery-codes", authHandler.RegenerateRecoveryCodes)
+
+		// Linked external identities
+		protectedGroup.POST("/auth/oauth/:provider/link", socialHandler.Link)
+		protectedGroup.GET("/auth/identities", socialHandler.ListIdentities)
+		protectedGroup.DELETE("/auth/identities/:id", socialHandler.UnlinkIdentity)
+
 		// User routes
 		userGroup := protectedGroup.Group("/user")
 		{
-			userGroup.GET("/profile/:id", userHandler.GetUser)
-			userGroup.PUT("/update/:id", userHandler.UpdateUser)
+			userGroup.GET("/profile/:id",
+				middleware.RequireSelfOrPermission("id", models.PermissionUsersRead),
+				userHandler.GetUser)
+			userGroup.PATCH("/profile/:id",
+				middleware.RequireSelfOrPermission("id", models.PermissionUsersWrite),
+				userHandler.UpdateUser)
+			// Kept for existing clients; behaves like the PATCH route
+			userGroup.PUT("/update/:id",
+				middleware.RequireSelfOrPermission("id", models.PermissionUsersWrite),
+				userHandler.UpdateUser)
+		}
+
+		// Role management
+		adminGroup := protectedGroup.Group("/admin")
+		{
+			adminGroup.GET("/roles", middleware.RequirePermission(models.PermissionRolesRead), adminHandler.ListRoles)
+			adminGroup.GET("/users/:id", middleware.RequirePermission(models.PermissionUsersRead), adminHandler.GetUser)
+			adminGroup.GET("/users/:id/roles", middleware.RequirePermission(models.PermissionRolesRead), adminHandler.GetUserRoles)
+			adminGroup.POST("/users/:id/revoke-tokens", middleware.RequirePermission(models.PermissionUsersWrite), adminHandler.RevokeUserTokens)
+			adminGroup.POST("/users/:id/roles", middleware.RequirePermission(models.PermissionRolesWrite), adminHandler.AssignUserRole)
+			adminGroup.DELETE("/users/:id/roles/:role", middleware.RequirePermission(models.PermissionRolesWrite), adminHandler.RemoveUserRole)
 		}
 
 	}
@@ -0,0 +1,90 @@
+package services
+
+import "time"
+
+// BreakerStore guards a TokenStore with a circuit breaker. While the breaker is open every call
+// fails straight away with ErrCircuitOpen, and the failure policies decide what that means for
+// the request, instead of each request waiting on an unreachable Redis.
+type BreakerStore struct {
+	store   TokenStore
+	breaker *CircuitBreaker
+}
+
+func NewBreakerStore(store TokenStore, breaker *CircuitBreaker) *BreakerStore {
+	return &BreakerStore{store: store, breaker: breaker}
+}
+
+// Health reports the breaker state; the store is degraded while its last call failed
+func (s *BreakerStore) Health() BreakerStatus {
+	return s.breaker.Status()
+}
+
+func (s *BreakerStore) BlacklistToken(token string, expiration time.Duration) error {
+	return s.breaker.Do(func() error {
+		return s.store.BlacklistToken(token, expiration)
+	})
+}
+
+func (s *BreakerStore) IsTokenBlacklisted(token string) (blacklisted bool, err error) {
+	err = s.breaker.Do(func() error {
+		blacklisted, err = s.store.IsTokenBlacklisted(token)
+		return err
+	})
+	return blacklisted, err
+}
+
+func (s *BreakerStore) RevokeSession(sessionID string, expiration time.Duration) error {
+	return s.breaker.Do(func() error {
+		return s.store.RevokeSession(sessionID, expiration)
+	})
+}
+
+func (s *BreakerStore) IsSessionRevoked(sessionID string) (revoked bool, err error) {
+	err = s.breaker.Do(func() error {
+		revoked, err = s.store.IsSessionRevoked(sessionID)
+		return err
+	})
+	return revoked, err
+}
+
+func (s *BreakerStore) DeleteUserSession(userID uint) error {
+	return s.breaker.Do(func() error {
+		return s.store.DeleteUserSession(userID)
+	})
+}
+
+func (s *BreakerStore) AllowRequest(key string, limit RateLimit, now time.Time) (result RateLimitResult, err error) {
+	err = s.breaker.Do(func() error {
+		result, err = s.store.AllowRequest(key, limit, now)
+		return err
+	})
+	return result, err
+}
+
+// SocialStates shares the breaker, since the states live on the same server
+func (s *BreakerStore) SocialStates() SocialStateStore {
+	return breakerSocialStateStore{states: s.store.SocialStates(), breaker: s.breaker}
+}
+
+func (s *BreakerStore) Close() error {
+	return s.store.Close()
+}
+
+type breakerSocialStateStore struct {
+	states  SocialStateStore
+	breaker *CircuitBreaker
+}
+
+func (b breakerSocialStateStore) Save(state string, data SocialLoginState, expiration time.Duration) error {
+	return b.breaker.Do(func() error {
+		return b.states.Save(state, data, expiration)
+	})
+}
+
+func (b breakerSocialStateStore) Consume(state string) (data *SocialLoginState, err error) {
+	err = b.breaker.Do(func() error {
+		data, err = b.states.Consume(state)
+		return err
+	})
+	return data, err
+}
@@ -0,0 +1,400 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go-auth-system/src/config"
+	"go-auth-system/src/utils"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// jwksRefreshInterval bounds how often an unknown kid may trigger a refetch of a provider's keys
+const jwksRefreshInterval = time.Minute
+
+// ExternalIdentity is the user as asserted by an upstream identity provider
+type ExternalIdentity struct {
+	Provider      string
+	Subject       string
+	Email         string
+	EmailVerified bool
+	GivenName     string
+	FamilyName    string
+}
+
+// providerEndpoints are either configured explicitly or discovered from the issuer
+type providerEndpoints struct {
+	Issuer      string `json:"issuer"`
+	AuthURL     string `json:"authorization_endpoint"`
+	TokenURL    string `json:"token_endpoint"`
+	UserInfoURL string `json:"userinfo_endpoint"`
+	JWKSURL     string `json:"jwks_uri"`
+}
+
+// IdentityProvider runs the authorization code flow against a single upstream provider. OIDC
+// providers are discovered lazily and their ID tokens verified against the published JWKS;
+// plain OAuth2 providers are identified through their userinfo endpoint.
+type IdentityProvider struct {
+	config     config.OAuthProviderConfig
+	httpClient *http.Client
+
+	mu            sync.Mutex
+	endpoints     *providerEndpoints
+	keys          map[string]*utils.SigningKey
+	keysFetchedAt time.Time
+}
+
+// ProviderRegistry holds the identity providers users can sign in with, keyed by name
+type ProviderRegistry struct {
+	providers map[string]*IdentityProvider
+}
+
+// NewProviderRegistry validates the provider settings. A nil httpClient uses a client with a short timeout.
+func NewProviderRegistry(configs []config.OAuthProviderConfig, httpClient *http.Client) (*ProviderRegistry, error) {
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	registry := &ProviderRegistry{providers: make(map[string]*IdentityProvider)}
+	for _, cfg := range configs {
+		if cfg.ClientID == "" {
+			return nil, fmt.Errorf("oauth provider %s: client id is required", cfg.Name)
+		}
+		if cfg.Issuer == "" && (cfg.AuthURL == "" || cfg.TokenURL == "" || cfg.UserInfoURL == "") {
+			return nil, fmt.Errorf("oauth provider %s: either an issuer or auth, token and userinfo URLs are required", cfg.Name)
+		}
+		if _, exists := registry.providers[cfg.Name]; exists {
+			return nil, fmt.Errorf("oauth provider %s is configured twice", cfg.Name)
+		}
+		registry.providers[cfg.Name] = &IdentityProvider{config: cfg, httpClient: httpClient}
+	}
+	return registry, nil
+}
+
+func (r *ProviderRegistry) Get(name string) (*IdentityProvider, bool) {
+	provider, ok := r.providers[name]
+	return provider, ok
+}
+
+// Names returns the configured provider names in a stable order
+func (r *ProviderRegistry) Names() []string {
+	names := make([]string, 0, len(r.providers))
+	for name := range r.providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (p *IdentityProvider) Name() string {
+	return p.config.Name
+}
+
+// IsOIDC reports whether the provider issues ID tokens
+func (p *IdentityProvider) IsOIDC() bool {
+	return p.config.Issuer != ""
+}
+
+// AuthCodeURL builds the URL the browser is sent to. The nonce is only meaningful for OIDC
+// providers; the PKCE challenge is always sent since providers ignore it when unsupported.
+func (p *IdentityProvider) AuthCodeURL(ctx context.Context, state, nonce, codeChallenge string) (string, error) {
+	endpoints, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	params := url.Values{}
+	params.Set("response_type", "code")
+	params.Set("client_id", p.config.ClientID)
+	params.Set("redirect_uri", p.config.RedirectURL)
+	params.Set("scope", strings.Join(p.config.Scopes, " "))
+	params.Set("state", state)
+	params.Set("code_challenge", codeChallenge)
+	params.Set("code_challenge_method", "S256")
+	if p.IsOIDC() {
+		params.Set("nonce", nonce)
+	}
+
+	separator := "?"
+	if strings.Contains(endpoints.AuthURL, "?") {
+		separator = "&"
+	}
+	return endpoints.AuthURL + separator + params.Encode(), nil
+}
+
+// Exchange redeems the authorization code and returns the identity it was issued for
+func (p *IdentityProvider) Exchange(ctx context.Context, code, codeVerifier, nonce string) (*ExternalIdentity, error) {
+	endpoints, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.config.RedirectURL)
+	form.Set("code_verifier", codeVerifier)
+	form.Set("client_id", p.config.ClientID)
+	form.Set("client_secret", p.config.ClientSecret)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoints.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	var tokens struct {
+		AccessToken string `json:"access_token"`
+		IDToken     string `json:"id_token"`
+		Error       string `json:"error"`
+	}
+	if err := p.doJSON(req, &tokens); err != nil {
+		return nil, fmt.Errorf("token exchange failed: %w", err)
+	}
+	if tokens.Error != "" {
+		return nil, fmt.Errorf("token exchange failed: %s", tokens.Error)
+	}
+
+	if p.IsOIDC() {
+		if tokens.IDToken == "" {
+			return nil, errors.New("provider did not return an id_token")
+		}
+		return p.verifyIDToken(ctx, endpoints, tokens.IDToken, nonce)
+	}
+
+	if tokens.AccessToken == "" {
+		return nil, errors.New("provider did not return an access_token")
+	}
+	return p.fetchUserInfo(ctx, endpoints, tokens.AccessToken)
+}
+
+func (p *IdentityProvider) verifyIDToken(ctx context.Context, endpoints *providerEndpoints, rawIDToken, nonce string) (*ExternalIdentity, error) {
+	claims := &utils.IDTokenClaims{}
+	_, err := jwt.ParseWithClaims(rawIDToken, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		key, err := p.signingKey(ctx, endpoints, kid)
+		if err != nil {
+			return nil, err
+		}
+		// As with our own tokens, the key decides the algorithm
+		if token.Method.Alg() != key.Method.Alg() {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return key.PublicKey, nil
+	},
+		jwt.WithIssuer(endpoints.Issuer),
+		jwt.WithAudience(p.config.ClientID),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("invalid id_token: %w", err)
+	}
+
+	if claims.Nonce == "" || claims.Nonce != nonce {
+		return nil, errors.New("invalid id_token: nonce mismatch")
+	}
+	if claims.Subject == "" {
+		return nil, errors.New("invalid id_token: missing subject")
+	}
+
+	identity := &ExternalIdentity{
+		Provider:   p.config.Name,
+		Subject:    claims.Subject,
+		Email:      claims.Email,
+		GivenName:  claims.GivenName,
+		FamilyName: claims.FamilyName,
+	}
+	if claims.EmailVerified != nil {
+		identity.EmailVerified = *claims.EmailVerified
+	}
+	if identity.GivenName == "" && identity.FamilyName == "" {
+		identity.GivenName, identity.FamilyName = splitName(claims.Name)
+	}
+	return identity, nil
+}
+
+// fetchUserInfo identifies the user of a plain OAuth2 provider, accepting both the OIDC
+// userinfo claim names and the GitHub style "id"/"name" fields
+func (p *IdentityProvider) fetchUserInfo(ctx context.Context, endpoints *providerEndpoints, accessToken string) (*ExternalIdentity, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoints.UserInfoURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	req.Header.Set("Accept", "application/json")
+
+	var info map[string]interface{}
+	if err := p.doJSON(req, &info); err != nil {
+		return nil, fmt.Errorf("userinfo request failed: %w", err)
+	}
+
+	identity := &ExternalIdentity{Provider: p.config.Name}
+	switch id := firstPresent(info, "sub", "id").(type) {
+	case string:
+		identity.Subject = id
+	case float64:
+		identity.Subject = strconv.FormatFloat(id, 'f', -1, 64)
+	}
+	if identity.Subject == "" {
+		return nil, errors.New("userinfo response has no subject")
+	}
+
+	identity.Email, _ = info["email"].(string)
+	identity.EmailVerified, _ = firstPresent(info, "email_verified", "verified_email").(bool)
+	identity.GivenName, _ = info["given_name"].(string)
+	identity.FamilyName, _ = info["family_name"].(string)
+	if identity.GivenName == "" && identity.FamilyName == "" {
+		name, _ := info["name"].(string)
+		identity.GivenName, identity.FamilyName = splitName(name)
+	}
+	return identity, nil
+}
+
+// discover resolves the provider endpoints, fetching the OIDC discovery document on first use
+func (p *IdentityProvider) discover(ctx context.Context) (*providerEndpoints, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.endpoints != nil {
+		return p.endpoints, nil
+	}
+
+	endpoints := &providerEndpoints{
+		AuthURL:     p.config.AuthURL,
+		TokenURL:    p.config.TokenURL,
+		UserInfoURL: p.config.UserInfoURL,
+	}
+
+	if p.IsOIDC() {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.config.Issuer+"/.well-known/openid-configuration", nil)
+		if err != nil {
+			return nil, err
+		}
+
+		var discovered providerEndpoints
+		if err := p.doJSON(req, &discovered); err != nil {
+			return nil, fmt.Errorf("oidc discovery for %s failed: %w", p.config.Name, err)
+		}
+		if strings.TrimRight(discovered.Issuer, "/") != p.config.Issuer {
+			return nil, fmt.Errorf("oidc discovery for %s returned issuer %q", p.config.Name, discovered.Issuer)
+		}
+
+		// Explicitly configured endpoints win over discovered ones
+		endpoints.Issuer = discovered.Issuer
+		endpoints.JWKSURL = discovered.JWKSURL
+		if endpoints.AuthURL == "" {
+			endpoints.AuthURL = discovered.AuthURL
+		}
+		if endpoints.TokenURL == "" {
+			endpoints.TokenURL = discovered.TokenURL
+		}
+		if endpoints.UserInfoURL == "" {
+			endpoints.UserInfoURL = discovered.UserInfoURL
+		}
+		if endpoints.AuthURL == "" || endpoints.TokenURL == "" || endpoints.JWKSURL == "" {
+			return nil, fmt.Errorf("oidc discovery for %s is missing required endpoints", p.config.Name)
+		}
+	}
+
+	p.endpoints = endpoints
+	return endpoints, nil
+}
+
+// signingKey returns the provider key for kid, refetching the JWKS when an unknown kid shows up
+// so that provider-side key rotation is picked up without a restart
+func (p *IdentityProvider) signingKey(ctx context.Context, endpoints *providerEndpoints, kid string) (*utils.SigningKey, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if key, ok := p.lookupKey(kid); ok {
+		return key, nil
+	}
+	if time.Since(p.keysFetchedAt) < jwksRefreshInterval {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoints.JWKSURL, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var jwks utils.JWKS
+	if err := p.doJSON(req, &jwks); err != nil {
+		return nil, fmt.Errorf("fetching jwks failed: %w", err)
+	}
+
+	keys := make(map[string]*utils.SigningKey)
+	for _, jwk := range jwks.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		// Keys we cannot use are skipped rather than failing the whole set
+		if key, err := utils.ParseJWK(jwk); err == nil {
+			keys[key.ID] = key
+		}
+	}
+	p.keys = keys
+	p.keysFetchedAt = time.Now()
+
+	if key, ok := p.lookupKey(kid); ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+// lookupKey finds a key by kid; tokens without a kid are only accepted from single-key providers
+func (p *IdentityProvider) lookupKey(kid string) (*utils.SigningKey, bool) {
+	if kid == "" && len(p.keys) == 1 {
+		for _, key := range p.keys {
+			return key, true
+		}
+	}
+	key, ok := p.keys[kid]
+	return key, ok
+}
+
+func (p *IdentityProvider) doJSON(req *http.Request, dest interface{}) error {
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return json.Unmarshal(body, dest)
+}
+
+func firstPresent(values map[string]interface{}, keys ...string) interface{} {
+	for _, key := range keys {
+		if value, ok := values[key]; ok && value != nil {
+			return value
+		}
+	}
+	return nil
+}
+
+func splitName(name string) (string, string) {
+	parts := strings.Fields(name)
+	if len(parts) == 0 {
+		return "", ""
+	}
+	return parts[0], strings.Join(parts[1:], " ")
+}
@@ -0,0 +1,237 @@
+package services
+
+import (
+	"hash/fnv"
+	"sync"
+	"time"
+)
+
+const (
+	// MemoryStoreJanitorInterval is how often expired entries are swept from a MemoryStore
+	MemoryStoreJanitorInterval = time.Minute
+
+	memoryStoreShards = 32
+)
+
+// MemoryStore is an in-process TokenStore for local development, single-instance deployments
+// and tests. Keys are spread over shards with their own lock so concurrent requests rarely
+// contend. Expired entries are ignored on read and swept by a janitor goroutine. The state is
+// lost on restart and not shared between instances.
+type MemoryStore struct {
+	shards [memoryStoreShards]memoryShard
+	stop   chan struct{}
+	once   sync.Once
+}
+
+type memoryShard struct {
+	mu      sync.Mutex
+	entries map[string]memoryEntry
+}
+
+type memoryEntry struct {
+	value     interface{}
+	expiresAt time.Time
+}
+
+func (e memoryEntry) expired(now time.Time) bool {
+	return !e.expiresAt.IsZero() && !now.Before(e.expiresAt)
+}
+
+// NewMemoryStore creates the store and starts its janitor, which runs until Close
+func NewMemoryStore(janitorInterval time.Duration) *MemoryStore {
+	s := &MemoryStore{stop: make(chan struct{})}
+	for i := range s.shards {
+		s.shards[i].entries = make(map[string]memoryEntry)
+	}
+
+	go s.janitor(janitorInterval)
+	return s
+}
+
+func (s *MemoryStore) janitor(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.sweep()
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+// sweep removes every expired entry, one shard at a time
+func (s *MemoryStore) sweep() {
+	now := time.Now()
+	for i := range s.shards {
+		shard := &s.shards[i]
+		shard.mu.Lock()
+		for key, entry := range shard.entries {
+			if entry.expired(now) {
+				delete(shard.entries, key)
+			}
+		}
+		shard.mu.Unlock()
+	}
+}
+
+func (s *MemoryStore) shard(key string) *memoryShard {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return &s.shards[h.Sum32()%memoryStoreShards]
+}
+
+// set stores a value; a zero or negative expiration keeps it until deleted
+func (s *MemoryStore) set(key string, value interface{}, expiration time.Duration) {
+	entry := memoryEntry{value: value}
+	if expiration > 0 {
+		entry.expiresAt = time.Now().Add(expiration)
+	}
+
+	shard := s.shard(key)
+	shard.mu.Lock()
+	shard.entries[key] = entry
+	shard.mu.Unlock()
+}
+
+func (s *MemoryStore) get(key string) (interface{}, bool) {
+	shard := s.shard(key)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	entry, ok := shard.entries[key]
+	if !ok || entry.expired(time.Now()) {
+		return nil, false
+	}
+	return entry.value, true
+}
+
+// take returns the value and removes it in one step, like the Redis GET+DEL transaction
+func (s *MemoryStore) take(key string) (interface{}, bool) {
+	shard := s.shard(key)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	entry, ok := shard.entries[key]
+	delete(shard.entries, key)
+	if !ok || entry.expired(time.Now()) {
+		return nil, false
+	}
+	return entry.value, true
+}
+
+func (s *MemoryStore) delete(key string) {
+	shard := s.shard(key)
+	shard.mu.Lock()
+	delete(shard.entries, key)
+	shard.mu.Unlock()
+}
+
+// BlacklistToken blacklists a token until it expires
+func (s *MemoryStore) BlacklistToken(token string, expiration time.Duration) error {
+	s.set("blacklist:"+token, true, expiration)
+	return nil
+}
+
+func (s *MemoryStore) IsTokenBlacklisted(token string) (bool, error) {
+	_, ok := s.get("blacklist:" + token)
+	return ok, nil
+}
+
+// RevokeSession marks a login session as ended, so its access tokens stop working before they expire
+func (s *MemoryStore) RevokeSession(sessionID string, expiration time.Duration) error {
+	s.set("revoked_session:"+sessionID, true, expiration)
+	return nil
+}
+
+func (s *MemoryStore) IsSessionRevoked(sessionID string) (bool, error) {
+	_, ok := s.get("revoked_session:" + sessionID)
+	return ok, nil
+}
+
+// DeleteUserSession is a no-op; cached user sessions only exist in Redis deployments
+func (s *MemoryStore) DeleteUserSession(userID uint) error {
+	return nil
+}
+
+// AllowRequest counts a request under the shard lock, which makes it atomic like the Redis scripts
+func (s *MemoryStore) AllowRequest(key string, limit RateLimit, now time.Time) (RateLimitResult, error) {
+	if err := limit.Validate(); err != nil {
+		return RateLimitResult{}, err
+	}
+	shard := s.shard(key)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	entry, ok := shard.entries[key]
+	if ok && entry.expired(now) {
+		ok = false
+	}
+
+	var result RateLimitResult
+	switch limit.Strategy {
+	case SlidingLog:
+		var log []time.Time
+		if ok {
+			log = entry.value.([]time.Time)
+		}
+		log, result = slidingLogAllow(log, limit, now)
+		entry.value = log
+	case TokenBucket:
+		var bucket *tokenBucket
+		if ok {
+			state := entry.value.(tokenBucket)
+			bucket = &state
+		}
+		entry.value, result = tokenBucketAllow(bucket, limit, now)
+	}
+
+	// The entry is kept until the full limit would be available again anyway
+	entry.expiresAt = now.Add(result.Reset)
+	shard.entries[key] = entry
+	return result, nil
+}
+
+// SocialStates keeps social login state in the same store
+func (s *MemoryStore) SocialStates() SocialStateStore {
+	return memorySocialStateStore{store: s}
+}
+
+// Len returns the number of entries held, including expired ones the janitor has not swept yet
+func (s *MemoryStore) Len() int {
+	total := 0
+	for i := range s.shards {
+		shard := &s.shards[i]
+		shard.mu.Lock()
+		total += len(shard.entries)
+		shard.mu.Unlock()
+	}
+	return total
+}
+
+// Close stops the janitor
+func (s *MemoryStore) Close() error {
+	s.once.Do(func() { close(s.stop) })
+	return nil
+}
+
+type memorySocialStateStore struct {
+	store *MemoryStore
+}
+
+func (m memorySocialStateStore) Save(state string, data SocialLoginState, expiration time.Duration) error {
+	m.store.set("oauth_state:"+state, data, expiration)
+	return nil
+}
+
+// Consume removes the state as it reads it, so a replayed callback finds nothing
+func (m memorySocialStateStore) Consume(state string) (*SocialLoginState, error) {
+	value, ok := m.store.take("oauth_state:" + state)
+	if !ok {
+		return nil, nil
+	}
+	data := value.(SocialLoginState)
+	return &data, nil
+}
@@ -0,0 +1,186 @@
+package services
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// RateLimitStrategy is the algorithm a rate limit counts requests with
+type RateLimitStrategy string
+
+const (
+	// SlidingLog remembers the time of every accepted request and allows Limit of them in any
+	// Window, so there is no boundary at which a client gets to spend two windows at once.
+	SlidingLog RateLimitStrategy = "sliding-log"
+
+	// TokenBucket holds up to Limit tokens and refills them evenly over Window. It allows short
+	// bursts of up to Limit requests and then a steady rate of Limit per Window.
+	TokenBucket RateLimitStrategy = "token-bucket"
+)
+
+// RateLimit allows Limit requests per Window, counted with Strategy
+type RateLimit struct {
+	Strategy RateLimitStrategy
+	Limit    int
+	Window   time.Duration
+}
+
+// Validate rejects limits the strategies cannot count
+func (l RateLimit) Validate() error {
+	switch l.Strategy {
+	case SlidingLog, TokenBucket:
+	default:
+		return fmt.Errorf("unknown rate limit strategy %q", l.Strategy)
+	}
+	if l.Limit < 1 || l.Window <= 0 {
+		return fmt.Errorf("rate limit needs a positive limit and window, got %d per %s", l.Limit, l.Window)
+	}
+	return nil
+}
+
+// windowMillis is the window in the milliseconds the stores count in, at least one
+func (l RateLimit) windowMillis() int64 {
+	if ms := l.Window.Milliseconds(); ms > 0 {
+		return ms
+	}
+	return 1
+}
+
+// RateLimitResult is the outcome of counting one request
+type RateLimitResult struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// RetryAfter is how long a rejected client has to wait before a request is allowed again
+	RetryAfter time.Duration
+	// Reset is how long until the full limit is available again
+	Reset time.Duration
+}
+
+// slidingLogAllow counts a request against the log of accepted request times and returns the
+// updated log. Rejected requests are not logged, so a client that backs off recovers.
+func slidingLogAllow(log []time.Time, limit RateLimit, now time.Time) ([]time.Time, RateLimitResult) {
+	window := time.Duration(limit.windowMillis()) * time.Millisecond
+
+	kept := log[:0]
+	for _, at := range log {
+		if now.Before(at.Add(window)) {
+			kept = append(kept, at)
+		}
+	}
+
+	result := RateLimitResult{Limit: limit.Limit}
+	if len(kept) < limit.Limit {
+		kept = append(kept, now)
+		result.Allowed = true
+	} else {
+		result.RetryAfter = kept[0].Add(window).Sub(now)
+	}
+	result.Remaining = max(limit.Limit-len(kept), 0)
+	if len(kept) > 0 {
+		result.Reset = kept[len(kept)-1].Add(window).Sub(now)
+	}
+	return kept, result
+}
+
+// tokenBucket is the state of a bucket: the tokens left when it was last refilled
+type tokenBucket struct {
+	tokens     float64
+	refilledAt time.Time
+}
+
+// tokenBucketAllow refills the bucket for the time passed and takes a token for the request.
+// A nil bucket is a full one.
+func tokenBucketAllow(bucket *tokenBucket, limit RateLimit, now time.Time) (tokenBucket, RateLimitResult) {
+	// Refills multiply before dividing, so whole tokens come out exact
+	capacity := float64(limit.Limit)
+	window := float64(limit.windowMillis())
+
+	state := tokenBucket{tokens: capacity, refilledAt: now}
+	if bucket != nil {
+		state = *bucket
+		if elapsed := now.Sub(state.refilledAt); elapsed > 0 {
+			state.tokens = math.Min(capacity, state.tokens+float64(elapsed)/float64(time.Millisecond)*capacity/window)
+			state.refilledAt = now
+		}
+	}
+
+	result := RateLimitResult{Limit: limit.Limit}
+	if state.tokens >= 1 {
+		state.tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = time.Duration(math.Ceil((1-state.tokens)*window/capacity)) * time.Millisecond
+	}
+	result.Remaining = int(math.Floor(state.tokens))
+	result.Reset = time.Duration(math.Ceil((capacity-state.tokens)*window/capacity)) * time.Millisecond
+	return state, result
+}
+
+// slidingLogScript is slidingLogAllow run atomically in Redis, on a sorted set of request times
+// in milliseconds. ARGV: now, window, limit and a unique member for this request.
+const slidingLogScript = `
+local now = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local limit = tonumber(ARGV[3])
+
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', now - window)
+local count = redis.call('ZCARD', KEYS[1])
+
+local allowed = 0
+local retry = 0
+if count < limit then
+	redis.call('ZADD', KEYS[1], now, ARGV[4])
+	count = count + 1
+	allowed = 1
+else
+	local oldest = redis.call('ZRANGE', KEYS[1], 0, 0, 'WITHSCORES')
+	retry = tonumber(oldest[2]) + window - now
+end
+
+local reset = 0
+local newest = redis.call('ZRANGE', KEYS[1], -1, -1, 'WITHSCORES')
+if newest[2] then
+	reset = tonumber(newest[2]) + window - now
+	redis.call('PEXPIRE', KEYS[1], reset)
+end
+
+return {allowed, math.max(limit - count, 0), retry, reset}
+`
+
+// tokenBucketScript is tokenBucketAllow run atomically in Redis, on a hash holding the tokens
+// and the refill time in milliseconds. A full bucket is deleted, as a missing one counts as full.
+// ARGV: now, window and limit.
+const tokenBucketScript = `
+local now = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local capacity = tonumber(ARGV[3])
+
+local bucket = redis.call('HMGET', KEYS[1], 'tokens', 'refilled_at')
+local tokens = tonumber(bucket[1]) or capacity
+local refilledAt = tonumber(bucket[2]) or now
+if now > refilledAt then
+	tokens = math.min(capacity, tokens + (now - refilledAt) * capacity / window)
+	refilledAt = now
+end
+
+local allowed = 0
+local retry = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+else
+	retry = math.ceil((1 - tokens) * window / capacity)
+end
+
+local reset = math.ceil((capacity - tokens) * window / capacity)
+if reset > 0 then
+	redis.call('HMSET', KEYS[1], 'tokens', tostring(tokens), 'refilled_at', tostring(refilledAt))
+	redis.call('PEXPIRE', KEYS[1], reset)
+else
+	redis.call('DEL', KEYS[1])
+end
+
+return {allowed, math.floor(tokens), retry, reset}
+`
@@ -4,13 +4,19 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"math/rand"
+	"strconv"
 	"time"
 
+	"go-auth-system/src/config"
+
 	"github.com/go-redis/redis/v8"
 )
 
+// RedisService is the TokenStore used in deployments. One instance, and so one connection
+// pool, is shared by every handler and middleware.
 type RedisService struct {
-	client *redis.Client
+	client redis.UniversalClient
 }
 
 type SessionData struct {
@@ -21,21 +27,29 @@ type SessionData struct {
 	UserAgent string    `json:"user_agent"`
 }
 
-func NewRedisService(redisURL string) (*RedisService, error) {
-	client := redis.NewClient(&redis.Options{
-		Addr:     "cache:6379", // Use service name in Docker
-		Password: "",
-		DB:       0,
-	})
-
-	// Test connection
-	ctx := context.Background()
-	_, err := client.Ping(ctx).Result()
-	if err != nil {
-		return nil, fmt.Errorf("failed to connect to Redis: %w", err)
+// NewRedisService connects to the server, Sentinel group or cluster described by the config.
+// Connections are made lazily; use Ping to check that Redis is reachable.
+func NewRedisService(cfg config.RedisConfig) *RedisService {
+	options := cfg.Options()
+
+	var client redis.UniversalClient
+	switch {
+	case cfg.MasterName != "":
+		client = redis.NewFailoverClient(options.Failover())
+	case cfg.Cluster:
+		client = redis.NewClusterClient(options.Cluster())
+	default:
+		client = redis.NewClient(options.Simple())
 	}
+	return &RedisService{client: client}
+}
 
-	return &RedisService{client: client}, nil
+// Ping checks the connection
+func (rs *RedisService) Ping(ctx context.Context) error {
+	if err := rs.client.Ping(ctx).Err(); err != nil {
+		return fmt.Errorf("failed to connect to Redis: %w", err)
+	}
+	return nil
 }
 
 // Token Management
@@ -56,6 +70,24 @@ func (rs *RedisService) IsTokenBlacklisted(token string) (bool, error) {
 	return result == "true", nil
 }
 
+// RevokeSession marks a login session as ended, so its access tokens stop working before they expire
+func (rs *RedisService) RevokeSession(sessionID string, expiration time.Duration) error {
+	ctx := context.Background()
+	return rs.client.Set(ctx, "revoked_session:"+sessionID, "true", expiration).Err()
+}
+
+func (rs *RedisService) IsSessionRevoked(sessionID string) (bool, error) {
+	ctx := context.Background()
+	result, err := rs.client.Get(ctx, "revoked_session:"+sessionID).Result()
+	if err == redis.Nil {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return result == "true", nil
+}
+
 // Session Management
 func (rs *RedisService) StoreSession(sessionID string, sessionData SessionData, expiration time.Duration) error {
 	ctx := context.Background()
@@ -111,29 +143,52 @@ func (rs *RedisService) DeleteUserSession(userID uint) error {
 }
 
 // Rate Limiting
-func (rs *RedisService) IncrementRateLimit(key string, expiration time.Duration) (int64, error) {
-	ctx := context.Background()
 
-	// Use pipeline for atomic operations
-	pipe := rs.client.Pipeline()
-	incr := pipe.Incr(ctx, key)
-	pipe.Expire(ctx, key, expiration)
+var (
+	slidingLogRedisScript  = redis.NewScript(slidingLogScript)
+	tokenBucketRedisScript = redis.NewScript(tokenBucketScript)
+)
 
-	_, err := pipe.Exec(ctx)
-	if err != nil {
-		return 0, err
+// AllowRequest counts a request with a Lua script, so concurrent requests from every instance
+// see each other and the key always gets its expiry. Times are the caller's, in milliseconds.
+func (rs *RedisService) AllowRequest(key string, limit RateLimit, now time.Time) (RateLimitResult, error) {
+	if err := limit.Validate(); err != nil {
+		return RateLimitResult{}, err
 	}
+	ctx := context.Background()
 
-	return incr.Val(), nil
-}
+	var reply interface{}
+	var err error
+	switch limit.Strategy {
+	case SlidingLog:
+		// Requests in the same millisecond need their own member of the sorted set
+		member := strconv.FormatInt(now.UnixNano(), 36) + "-" + strconv.FormatUint(rand.Uint64(), 36)
+		reply, err = slidingLogRedisScript.Run(ctx, rs.client, []string{key}, now.UnixMilli(), limit.windowMillis(), limit.Limit, member).Result()
+	case TokenBucket:
+		reply, err = tokenBucketRedisScript.Run(ctx, rs.client, []string{key}, now.UnixMilli(), limit.windowMillis(), limit.Limit).Result()
+	}
+	if err != nil {
+		return RateLimitResult{}, err
+	}
 
-func (rs *RedisService) GetRateLimit(key string) (int64, error) {
-	ctx := context.Background()
-	result, err := rs.client.Get(ctx, key).Int64()
-	if err == redis.Nil {
-		return 0, nil
+	values, ok := reply.([]interface{})
+	if !ok || len(values) != 4 {
+		return RateLimitResult{}, fmt.Errorf("unexpected rate limit script reply %v", reply)
 	}
-	return result, err
+	fields := make([]int64, len(values))
+	for i, value := range values {
+		if fields[i], ok = value.(int64); !ok {
+			return RateLimitResult{}, fmt.Errorf("unexpected rate limit script reply %v", reply)
+		}
+	}
+
+	return RateLimitResult{
+		Allowed:    fields[0] == 1,
+		Limit:      limit.Limit,
+		Remaining:  int(fields[1]),
+		RetryAfter: time.Duration(fields[2]) * time.Millisecond,
+		Reset:      time.Duration(fields[3]) * time.Millisecond,
+	}, nil
 }
 
 // Cache Management
@@ -192,8 +247,12 @@ func (rs *RedisService) CleanupExpired() error {
 	return nil
 }
 
+// SocialStates keeps social login state on the same connection pool
+func (rs *RedisService) SocialStates() SocialStateStore {
+	return NewRedisSocialStateStore(rs.client)
+}
+
 // Close connection
 func (rs *RedisService) Close() error {
 	return rs.client.Close()
 }
-
@@ -0,0 +1,68 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// SocialLoginState is what the callback needs to finish a login started by the same browser
+type SocialLoginState struct {
+	Provider     string `json:"provider"`
+	Nonce        string `json:"nonce"`
+	CodeVerifier string `json:"code_verifier"`
+	LinkUserID   uint   `json:"link_user_id,omitempty"` // set when a logged-in user links a new identity
+}
+
+// SocialStateStore keeps in-flight social login state. Consume must return each state at most once.
+type SocialStateStore interface {
+	Save(state string, data SocialLoginState, expiration time.Duration) error
+	Consume(state string) (*SocialLoginState, error)
+}
+
+type RedisSocialStateStore struct {
+	client redis.UniversalClient
+}
+
+func NewRedisSocialStateStore(client redis.UniversalClient) *RedisSocialStateStore {
+	return &RedisSocialStateStore{client: client}
+}
+
+func (s *RedisSocialStateStore) Save(state string, data SocialLoginState, expiration time.Duration) error {
+	ctx := context.Background()
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("failed to marshal social login state: %w", err)
+	}
+
+	return s.client.Set(ctx, "oauth_state:"+state, payload, expiration).Err()
+}
+
+// Consume reads and deletes the state in one transaction, so a replayed callback finds nothing
+func (s *RedisSocialStateStore) Consume(state string) (*SocialLoginState, error) {
+	ctx := context.Background()
+	key := "oauth_state:" + state
+
+	var get *redis.StringCmd
+	_, err := s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		get = pipe.Get(ctx, key)
+		pipe.Del(ctx, key)
+		return nil
+	})
+	if err == redis.Nil {
+		return nil, nil // State not found or already used
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var data SocialLoginState
+	if err := json.Unmarshal([]byte(get.Val()), &data); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal social login state: %w", err)
+	}
+
+	return &data, nil
+}
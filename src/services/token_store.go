@@ -0,0 +1,27 @@
+package services
+
+import "time"
+
+// TokenStore holds the state that has to be shared by every instance of the service: the
+// token blacklist, revoked sessions, rate limit counters and in-flight social logins.
+// RedisService is the backend for deployments; MemoryStore keeps everything in process.
+type TokenStore interface {
+	BlacklistToken(token string, expiration time.Duration) error
+	IsTokenBlacklisted(token string) (bool, error)
+
+	RevokeSession(sessionID string, expiration time.Duration) error
+	IsSessionRevoked(sessionID string) (bool, error)
+	DeleteUserSession(userID uint) error
+
+	// AllowRequest counts a request against the limit kept under key, atomically
+	AllowRequest(key string, limit RateLimit, now time.Time) (RateLimitResult, error)
+
+	SocialStates() SocialStateStore
+
+	Close() error
+}
+
+// StoreHealthReporter is implemented by stores that know when they are degraded
+type StoreHealthReporter interface {
+	Health() BreakerStatus
+}
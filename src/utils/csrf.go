@@ -0,0 +1,103 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CSRFTokenTTL is how long a CSRF token is accepted. Clients fetch a new one from /csrf-token.
+const CSRFTokenTTL = 12 * time.Hour
+
+var (
+	ErrInvalidCSRFToken = errors.New("invalid CSRF token")
+	ErrCSRFTokenExpired = errors.New("CSRF token has expired")
+)
+
+var (
+	csrfSecretMu sync.Mutex
+	csrfSecret   []byte
+)
+
+// SetCSRFSecret sets the key CSRF tokens are signed with. Without one a random key is generated
+// on first use, so tokens only verify on the instance that issued them until the next restart.
+func SetCSRFSecret(secret []byte) {
+	csrfSecretMu.Lock()
+	defer csrfSecretMu.Unlock()
+	csrfSecret = secret
+}
+
+func currentCSRFSecret() ([]byte, error) {
+	csrfSecretMu.Lock()
+	defer csrfSecretMu.Unlock()
+	if len(csrfSecret) == 0 {
+		secret := make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return nil, err
+		}
+		csrfSecret = secret
+	}
+	return csrfSecret, nil
+}
+
+// GenerateCSRFToken issues a CSRF token for the given CSRF session. The token is
+// "<expiry>.<nonce>.<signature>", the signature being an HMAC over the session and the rest of
+// the token, so it cannot be forged or replayed for another session.
+func GenerateCSRFToken(sessionID string) (string, error) {
+	nonce, err := GenerateRandomToken(16)
+	if err != nil {
+		return "", err
+	}
+
+	payload := strconv.FormatInt(time.Now().Add(CSRFTokenTTL).Unix(), 10) + "." + nonce
+	signature, err := csrfSignature(sessionID, payload)
+	if err != nil {
+		return "", err
+	}
+	return payload + "." + signature, nil
+}
+
+// ValidateCSRFToken checks that the token was issued for the session and has not expired
+func ValidateCSRFToken(token, sessionID string) error {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 || sessionID == "" {
+		return ErrInvalidCSRFToken
+	}
+
+	payload := parts[0] + "." + parts[1]
+	expected, err := csrfSignature(sessionID, payload)
+	if err != nil {
+		return err
+	}
+	if !hmac.Equal([]byte(parts[2]), []byte(expected)) {
+		return ErrInvalidCSRFToken
+	}
+
+	expiresAt, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return ErrInvalidCSRFToken
+	}
+	if time.Now().Unix() >= expiresAt {
+		return ErrCSRFTokenExpired
+	}
+	return nil
+}
+
+func csrfSignature(sessionID, payload string) (string, error) {
+	secret, err := currentCSRFSecret()
+	if err != nil {
+		return "", err
+	}
+
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(sessionID))
+	mac.Write([]byte{0})
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil)), nil
+}
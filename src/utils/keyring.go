@@ -0,0 +1,409 @@
+package utils
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"go-auth-system/src/config"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// SigningKey is a single entry of the KeyRing, identified by its kid
+type SigningKey struct {
+	ID         string
+	Method     jwt.SigningMethod
+	PrivateKey interface{} // []byte for HMAC, *rsa.PrivateKey or ed25519.PrivateKey
+	PublicKey  interface{} // []byte for HMAC, *rsa.PublicKey or ed25519.PublicKey
+	NotAfter   time.Time   // zero for keys that do not expire
+}
+
+func (k *SigningKey) expired(now time.Time) bool {
+	return !k.NotAfter.IsZero() && now.After(k.NotAfter)
+}
+
+// KeyRing holds the active signing key and any retiring keys that are still accepted for verification
+type KeyRing struct {
+	mu     sync.RWMutex
+	active *SigningKey
+	keys   map[string]*SigningKey
+	legacy *SigningKey // verifies HS256 tokens issued before tokens carried a kid
+}
+
+func NewKeyRing(active *SigningKey) *KeyRing {
+	return &KeyRing{
+		active: active,
+		keys:   map[string]*SigningKey{active.ID: active},
+	}
+}
+
+// ActiveKey returns the key new tokens are signed with
+func (kr *KeyRing) ActiveKey() *SigningKey {
+	kr.mu.RLock()
+	defer kr.mu.RUnlock()
+	return kr.active
+}
+
+// AddRetiringKey registers a verification-only key that is accepted until notAfter
+func (kr *KeyRing) AddRetiringKey(key *SigningKey, notAfter time.Time) {
+	kr.mu.Lock()
+	defer kr.mu.Unlock()
+	key.NotAfter = notAfter
+	kr.keys[key.ID] = key
+}
+
+// SetLegacyKey sets the key used for tokens that have no kid header
+func (kr *KeyRing) SetLegacyKey(key *SigningKey) {
+	kr.mu.Lock()
+	defer kr.mu.Unlock()
+	kr.legacy = key
+}
+
+// Lookup finds a non-expired key by kid. An empty kid resolves to the legacy key, if any.
+func (kr *KeyRing) Lookup(kid string) (*SigningKey, error) {
+	kr.mu.RLock()
+	defer kr.mu.RUnlock()
+
+	key := kr.legacy
+	if kid != "" {
+		key = kr.keys[kid]
+	}
+	if key == nil {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	if key.expired(time.Now()) {
+		return nil, fmt.Errorf("signing key %q has expired", kid)
+	}
+	return key, nil
+}
+
+// JWK is the public JSON Web Key representation of a signing key (RFC 7517)
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	N         string `json:"n,omitempty"`
+	E         string `json:"e,omitempty"`
+	Curve     string `json:"crv,omitempty"`
+	X         string `json:"x,omitempty"`
+	Y         string `json:"y,omitempty"`
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// PublicJWKS returns the public halves of every non-expired asymmetric key. HMAC keys are never published.
+func (kr *KeyRing) PublicJWKS() JWKS {
+	kr.mu.RLock()
+	defer kr.mu.RUnlock()
+
+	jwks := JWKS{Keys: []JWK{}}
+	now := time.Now()
+	for _, key := range kr.keys {
+		if key.expired(now) {
+			continue
+		}
+		if jwk, ok := publicJWK(key); ok {
+			jwks.Keys = append(jwks.Keys, jwk)
+		}
+	}
+	return jwks
+}
+
+func publicJWK(key *SigningKey) (JWK, bool) {
+	b64 := base64.RawURLEncoding
+	switch pub := key.PublicKey.(type) {
+	case *rsa.PublicKey:
+		return JWK{
+			KeyType:   "RSA",
+			KeyID:     key.ID,
+			Use:       "sig",
+			Algorithm: key.Method.Alg(),
+			N:         b64.EncodeToString(pub.N.Bytes()),
+			E:         b64.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+		}, true
+	case ed25519.PublicKey:
+		return JWK{
+			KeyType:   "OKP",
+			KeyID:     key.ID,
+			Use:       "sig",
+			Algorithm: key.Method.Alg(),
+			Curve:     "Ed25519",
+			X:         b64.EncodeToString(pub),
+		}, true
+	}
+	return JWK{}, false
+}
+
+// ParseJWK turns a public JWK published by another issuer into a verification-only SigningKey.
+// The signing method is fixed by the key type so that tokens cannot pick their own algorithm.
+func ParseJWK(jwk JWK) (*SigningKey, error) {
+	b64 := base64.RawURLEncoding
+	switch jwk.KeyType {
+	case "RSA":
+		n, err := b64.DecodeString(jwk.N)
+		if err != nil {
+			return nil, fmt.Errorf("invalid RSA modulus: %w", err)
+		}
+		e, err := b64.DecodeString(jwk.E)
+		if err != nil {
+			return nil, fmt.Errorf("invalid RSA exponent: %w", err)
+		}
+		var method jwt.SigningMethod = jwt.SigningMethodRS256
+		if jwk.Algorithm != "" {
+			if method = jwt.GetSigningMethod(jwk.Algorithm); method == nil || !strings.HasPrefix(jwk.Algorithm, "RS") {
+				return nil, fmt.Errorf("unsupported RSA algorithm: %s", jwk.Algorithm)
+			}
+		}
+		publicKey := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+		return &SigningKey{ID: jwk.KeyID, Method: method, PublicKey: publicKey}, nil
+	case "EC":
+		if jwk.Curve != "P-256" {
+			return nil, fmt.Errorf("unsupported EC curve: %s", jwk.Curve)
+		}
+		x, errX := b64.DecodeString(jwk.X)
+		y, errY := b64.DecodeString(jwk.Y)
+		if errX != nil || errY != nil {
+			return nil, errors.New("invalid EC coordinates")
+		}
+		publicKey := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		return &SigningKey{ID: jwk.KeyID, Method: jwt.SigningMethodES256, PublicKey: publicKey}, nil
+	case "OKP":
+		x, err := b64.DecodeString(jwk.X)
+		if jwk.Curve != "Ed25519" || err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid Ed25519 key")
+		}
+		return &SigningKey{ID: jwk.KeyID, Method: jwt.SigningMethodEdDSA, PublicKey: ed25519.PublicKey(x)}, nil
+	}
+	return nil, fmt.Errorf("unsupported key type: %s", jwk.KeyType)
+}
+
+// thumbprint derives a stable kid from the key material so restarts do not change it (RFC 7638 for public keys)
+func thumbprint(key *SigningKey) string {
+	var input []byte
+	if jwk, ok := publicJWK(key); ok {
+		switch jwk.KeyType {
+		case "RSA":
+			input, _ = json.Marshal(map[string]string{"e": jwk.E, "kty": jwk.KeyType, "n": jwk.N})
+		case "OKP":
+			input, _ = json.Marshal(map[string]string{"crv": jwk.Curve, "kty": jwk.KeyType, "x": jwk.X})
+		}
+		sum := sha256.Sum256(input)
+		return base64.RawURLEncoding.EncodeToString(sum[:])
+	}
+
+	// HMAC secrets must not leak through the kid, so only a short prefix of their digest is used
+	secret, _ := key.PrivateKey.([]byte)
+	sum := sha256.Sum256(secret)
+	return "hs256-" + hex.EncodeToString(sum[:8])
+}
+
+func NewHMACSigningKey(kid string, secret []byte) *SigningKey {
+	key := &SigningKey{
+		ID:         kid,
+		Method:     jwt.SigningMethodHS256,
+		PrivateKey: secret,
+		PublicKey:  secret,
+	}
+	if key.ID == "" {
+		key.ID = thumbprint(key)
+	}
+	return key
+}
+
+func GenerateRSASigningKey(kid string, bits int) (*SigningKey, error) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, bits)
+	if err != nil {
+		return nil, err
+	}
+	return newAsymmetricSigningKey(kid, privateKey)
+}
+
+func GenerateEd25519SigningKey(kid string) (*SigningKey, error) {
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	return newAsymmetricSigningKey(kid, privateKey)
+}
+
+// ParseSigningKeyPEM reads an RSA (PKCS#1 or PKCS#8) or Ed25519 (PKCS#8) private key
+func ParseSigningKeyPEM(kid string, pemBytes []byte) (*SigningKey, error) {
+	block, _ := pem.Decode(pemBytes)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+
+	if privateKey, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return newAsymmetricSigningKey(kid, privateKey)
+	}
+
+	privateKey, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse private key: %w", err)
+	}
+	return newAsymmetricSigningKey(kid, privateKey)
+}
+
+func LoadSigningKeyFile(kid, path string) (*SigningKey, error) {
+	pemBytes, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read signing key %s: %w", path, err)
+	}
+	return ParseSigningKeyPEM(kid, pemBytes)
+}
+
+func newAsymmetricSigningKey(kid string, privateKey interface{}) (*SigningKey, error) {
+	key := &SigningKey{ID: kid, PrivateKey: privateKey}
+	switch pk := privateKey.(type) {
+	case *rsa.PrivateKey:
+		key.Method = jwt.SigningMethodRS256
+		key.PublicKey = &pk.PublicKey
+	case ed25519.PrivateKey:
+		key.Method = jwt.SigningMethodEdDSA
+		key.PublicKey = pk.Public().(ed25519.PublicKey)
+	default:
+		return nil, fmt.Errorf("unsupported private key type %T", privateKey)
+	}
+
+	if key.ID == "" {
+		key.ID = thumbprint(key)
+	}
+	return key, nil
+}
+
+var (
+	keyRingMu sync.RWMutex
+	keyRing   *KeyRing
+)
+
+// SetKeyRing installs the key ring used by the token functions. Passing nil restores the
+// default HS256 ring derived from JWT_SECRET.
+func SetKeyRing(kr *KeyRing) {
+	keyRingMu.Lock()
+	defer keyRingMu.Unlock()
+	keyRing = kr
+}
+
+func currentKeyRing() *KeyRing {
+	keyRingMu.RLock()
+	kr := keyRing
+	keyRingMu.RUnlock()
+	if kr != nil {
+		return kr
+	}
+
+	key := NewHMACSigningKey("", []byte(config.GetJWTSecret()))
+	kr = NewKeyRing(key)
+	kr.SetLegacyKey(key)
+	return kr
+}
+
+// CurrentJWKS returns the public key set of the installed key ring
+func CurrentJWKS() JWKS {
+	return currentKeyRing().PublicJWKS()
+}
+
+// NewKeyRingFromConfig builds the key ring described by the JWT_* settings. Retiring keys stop
+// verifying at the time configured for them, which does not move when the service restarts.
+func NewKeyRingFromConfig() (*KeyRing, error) {
+	hmacKey := NewHMACSigningKey("", []byte(config.GetJWTSecret()))
+
+	var active *SigningKey
+	var err error
+	switch strings.ToUpper(config.GetJWTSigningAlg()) {
+	case "", "HS256":
+		active = hmacKey
+	case "RS256", "EDDSA":
+		active, err = loadActiveAsymmetricKey()
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unsupported JWT signing algorithm %q", config.GetJWTSigningAlg())
+	}
+
+	kr := NewKeyRing(active)
+	switch notAfter := config.GetJWTSecretNotAfter(); {
+	case active == hmacKey:
+		kr.SetLegacyKey(hmacKey)
+	case !notAfter.IsZero():
+		// Tokens signed with the shared secret, with or without a kid, stay valid until
+		// JWT_SECRET_NOT_AFTER. The legacy lookup shares the key, so it expires with it.
+		kr.AddRetiringKey(hmacKey, notAfter)
+		kr.SetLegacyKey(hmacKey)
+	}
+
+	for _, retiring := range config.GetJWTRetiringKeys() {
+		key, err := LoadSigningKeyFile(retiring.ID, retiring.Path)
+		if err != nil {
+			return nil, err
+		}
+		kr.AddRetiringKey(key, retiring.NotAfter)
+	}
+
+	return kr, nil
+}
+
+func loadActiveAsymmetricKey() (*SigningKey, error) {
+	kid := config.GetJWTSigningKeyID()
+	if path := config.GetJWTSigningKeyFile(); path != "" {
+		key, err := LoadSigningKeyFile(kid, path)
+		if err != nil {
+			return nil, err
+		}
+		if !strings.EqualFold(key.Method.Alg(), config.GetJWTSigningAlg()) {
+			return nil, fmt.Errorf("signing key %s is %s, but JWT_SIGNING_ALG is %s", path, key.Method.Alg(), config.GetJWTSigningAlg())
+		}
+		return key, nil
+	}
+
+	// Without a key file every restart invalidates issued tokens, which is only acceptable in development
+	log.Printf("JWT_SIGNING_KEY_FILE is not set, generating an ephemeral %s signing key", config.GetJWTSigningAlg())
+	if strings.EqualFold(config.GetJWTSigningAlg(), "RS256") {
+		return GenerateRSASigningKey(kid, 2048)
+	}
+	return GenerateEd25519SigningKey(kid)
+}
+
+// signClaims signs the claims with the active key, advertising it through the kid header
+func signClaims(claims jwt.Claims) (string, error) {
+	key := currentKeyRing().ActiveKey()
+	token := jwt.NewWithClaims(key.Method, claims)
+	token.Header["kid"] = key.ID
+	return token.SignedString(key.PrivateKey)
+}
+
+// verificationKey is the jwt.Keyfunc resolving the kid header against the key ring
+func verificationKey(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	key, err := currentKeyRing().Lookup(kid)
+	if err != nil {
+		return nil, err
+	}
+
+	// The algorithm is pinned by the key, never by the token, to rule out algorithm confusion
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	}
+	return key.PublicKey, nil
+}
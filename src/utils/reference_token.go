@@ -0,0 +1,118 @@
+package utils
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	AccessTokenFormatJWT    = "jwt"
+	AccessTokenFormatOpaque = "opaque"
+
+	// referenceTokenPrefix marks opaque access tokens, which can never be mistaken for a JWT
+	referenceTokenPrefix = "at_"
+)
+
+var ErrReferenceTokenNotFound = errors.New("reference token not found")
+
+// ReferenceTokenStore keeps the claims behind opaque access tokens. Tokens are keyed by their
+// HashToken digest. Load must not return revoked tokens.
+type ReferenceTokenStore interface {
+	Save(tokenHash string, claims *Claims) error
+	Load(tokenHash string) (*Claims, error)
+	Revoke(tokenHash string) error
+	RevokeSessions(sessionIDs []string) error
+}
+
+var (
+	referenceTokensMu   sync.RWMutex
+	referenceTokenStore ReferenceTokenStore
+)
+
+// SetReferenceTokenStore switches access tokens to opaque reference tokens kept in the store,
+// so revoking one takes effect on the next request. Passing nil restores self-contained JWTs.
+func SetReferenceTokenStore(store ReferenceTokenStore) {
+	referenceTokensMu.Lock()
+	defer referenceTokensMu.Unlock()
+	referenceTokenStore = store
+}
+
+func currentReferenceTokenStore() ReferenceTokenStore {
+	referenceTokensMu.RLock()
+	defer referenceTokensMu.RUnlock()
+	return referenceTokenStore
+}
+
+// ReferenceTokensEnabled reports whether access tokens are issued as opaque reference tokens
+func ReferenceTokensEnabled() bool {
+	return currentReferenceTokenStore() != nil
+}
+
+// IsReferenceToken reports whether the token is an opaque access token rather than a JWT
+func IsReferenceToken(token string) bool {
+	return strings.HasPrefix(token, referenceTokenPrefix)
+}
+
+// issueAccessToken signs the claims as a JWT, or stores them and hands out an opaque
+// reference when a ReferenceTokenStore is installed
+func issueAccessToken(claims *Claims) (string, error) {
+	store := currentReferenceTokenStore()
+	if store == nil {
+		return signClaims(claims)
+	}
+
+	random, err := GenerateRandomToken(32)
+	if err != nil {
+		return "", err
+	}
+	token := referenceTokenPrefix + random
+
+	if err := store.Save(HashToken(token), claims); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// validateReferenceToken resolves an opaque access token to the claims it was issued with
+func validateReferenceToken(token string) (*Claims, error) {
+	store := currentReferenceTokenStore()
+	if store == nil {
+		return nil, errors.New("reference tokens are not enabled")
+	}
+
+	claims, err := store.Load(HashToken(token))
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if claims.ExpiresAt == nil || !now.Before(claims.ExpiresAt.Time) {
+		return nil, errors.New("token is expired")
+	}
+	if claims.NotBefore != nil && now.Before(claims.NotBefore.Time) {
+		return nil, errors.New("token is not valid yet")
+	}
+	return claims, nil
+}
+
+// RevokeReferenceToken revokes an opaque access token in the store. JWTs cannot be revoked
+// here and are left to the blacklist, so they are ignored.
+func RevokeReferenceToken(token string) error {
+	store := currentReferenceTokenStore()
+	if store == nil || !IsReferenceToken(token) {
+		return nil
+	}
+	return store.Revoke(HashToken(token))
+}
+
+// RevokeReferenceTokenSessions revokes the opaque access tokens issued for the given login
+// sessions. It does nothing while access tokens are JWTs.
+func RevokeReferenceTokenSessions(sessionIDs []string) error {
+	store := currentReferenceTokenStore()
+	if store == nil || len(sessionIDs) == 0 {
+		return nil
+	}
+	return store.RevokeSessions(sessionIDs)
+}
@@ -1,9 +1,8 @@
 package utils
 
 import (
-	"crypto/rand"
-	"encoding/base64"
 	"encoding/json"
+	"fmt"
 	"log"
 	"time"
 )
@@ -120,6 +119,108 @@ func (sl *SecurityLogger) LogLogout(userID uint, ipAddress, userAgent string) {
 	})
 }
 
+// LogTokenRevoked records a token revoked through the revocation endpoint. userID is nil for
+// tokens issued to OAuth clients.
+func (sl *SecurityLogger) LogTokenRevoked(userID *uint, tokenType, ipAddress, userAgent string) {
+	sl.LogEvent(SecurityEvent{
+		EventType: "token_revoked",
+		UserID:    userID,
+		IPAddress: ipAddress,
+		UserAgent: userAgent,
+		Timestamp: time.Now(),
+		Success:   true,
+		Details:   "token type: " + tokenType,
+		RiskLevel: "low",
+	})
+}
+
+// LogAllTokensRevoked records every token of a user being revoked through their tokens_valid_after watermark
+func (sl *SecurityLogger) LogAllTokensRevoked(userID uint, reason, ipAddress, userAgent string) {
+	sl.LogEvent(SecurityEvent{
+		EventType: "all_tokens_revoked",
+		UserID:    &userID,
+		IPAddress: ipAddress,
+		UserAgent: userAgent,
+		Timestamp: time.Now(),
+		Success:   true,
+		Details:   reason,
+		RiskLevel: "medium",
+	})
+}
+
+// LogRefreshTokenReuse records a rotated refresh token being presented again, a sign that it
+// was stolen. The whole token family has been revoked by the time this is logged.
+func (sl *SecurityLogger) LogRefreshTokenReuse(userID uint, familyID, ipAddress, userAgent string) {
+	sl.LogEvent(SecurityEvent{
+		EventType: "refresh_token_reuse",
+		UserID:    &userID,
+		IPAddress: ipAddress,
+		UserAgent: userAgent,
+		Timestamp: time.Now(),
+		Success:   false,
+		Details:   "token family revoked: " + familyID,
+		RiskLevel: "high",
+	})
+}
+
+// LogSessionRevoked records a user logging out one or more of their devices remotely
+func (sl *SecurityLogger) LogSessionRevoked(userID uint, count int, ipAddress, userAgent string) {
+	sl.LogEvent(SecurityEvent{
+		EventType: "session_revoked",
+		UserID:    &userID,
+		IPAddress: ipAddress,
+		UserAgent: userAgent,
+		Timestamp: time.Now(),
+		Success:   true,
+		Details:   fmt.Sprintf("sessions: %d", count),
+		RiskLevel: "low",
+	})
+}
+
+func (sl *SecurityLogger) LogMFAEvent(eventType string, userID uint, ipAddress, userAgent string, success bool) {
+	riskLevel := "low"
+	if !success {
+		riskLevel = "high"
+	}
+
+	sl.LogEvent(SecurityEvent{
+		EventType: eventType,
+		UserID:    &userID,
+		IPAddress: ipAddress,
+		UserAgent: userAgent,
+		Timestamp: time.Now(),
+		Success:   success,
+		RiskLevel: riskLevel,
+	})
+}
+
+func (sl *SecurityLogger) LogIdentityEvent(eventType, provider string, userID uint, ipAddress, userAgent string) {
+	sl.LogEvent(SecurityEvent{
+		EventType: eventType,
+		UserID:    &userID,
+		IPAddress: ipAddress,
+		UserAgent: userAgent,
+		Timestamp: time.Now(),
+		Success:   true,
+		Details:   "provider: " + provider,
+		RiskLevel: "medium",
+	})
+}
+
+// LogRoleChange records an admin granting or revoking a role; userID is the admin, the target is in the details
+func (sl *SecurityLogger) LogRoleChange(eventType string, actorID, targetUserID uint, role, ipAddress, userAgent string) {
+	sl.LogEvent(SecurityEvent{
+		EventType: eventType,
+		UserID:    &actorID,
+		IPAddress: ipAddress,
+		UserAgent: userAgent,
+		Timestamp: time.Now(),
+		Success:   true,
+		Details:   fmt.Sprintf("role: %s, target_user_id: %d", role, targetUserID),
+		RiskLevel: "medium",
+	})
+}
+
 func (sl *SecurityLogger) LogSuspiciousActivity(eventType, ipAddress, userAgent, details string) {
 	sl.LogEvent(SecurityEvent{
 		EventType: eventType,
@@ -144,13 +245,3 @@ func (sl *SecurityLogger) LogAccountLockout(email, ipAddress, userAgent string)
 		Details:   "Account locked due to multiple failed login attempts",
 	})
 }
-
-func GenerateCSRFToken() string {
-	b := make([]byte, 32)
-	_, err := rand.Read(b)
-	if err != nil {
-		// fallback: use a timestamp or panic, but crypto/rand should not fail in normal cases
-		return ""
-	}
-	return base64.URLEncoding.EncodeToString(b)
-}
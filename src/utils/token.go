@@ -4,8 +4,7 @@ import (
 	"crypto/rand"
 	"encoding/hex"
 	"errors"
-	"fmt"
-	"go-auth-system/src/config"
+	"strconv"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
@@ -14,37 +13,119 @@ import (
 type TokenType string
 
 const (
-	AccessToken  TokenType = "access"
-	RefreshToken TokenType = "refresh"
+	AccessToken     TokenType = "access"
+	RefreshToken    TokenType = "refresh"
+	MFAPendingToken TokenType = "mfa_pending"
+)
+
+// SubjectType distinguishes user tokens from machine tokens issued to OAuth clients
+type SubjectType string
+
+const (
+	SubjectUser   SubjectType = "user"
+	SubjectClient SubjectType = "client"
+)
+
+const (
+	// AccessTokenTTL is the lifetime of access tokens
+	AccessTokenTTL = 15 * time.Minute
+
+	// MFAPendingTokenTTL is how long a user has to complete the second factor after a successful password check
+	MFAPendingTokenTTL = 5 * time.Minute
 )
 
 type Claims struct {
-	UserID    uint      `json:"user_id"`
-	TokenType TokenType `json:"token_type"`
+	UserID      uint        `json:"user_id"`
+	TokenType   TokenType   `json:"token_type"`
+	SubjectType SubjectType `json:"sub_type,omitempty"`
+	ClientID    string      `json:"client_id,omitempty"`
+	Scope       string      `json:"scope,omitempty"`
+	Roles       []string    `json:"roles,omitempty"`
+	Permissions []string    `json:"permissions,omitempty"`
+	SessionID   string      `json:"sid,omitempty"`
 	jwt.RegisteredClaims
 }
 
+// IsClient reports whether the token was issued to an OAuth client rather than a user.
+// Tokens issued before subject types existed are always user tokens.
+func (c *Claims) IsClient() bool {
+	return c.SubjectType == SubjectClient
+}
+
+// IsDelegated reports whether a user token was issued to a third-party OAuth client, which
+// only holds the scopes the user granted it. First-party logins carry no audience or scope.
+func (c *Claims) IsDelegated() bool {
+	return !c.IsClient() && (len(c.Audience) > 0 || c.Scope != "")
+}
+
+// AccessTokenOptions carries the optional parts of an access token, such as the OAuth scope
+// granted to a third-party client or the roles, permissions and session of a first-party login
+type AccessTokenOptions struct {
+	Scope       string
+	Audience    []string
+	Roles       []string
+	Permissions []string
+	SessionID   string
+}
+
 func GenerateAccessToken(userID uint) (string, error) {
+	return GenerateAccessTokenWithOptions(userID, AccessTokenOptions{})
+}
+
+func GenerateAccessTokenWithOptions(userID uint, opts AccessTokenOptions) (string, error) {
 	claims := &Claims{
-		UserID:    userID,
-		TokenType: AccessToken,
+		UserID:      userID,
+		TokenType:   AccessToken,
+		SubjectType: SubjectUser,
+		Scope:       opts.Scope,
+		Roles:       opts.Roles,
+		Permissions: opts.Permissions,
+		SessionID:   opts.SessionID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   strconv.FormatUint(uint64(userID), 10),
+			Audience:  opts.Audience,
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(AccessTokenTTL)),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			NotBefore: jwt.NewNumericDate(time.Now()),
+			Issuer:    "go-auth-system",
+		},
+	}
+
+	return issueAccessToken(claims)
+}
+
+// GenerateClientAccessToken issues a machine token for an OAuth client (client_credentials grant).
+// It carries no user ID; the client ID is the subject.
+func GenerateClientAccessToken(clientID, scope string) (string, error) {
+	claims := &Claims{
+		TokenType:   AccessToken,
+		SubjectType: SubjectClient,
+		ClientID:    clientID,
+		Scope:       scope,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(15 * time.Minute)),
+			Subject:   clientID,
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(AccessTokenTTL)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 			NotBefore: jwt.NewNumericDate(time.Now()),
 			Issuer:    "go-auth-system",
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(config.GetJWTSecret()))
+	return issueAccessToken(claims)
 }
 
 func GenerateRefreshToken(userID uint) (string, error) {
+	// A random jti keeps two logins within the same second from minting identical tokens
+	jti, err := GenerateRandomToken(16)
+	if err != nil {
+		return "", err
+	}
+
 	claims := &Claims{
 		UserID:    userID,
 		TokenType: RefreshToken,
 		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        jti,
 			ExpiresAt: jwt.NewNumericDate(time.Now().Add(7 * 24 * time.Hour)), // 7 days
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 			NotBefore: jwt.NewNumericDate(time.Now()),
@@ -52,17 +133,34 @@ func GenerateRefreshToken(userID uint) (string, error) {
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(config.GetJWTSecret()))
+	return signClaims(claims)
+}
+
+// GenerateMFAPendingToken issues a short-lived challenge token that can only be exchanged at /auth/mfa/verify
+func GenerateMFAPendingToken(userID uint) (string, error) {
+	claims := &Claims{
+		UserID:    userID,
+		TokenType: MFAPendingToken,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(MFAPendingTokenTTL)),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			NotBefore: jwt.NewNumericDate(time.Now()),
+			Issuer:    "go-auth-system",
+		},
+	}
+
+	return signClaims(claims)
 }
 
 func ValidateToken(tokenString string, expectedType TokenType) (*Claims, error) {
-	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	if IsReferenceToken(tokenString) {
+		if expectedType != AccessToken {
+			return nil, errors.New("invalid token type")
 		}
-		return []byte(config.GetJWTSecret()), nil
-	})
+		return validateReferenceToken(tokenString)
+	}
+
+	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, verificationKey)
 
 	if err != nil {
 		return nil, err
@@ -93,3 +191,12 @@ func GenerateEmailVerificationToken() (string, error) {
 func GeneratePasswordResetToken() (string, error) {
 	return GenerateRandomToken(32)
 }
+
+// GenerateRecoveryCode returns a single-use MFA recovery code formatted as two dash separated groups
+func GenerateRecoveryCode() (string, error) {
+	code, err := GenerateRandomToken(5)
+	if err != nil {
+		return "", err
+	}
+	return code[:5] + "-" + code[5:], nil
+}
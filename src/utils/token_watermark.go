@@ -0,0 +1,95 @@
+package utils
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// TokenWatermarkCacheTTL bounds how long other instances may keep accepting tokens after a
+	// user's watermark was raised. The instance raising it forgets its cached value at once.
+	TokenWatermarkCacheTTL = 30 * time.Second
+
+	maxCachedTokenWatermarks = 10000
+)
+
+// TokenWatermarkStore looks up the time before which a user's tokens are no longer accepted.
+// A zero time means every token of the user is still good.
+type TokenWatermarkStore interface {
+	TokensValidAfter(userID uint) (time.Time, error)
+}
+
+type cachedTokenWatermark struct {
+	validAfter time.Time
+	fetchedAt  time.Time
+}
+
+var (
+	tokenWatermarksMu   sync.Mutex
+	tokenWatermarkStore TokenWatermarkStore
+	tokenWatermarks     = map[uint]cachedTokenWatermark{}
+)
+
+// SetTokenWatermarkStore enables the per-user tokens_valid_after check. Passing nil disables it.
+func SetTokenWatermarkStore(store TokenWatermarkStore) {
+	tokenWatermarksMu.Lock()
+	defer tokenWatermarksMu.Unlock()
+	tokenWatermarkStore = store
+	tokenWatermarks = map[uint]cachedTokenWatermark{}
+}
+
+// ForgetTokenWatermark drops the cached watermark of a user, so a raised one applies at once
+func ForgetTokenWatermark(userID uint) {
+	tokenWatermarksMu.Lock()
+	defer tokenWatermarksMu.Unlock()
+	delete(tokenWatermarks, userID)
+}
+
+// IssuedBeforeWatermark reports whether a user token was issued before the user's
+// tokens_valid_after watermark and must be rejected. Machine tokens have no watermark. If the
+// watermark cannot be looked up the token is treated as revoked.
+//
+// Issue times are whole seconds and watermarks are rounded up to one, so every token issued up
+// to the watermark's second counts as issued before it.
+func IssuedBeforeWatermark(claims *Claims) bool {
+	if claims.IsClient() {
+		return false
+	}
+
+	validAfter, err := tokenWatermark(claims.UserID)
+	if err != nil {
+		return true
+	}
+	if validAfter.IsZero() {
+		return false
+	}
+	return claims.IssuedAt == nil || !claims.IssuedAt.Time.After(validAfter)
+}
+
+func tokenWatermark(userID uint) (time.Time, error) {
+	tokenWatermarksMu.Lock()
+	store := tokenWatermarkStore
+	cached, ok := tokenWatermarks[userID]
+	tokenWatermarksMu.Unlock()
+
+	if store == nil {
+		return time.Time{}, nil
+	}
+	if ok && time.Since(cached.fetchedAt) < TokenWatermarkCacheTTL {
+		return cached.validAfter, nil
+	}
+
+	validAfter, err := store.TokensValidAfter(userID)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	tokenWatermarksMu.Lock()
+	defer tokenWatermarksMu.Unlock()
+	// Entries are cheap to refetch, so the cache is simply dropped once it grows too large
+	if len(tokenWatermarks) >= maxCachedTokenWatermarks {
+		tokenWatermarks = map[uint]cachedTokenWatermark{}
+	}
+	tokenWatermarks[userID] = cachedTokenWatermark{validAfter: validAfter, fetchedAt: time.Now()}
+	return validAfter, nil
+}
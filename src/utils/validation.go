@@ -163,16 +163,3 @@ func ValidateTokenFormat(token string) error {
 
 	return nil
 }
-
-// ValidateCSRFToken validates CSRF token format
-func ValidateCSRFToken(token string) error {
-	if token == "" {
-		return fmt.Errorf("CSRF token is required")
-	}
-
-	if len(token) < 32 {
-		return fmt.Errorf("invalid CSRF token format")
-	}
-
-	return nil
-}
@@ -8,7 +8,9 @@ import (
 	"testing"
 
 	"go-auth-system/src/handlers"
+	"go-auth-system/src/middleware"
 	"go-auth-system/src/models"
+	"go-auth-system/src/services"
 
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
@@ -20,6 +22,7 @@ import (
 type AuthTestSuite struct {
 	suite.Suite
 	db       *gorm.DB
+	store    *services.MemoryStore
 	handler  *handlers.AuthHandler
 	router   *gin.Engine
 	testUser models.User
@@ -36,11 +39,17 @@ func (suite *AuthTestSuite) SetupSuite() {
 		&models.RefreshToken{},
 		&models.PasswordResetToken{},
 		&models.EmailVerificationToken{},
+		&models.Role{},
+		&models.Permission{},
+		&models.UserRole{},
 	)
 	assert.NoError(suite.T(), err)
+	seedRoles(suite.T(), db)
 
 	suite.db = db
-	suite.handler = handlers.NewAuthHandler(db)
+	// Runs without Redis: the blacklist and sessions live in process
+	suite.store = services.NewMemoryStore(services.MemoryStoreJanitorInterval)
+	suite.handler = handlers.NewAuthHandler(db, suite.store)
 
 	// Setup test router
 	gin.SetMode(gin.TestMode)
@@ -53,11 +62,15 @@ func (suite *AuthTestSuite) SetupSuite() {
 	suite.createTestUser()
 }
 
+func (suite *AuthTestSuite) TearDownSuite() {
+	suite.store.Close()
+}
+
 func (suite *AuthTestSuite) setupTestRoutes() {
 	suite.router.POST("/auth/register", suite.handler.Register)
 	suite.router.POST("/auth/login", suite.handler.Login)
 	suite.router.POST("/auth/refresh", suite.handler.RefreshToken)
-	suite.router.POST("/auth/logout", suite.handler.Logout)
+	suite.router.POST("/auth/logout", middleware.AuthMiddleware(suite.store), middleware.RequireUser(), suite.handler.Logout)
 	suite.router.GET("/auth/verify", suite.handler.VerifyEmail)
 	suite.router.POST("/auth/password/forgot", suite.handler.ForgotPassword)
 	suite.router.POST("/auth/password/reset", suite.handler.ResetPassword)
@@ -65,7 +78,7 @@ func (suite *AuthTestSuite) setupTestRoutes() {
 
 func (suite *AuthTestSuite) createTestUser() {
 	user := models.User{
-		Email:     "test@example.com",
+		Email:     "test@company.io",
 		FirstName: "Test",
 		LastName:  "User",
 	}
@@ -82,8 +95,8 @@ func (suite *AuthTestSuite) createTestUser() {
 func (suite *AuthTestSuite) TestRegister() {
 	// Test successful registration
 	registerData := map[string]string{
-		"email":      "newuser@example.com",
-		"password":   "NewPassword123!",
+		"email":      "newuser@company.io",
+		"password":   "NewSecret-456!",
 		"first_name": "New",
 		"last_name":  "User",
 	}
@@ -109,7 +122,7 @@ func (suite *AuthTestSuite) TestRegister() {
 	// Test invalid email
 	invalidData := map[string]string{
 		"email":      "invalid-email",
-		"password":   "NewPassword123!",
+		"password":   "NewSecret-456!",
 		"first_name": "New",
 		"last_name":  "User",
 	}
@@ -125,7 +138,7 @@ func (suite *AuthTestSuite) TestRegister() {
 
 	// Test weak password
 	weakPasswordData := map[string]string{
-		"email":      "weak@example.com",
+		"email":      "weak@company.io",
 		"password":   "123",
 		"first_name": "Weak",
 		"last_name":  "User",
@@ -144,7 +157,7 @@ func (suite *AuthTestSuite) TestRegister() {
 func (suite *AuthTestSuite) TestLogin() {
 	// Test successful login
 	loginData := map[string]string{
-		"email":    "test@example.com",
+		"email":    "test@company.io",
 		"password": "TestPassword123!",
 	}
 
@@ -165,7 +178,7 @@ func (suite *AuthTestSuite) TestLogin() {
 
 	// Test invalid credentials
 	invalidLoginData := map[string]string{
-		"email":    "test@example.com",
+		"email":    "test@company.io",
 		"password": "WrongPassword",
 	}
 
@@ -180,7 +193,7 @@ func (suite *AuthTestSuite) TestLogin() {
 
 	// Test non-existent user
 	nonExistentData := map[string]string{
-		"email":    "nonexistent@example.com",
+		"email":    "nonexistent@company.io",
 		"password": "SomePassword123!",
 	}
 
@@ -197,7 +210,7 @@ func (suite *AuthTestSuite) TestLogin() {
 func (suite *AuthTestSuite) TestRefreshToken() {
 	// First login to get tokens
 	loginData := map[string]string{
-		"email":    "test@example.com",
+		"email":    "test@company.io",
 		"password": "TestPassword123!",
 	}
 
@@ -254,7 +267,7 @@ func (suite *AuthTestSuite) TestRefreshToken() {
 func (suite *AuthTestSuite) TestLogout() {
 	// First login to get tokens
 	loginData := map[string]string{
-		"email":    "test@example.com",
+		"email":    "test@company.io",
 		"password": "TestPassword123!",
 	}
 
@@ -269,6 +282,7 @@ func (suite *AuthTestSuite) TestLogout() {
 	err := json.Unmarshal(w.Body.Bytes(), &loginResponse)
 	assert.NoError(suite.T(), err)
 
+	accessToken := loginResponse["access_token"].(string)
 	refreshToken := loginResponse["refresh_token"].(string)
 
 	// Test logout
@@ -279,12 +293,18 @@ func (suite *AuthTestSuite) TestLogout() {
 	jsonData, _ = json.Marshal(logoutData)
 	req, _ = http.NewRequest("POST", "/auth/logout", bytes.NewBuffer(jsonData))
 	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+accessToken)
 
 	w = httptest.NewRecorder()
 	suite.router.ServeHTTP(w, req)
 
 	assert.Equal(suite.T(), http.StatusOK, w.Code)
 
+	// The access token is blacklisted in the in-memory store
+	blacklisted, err := suite.store.IsTokenBlacklisted(accessToken)
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), blacklisted)
+
 	// Test logout with invalid token
 	invalidLogoutData := map[string]string{
 		"refresh_token": "invalid-token",
@@ -303,7 +323,7 @@ func (suite *AuthTestSuite) TestLogout() {
 func (suite *AuthTestSuite) TestForgotPassword() {
 	// Test forgot password with existing user
 	forgotData := map[string]string{
-		"email": "test@example.com",
+		"email": "test@company.io",
 	}
 
 	jsonData, _ := json.Marshal(forgotData)
@@ -317,7 +337,7 @@ func (suite *AuthTestSuite) TestForgotPassword() {
 
 	// Test forgot password with non-existing user (should still return OK)
 	nonExistentData := map[string]string{
-		"email": "nonexistent@example.com",
+		"email": "nonexistent@company.io",
 	}
 
 	jsonData, _ = json.Marshal(nonExistentData)
@@ -0,0 +1,302 @@
+package tests
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go-auth-system/src/config"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// loadConfig reloads the configuration from the environment of the test
+func loadConfig(t *testing.T) {
+	t.Helper()
+	_, err := config.Load()
+	assert.NoError(t, err)
+}
+
+// clearConfigEnv unsets the settings the config tests depend on, restoring them afterwards
+func clearConfigEnv(t *testing.T) {
+	for _, key := range []string{
+		"CONFIG_FILE", "GIN_MODE", "PORT", "DATABASE_URL", "REDIS_URL", "TOKEN_STORE", "JWT_SECRET", "CSRF_SECRET",
+		"JWT_SIGNING_ALG", "JWT_SIGNING_KEY_FILE", "JWT_SIGNING_KEY_ID", "JWT_SECRET_NOT_AFTER", "JWT_RETIRING_KEY_FILES",
+		"SMTP_HOST", "SMTP_PORT", "CORS_MAX_AGE", "ALLOWED_ORIGINS", "CORS_ALLOW_CREDENTIALS",
+		"RATE_LIMIT_FAILURE_POLICY", "REVOCATION_FAILURE_POLICY", "STORE_BREAKER_THRESHOLD", "STORE_BREAKER_COOLDOWN",
+		"RATE_LIMIT_PUBLIC", "RATE_LIMIT_OAUTH", "RATE_LIMIT_LOGIN", "RATE_LIMIT_PASSWORD_RESET", "RATE_LIMIT_ACCOUNT",
+	} {
+		t.Setenv(key, "")
+	}
+	t.Cleanup(func() { loadConfig(t) })
+}
+
+func writeConfigFile(t *testing.T, name, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	assert.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+func TestConfigDefaults(t *testing.T) {
+	clearConfigEnv(t)
+
+	cfg, err := config.Load()
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "8080", cfg.Port)
+	assert.Equal(t, config.DefaultJWTSecret, cfg.JWT.Secret)
+	assert.Equal(t, 587, cfg.Email.SMTPPort)
+	assert.Equal(t, 10*time.Minute, cfg.CORS.MaxAge)
+	assert.Equal(t, []string{"cache:6379"}, cfg.Redis.Addrs)
+	assert.Equal(t, []string{"cache:6379"}, config.GetRedis().Options().Addrs)
+	assert.Equal(t, "http://localhost:8080", config.GetIssuerURL())
+}
+
+func TestConfigRefusesInsecureProductionDefaults(t *testing.T) {
+	clearConfigEnv(t)
+	t.Setenv("GIN_MODE", "release")
+	t.Setenv("SMTP_PORT", "five-eight-seven")
+
+	_, err := config.Load()
+	if assert.Error(t, err) {
+		// Every problem is reported at once
+		assert.Contains(t, err.Error(), "JWT_SECRET must be changed from its default")
+		assert.Contains(t, err.Error(), "CSRF_SECRET is required in production")
+		assert.Contains(t, err.Error(), "DATABASE_URL is required")
+		assert.Contains(t, err.Error(), `SMTP_PORT must be a number, got "five-eight-seven"`)
+	}
+
+	t.Setenv("JWT_SECRET", "too-short")
+	t.Setenv("CSRF_SECRET", "also-too-short")
+	_, err = config.Load()
+	assert.ErrorContains(t, err, "JWT_SECRET must be at least 32 characters")
+	assert.ErrorContains(t, err, "CSRF_SECRET must be at least 32 characters")
+
+	t.Setenv("JWT_SECRET", "a-production-secret-that-is-long-enough")
+	t.Setenv("CSRF_SECRET", "a-csrf-signing-secret-that-is-long-enough")
+	t.Setenv("DATABASE_URL", "postgres://auth:auth@db:5432/auth_db")
+	t.Setenv("SMTP_PORT", "2525")
+	cfg, err := config.Load()
+	if assert.NoError(t, err) {
+		assert.True(t, cfg.IsProduction())
+		assert.Equal(t, 2525, config.GetSMTPPort())
+	}
+}
+
+func TestConfigRejectsMalformedValuesInDevelopment(t *testing.T) {
+	clearConfigEnv(t)
+	t.Setenv("ALLOWED_ORIGINS", "https://app.company.io")
+	loadConfig(t)
+
+	t.Setenv("SMTP_PORT", "587x")
+	_, err := config.Load()
+	assert.ErrorContains(t, err, "SMTP_PORT must be a number")
+
+	t.Setenv("SMTP_PORT", "")
+	t.Setenv("TOKEN_STORE", "memcached")
+	_, err = config.Load()
+	assert.ErrorContains(t, err, "TOKEN_STORE must be redis or memory")
+
+	t.Setenv("TOKEN_STORE", "memory")
+	t.Setenv("ALLOWED_ORIGINS", "*")
+	t.Setenv("CORS_ALLOW_CREDENTIALS", "true")
+	_, err = config.Load()
+	assert.ErrorContains(t, err, "cannot contain *")
+
+	// A failed load leaves the previous configuration in place
+	assert.Equal(t, []string{"https://app.company.io"}, config.GetAllowedOrigins())
+}
+
+func TestConfigRetiringKeys(t *testing.T) {
+	clearConfigEnv(t)
+
+	t.Setenv("JWT_RETIRING_KEY_FILES", "old=/keys/old.pem@2025-01-31T00:00:00Z, /keys/older.pem@2025-01-01T12:00:00+01:00")
+	t.Setenv("JWT_SECRET_NOT_AFTER", "2025-02-01T00:00:00Z")
+	cfg, err := config.Load()
+	if assert.NoError(t, err) {
+		assert.Equal(t, []config.RetiringKeyConfig{
+			{ID: "old", Path: "/keys/old.pem", NotAfter: time.Date(2025, 1, 31, 0, 0, 0, 0, time.UTC)},
+			{Path: "/keys/older.pem", NotAfter: time.Date(2025, 1, 1, 11, 0, 0, 0, time.UTC)},
+		}, normalizeRetiringKeys(cfg.JWT.RetiringKeys))
+		assert.True(t, cfg.JWT.SecretNotAfter.Equal(time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC)))
+	}
+
+	// A retirement time computed at startup would move with every restart, so it is required
+	t.Setenv("JWT_RETIRING_KEY_FILES", "old=/keys/old.pem")
+	_, err = config.Load()
+	assert.ErrorContains(t, err, `JWT_RETIRING_KEY_FILES entry "old=/keys/old.pem" needs a retirement time`)
+
+	t.Setenv("JWT_RETIRING_KEY_FILES", "old=/keys/old.pem@next week")
+	t.Setenv("JWT_SECRET_NOT_AFTER", "2025-02-01")
+	_, err = config.Load()
+	assert.ErrorContains(t, err, "has an invalid retirement time")
+	assert.ErrorContains(t, err, "JWT_SECRET_NOT_AFTER must be an RFC 3339 time")
+}
+
+func normalizeRetiringKeys(keys []config.RetiringKeyConfig) []config.RetiringKeyConfig {
+	for i := range keys {
+		keys[i].NotAfter = keys[i].NotAfter.UTC()
+	}
+	return keys
+}
+
+func TestConfigRedisURL(t *testing.T) {
+	clearConfigEnv(t)
+	t.Setenv("REDIS_URL", "rediss://:s3cret@redis.internal:6380/2")
+	loadConfig(t)
+
+	options := config.GetRedis().Options()
+	assert.Equal(t, []string{"redis.internal:6380"}, options.Addrs)
+	assert.Equal(t, "s3cret", options.Password)
+	assert.Equal(t, 2, options.DB)
+	assert.NotNil(t, options.TLSConfig)
+
+	t.Setenv("REDIS_URL", "postgres://:s3cret@redis.internal:6380")
+	_, err := config.Load()
+	if assert.Error(t, err) {
+		assert.NotContains(t, err.Error(), "s3cret")
+	}
+}
+
+func TestParseRedisURL(t *testing.T) {
+	sentinel, err := config.ParseRedisURL("redis-sentinel://:s3cret@sentinel-a,sentinel-b:26380/1?master=auth")
+	if assert.NoError(t, err) {
+		assert.Equal(t, []string{"sentinel-a:26379", "sentinel-b:26380"}, sentinel.Addrs)
+		assert.Equal(t, "auth", sentinel.MasterName)
+		assert.Equal(t, 1, sentinel.DB)
+		assert.False(t, sentinel.TLS)
+	}
+
+	cluster, err := config.ParseRedisURL("rediss-cluster://node-a:7000,node-b:7001")
+	if assert.NoError(t, err) {
+		assert.True(t, cluster.Cluster)
+		assert.True(t, cluster.TLS)
+		assert.Equal(t, []string{"node-a:7000", "node-b:7001"}, cluster.Addrs)
+	}
+
+	for _, invalid := range []string{
+		"redis-sentinel://sentinel-a:26379", // no master name
+		"redis-cluster://node-a:7000/3",     // clusters only have database 0
+		"redis://cache-a:6379,cache-b:6379", // several hosts need sentinel or cluster
+		"redis://cache:6379/not-a-db",
+	} {
+		_, err := config.ParseRedisURL(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestConfigFile(t *testing.T) {
+	yamlFile := writeConfigFile(t, "auth.yaml", `
+database_url: postgres://auth:auth@db:5432/auth_db
+smtp:
+  host: smtp.company.io
+  port: 2525
+allowed_origins:
+  - https://app.company.io
+  - https://admin.company.io
+rate_limit:
+  login: 10/1h per ip
+`)
+	tomlFile := writeConfigFile(t, "auth.toml", `
+DATABASE_URL = "postgres://auth:auth@db:5432/auth_db"
+ALLOWED_ORIGINS = ["https://app.company.io", "https://admin.company.io"]
+
+[smtp]
+host = "smtp.company.io"
+port = 2525
+
+[rate_limit]
+login = "10/1h per ip"
+`)
+
+	for _, path := range []string{yamlFile, tomlFile} {
+		t.Run(filepath.Ext(path), func(t *testing.T) {
+			clearConfigEnv(t)
+			t.Setenv("CONFIG_FILE", path)
+
+			cfg, err := config.Load()
+			if !assert.NoError(t, err) {
+				return
+			}
+			assert.Equal(t, "postgres://auth:auth@db:5432/auth_db", cfg.DatabaseURL)
+			assert.Equal(t, "smtp.company.io", cfg.Email.SMTPHost)
+			assert.Equal(t, 2525, cfg.Email.SMTPPort)
+			assert.Equal(t, []string{"https://app.company.io", "https://admin.company.io"}, cfg.CORS.AllowedOrigins)
+			assert.Equal(t, 10, cfg.RateLimits[config.RateLimitLogin].Limit)
+			assert.Equal(t, time.Hour, cfg.RateLimits[config.RateLimitLogin].Window)
+
+			// The environment overrides the file
+			t.Setenv("SMTP_PORT", "465")
+			cfg, err = config.Load()
+			if assert.NoError(t, err) {
+				assert.Equal(t, 465, cfg.Email.SMTPPort)
+			}
+		})
+	}
+
+	t.Run("unsupported", func(t *testing.T) {
+		clearConfigEnv(t)
+		t.Setenv("CONFIG_FILE", writeConfigFile(t, "auth.json", "{}"))
+		_, err := config.Load()
+		assert.Error(t, err)
+	})
+}
+
+func TestConfigRateLimitPolicies(t *testing.T) {
+	clearConfigEnv(t)
+
+	cfg, err := config.Load()
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, config.RateLimitPolicy{
+		Name: config.RateLimitLogin, Key: "ip", Strategy: "sliding-log", Limit: 5, Window: 15 * time.Minute,
+	}, cfg.RateLimits[config.RateLimitLogin])
+	assert.Equal(t, "100/15m0s per ip token-bucket", cfg.RateLimits[config.RateLimitPublic].String())
+	assert.Equal(t, time.Hour, cfg.RateLimits[config.RateLimitPasswordReset].Window)
+	assert.Equal(t, "300/15m0s per user token-bucket", cfg.RateLimits[config.RateLimitAccount].String())
+
+	t.Setenv("RATE_LIMIT_LOGIN", "10/1h per ip token-bucket")
+	t.Setenv("RATE_LIMIT_OAUTH", "off")
+	cfg, err = config.Load()
+	if assert.NoError(t, err) {
+		assert.Equal(t, "10/1h0m0s per ip token-bucket", cfg.RateLimits[config.RateLimitLogin].String())
+		assert.True(t, cfg.RateLimits[config.RateLimitOAuth].Disabled)
+	}
+
+	// These policies run before authentication, where a per-user limit would never apply
+	for _, name := range []string{"PUBLIC", "OAUTH", "LOGIN", "PASSWORD_RESET"} {
+		t.Run(name, func(t *testing.T) {
+			t.Setenv("RATE_LIMIT_"+name, "10/1h per user token-bucket")
+			_, err := config.Load()
+			assert.ErrorContains(t, err, "RATE_LIMIT_"+name+" applies before authentication, so it can only limit per ip")
+		})
+	}
+
+	// The account policy runs after authentication, so it may limit either way
+	for _, rule := range []string{"20/1m per user sliding-log", "20/1m per ip"} {
+		t.Setenv("RATE_LIMIT_ACCOUNT", rule)
+		cfg, err = config.Load()
+		if assert.NoError(t, err, rule) {
+			assert.Equal(t, 20, cfg.RateLimits[config.RateLimitAccount].Limit)
+		}
+	}
+	t.Setenv("RATE_LIMIT_ACCOUNT", "")
+
+	// Windows need a unit, so seconds cannot be mistaken for nanoseconds again
+	for rule, problem := range map[string]string{
+		"5/900 per ip":         "window must be a duration with a unit",
+		"5/900ns per ip":       "window must be at least 1s",
+		"0/15m per ip":         "limit must be a positive number",
+		"5/15m per device":     "must limit per ip or per user",
+		"5/15m per ip fixed":   "strategy must be sliding-log or token-bucket",
+		"5 requests every 15m": "must look like",
+		"5 per 15m":            "must give a limit and a window",
+	} {
+		t.Setenv("RATE_LIMIT_LOGIN", rule)
+		_, err := config.Load()
+		assert.ErrorContains(t, err, "RATE_LIMIT_LOGIN "+problem, rule)
+	}
+}
@@ -0,0 +1,222 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go-auth-system/src/handlers"
+	"go-auth-system/src/middleware"
+	"go-auth-system/src/models"
+	"go-auth-system/src/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+type CookieSessionTestSuite struct {
+	suite.Suite
+	router *gin.Engine
+	user   models.User
+}
+
+func (suite *CookieSessionTestSuite) SetupTest() {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	assert.NoError(suite.T(), err)
+	err = db.AutoMigrate(
+		&models.User{},
+		&models.RefreshToken{},
+		&models.MFARecoveryCode{},
+		&models.Role{},
+		&models.Permission{},
+		&models.UserRole{},
+	)
+	assert.NoError(suite.T(), err)
+	seedRoles(suite.T(), db)
+
+	suite.user = models.User{Email: "ivy@company.io", IsEmailVerified: true}
+	assert.NoError(suite.T(), suite.user.SetPassword("TestPassword123!"))
+	assert.NoError(suite.T(), db.Create(&suite.user).Error)
+
+	store := newFakeTokenStore()
+	authHandler := handlers.NewAuthHandler(db, store)
+
+	gin.SetMode(gin.TestMode)
+	suite.router = gin.New()
+	suite.router.POST("/auth/login", authHandler.Login)
+	suite.router.POST("/auth/refresh", authHandler.RefreshToken)
+	protected := suite.router.Group("/", middleware.AuthMiddleware(store), middleware.RequireUser())
+	{
+		protected.GET("/me-only", func(c *gin.Context) {
+			c.JSON(http.StatusOK, gin.H{"user_id": c.GetUint("userID")})
+		})
+		protected.POST("/me-only", func(c *gin.Context) {
+			c.JSON(http.StatusOK, gin.H{"user_id": c.GetUint("userID")})
+		})
+		protected.POST("/auth/logout", authHandler.Logout)
+	}
+}
+
+func (suite *CookieSessionTestSuite) request(method, path string, body interface{}, cookies []*http.Cookie, headers map[string]string) *httptest.ResponseRecorder {
+	var payload *bytes.Buffer
+	if body != nil {
+		jsonData, _ := json.Marshal(body)
+		payload = bytes.NewBuffer(jsonData)
+	} else {
+		payload = &bytes.Buffer{}
+	}
+	req, _ := http.NewRequest(method, path, payload)
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	for _, cookie := range cookies {
+		req.AddCookie(cookie)
+	}
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+	return w
+}
+
+// loginWithCookies logs in asking for cookie delivery and returns the cookies the browser keeps
+func (suite *CookieSessionTestSuite) loginWithCookies() (map[string]*http.Cookie, string) {
+	w := suite.request("POST", "/auth/login",
+		gin.H{"email": suite.user.Email, "password": "TestPassword123!"},
+		nil, map[string]string{middleware.TokenDeliveryHeader: "cookie"})
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+
+	var response map[string]interface{}
+	assert.NoError(suite.T(), json.Unmarshal(w.Body.Bytes(), &response))
+	assert.NotContains(suite.T(), response, "access_token")
+	assert.NotContains(suite.T(), response, "refresh_token")
+	assert.Equal(suite.T(), "cookie", response["token_type"])
+
+	return cookiesByName(w), response["csrf_token"].(string)
+}
+
+func cookiesByName(w *httptest.ResponseRecorder) map[string]*http.Cookie {
+	cookies := map[string]*http.Cookie{}
+	for _, cookie := range w.Result().Cookies() {
+		cookies[cookie.Name] = cookie
+	}
+	return cookies
+}
+
+func (suite *CookieSessionTestSuite) TestLoginSetsHardenedCookies() {
+	cookies, csrfToken := suite.loginWithCookies()
+
+	access := cookies[middleware.AccessTokenCookie]
+	refresh := cookies[middleware.RefreshTokenCookie]
+	csrfSession := cookies[middleware.CSRFSessionCookie]
+	if !assert.NotNil(suite.T(), access) || !assert.NotNil(suite.T(), refresh) || !assert.NotNil(suite.T(), csrfSession) {
+		return
+	}
+
+	for _, cookie := range []*http.Cookie{access, refresh, csrfSession} {
+		assert.True(suite.T(), cookie.HttpOnly)
+		assert.True(suite.T(), cookie.Secure)
+		assert.Equal(suite.T(), http.SameSiteStrictMode, cookie.SameSite)
+	}
+	assert.Equal(suite.T(), "/auth", refresh.Path)
+
+	// The CSRF token is handed to scripts in the body and is bound to the session cookie
+	assert.NoError(suite.T(), utils.ValidateCSRFToken(csrfToken, csrfSession.Value))
+
+	_, err := utils.ValidateToken(access.Value, utils.AccessToken)
+	assert.NoError(suite.T(), err)
+}
+
+func (suite *CookieSessionTestSuite) TestAccessTokenCookieAuthenticates() {
+	cookies, csrfToken := suite.loginWithCookies()
+	sent := []*http.Cookie{cookies[middleware.AccessTokenCookie], cookies[middleware.CSRFSessionCookie]}
+
+	w := suite.request("GET", "/me-only", nil, sent, nil)
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+
+	// State-changing requests authenticated by cookie need a CSRF token signed for the session
+	w = suite.request("POST", "/me-only", nil, sent, nil)
+	assert.Equal(suite.T(), http.StatusForbidden, w.Code)
+	w = suite.request("POST", "/me-only", nil, sent, map[string]string{"X-CSRF-Token": "forged-token-from-another-site-0000000000.a.b"})
+	assert.Equal(suite.T(), http.StatusForbidden, w.Code)
+	w = suite.request("POST", "/me-only", nil, sent, map[string]string{"X-CSRF-Token": csrfToken})
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+}
+
+func (suite *CookieSessionTestSuite) TestAuthorizationHeaderTakesPrecedence() {
+	cookies, _ := suite.loginWithCookies()
+
+	// An invalid bearer token is not rescued by a valid cookie
+	w := suite.request("GET", "/me-only", nil,
+		[]*http.Cookie{cookies[middleware.AccessTokenCookie]},
+		map[string]string{"Authorization": "Bearer not-a-token"})
+	assert.Equal(suite.T(), http.StatusUnauthorized, w.Code)
+
+	// Bearer tokens are not subject to the CSRF check
+	w = suite.request("POST", "/me-only", nil, nil,
+		map[string]string{"Authorization": "Bearer " + cookies[middleware.AccessTokenCookie].Value})
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+}
+
+func (suite *CookieSessionTestSuite) TestRefreshFromCookie() {
+	cookies, csrfToken := suite.loginWithCookies()
+	sent := []*http.Cookie{cookies[middleware.RefreshTokenCookie], cookies[middleware.CSRFSessionCookie]}
+	cookieMode := map[string]string{middleware.TokenDeliveryHeader: "cookie"}
+
+	w := suite.request("POST", "/auth/refresh", nil, sent, cookieMode)
+	assert.Equal(suite.T(), http.StatusForbidden, w.Code)
+
+	cookieMode["X-CSRF-Token"] = csrfToken
+	w = suite.request("POST", "/auth/refresh", nil, sent, cookieMode)
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+
+	rotated := cookiesByName(w)
+	assert.NotNil(suite.T(), rotated[middleware.AccessTokenCookie])
+	assert.Nil(suite.T(), rotated[middleware.CSRFSessionCookie], "refreshing keeps the CSRF session")
+	if assert.NotNil(suite.T(), rotated[middleware.RefreshTokenCookie]) {
+		assert.NotEqual(suite.T(), cookies[middleware.RefreshTokenCookie].Value, rotated[middleware.RefreshTokenCookie].Value)
+	}
+	assert.NotContains(suite.T(), w.Body.String(), "refresh_token")
+}
+
+func (suite *CookieSessionTestSuite) TestLogoutClearsCookies() {
+	cookies, csrfToken := suite.loginWithCookies()
+
+	w := suite.request("POST", "/auth/logout", nil,
+		[]*http.Cookie{cookies[middleware.AccessTokenCookie], cookies[middleware.RefreshTokenCookie], cookies[middleware.CSRFSessionCookie]},
+		map[string]string{"X-CSRF-Token": csrfToken})
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+
+	cleared := cookiesByName(w)
+	for _, name := range []string{middleware.AccessTokenCookie, middleware.RefreshTokenCookie, middleware.CSRFSessionCookie} {
+		if assert.NotNil(suite.T(), cleared[name], name) {
+			assert.Empty(suite.T(), cleared[name].Value)
+			assert.True(suite.T(), cleared[name].MaxAge < 0)
+		}
+	}
+
+	// The refresh token sent as a cookie was revoked along with the session
+	w = suite.request("POST", "/auth/refresh", nil,
+		[]*http.Cookie{cookies[middleware.RefreshTokenCookie], cookies[middleware.CSRFSessionCookie]},
+		map[string]string{"X-CSRF-Token": csrfToken})
+	assert.Equal(suite.T(), http.StatusUnauthorized, w.Code)
+}
+
+func (suite *CookieSessionTestSuite) TestBodyDeliveryRemainsDefault() {
+	w := suite.request("POST", "/auth/login", gin.H{"email": suite.user.Email, "password": "TestPassword123!"}, nil, nil)
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	assert.Empty(suite.T(), w.Result().Cookies())
+
+	var tokens loginTokens
+	assert.NoError(suite.T(), json.Unmarshal(w.Body.Bytes(), &tokens))
+	assert.NotEmpty(suite.T(), tokens.AccessToken)
+	assert.NotEmpty(suite.T(), tokens.RefreshToken)
+}
+
+func TestCookieSessionTestSuite(t *testing.T) {
+	suite.Run(t, new(CookieSessionTestSuite))
+}
@@ -0,0 +1,139 @@
+package tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go-auth-system/src/config"
+	"go-auth-system/src/middleware"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type CORSTestSuite struct {
+	suite.Suite
+	router *gin.Engine
+}
+
+func (suite *CORSTestSuite) SetupTest() {
+	cors, err := middleware.NewCORSMiddleware(config.CORSConfig{
+		AllowedOrigins:   []string{"https://app.company.io", "https://*.tools.company.io"},
+		AllowedMethods:   []string{"GET", "POST", "PATCH"},
+		AllowedHeaders:   []string{"Content-Type", "Authorization", "X-CSRF-Token"},
+		ExposedHeaders:   []string{"Retry-After"},
+		AllowCredentials: true,
+		MaxAge:           5 * time.Minute,
+	})
+	assert.NoError(suite.T(), err)
+
+	gin.SetMode(gin.TestMode)
+	suite.router = gin.New()
+	suite.router.Use(cors)
+	suite.router.GET("/auth/me", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"ok": true})
+	})
+	suite.router.POST("/auth/me", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"ok": true})
+	})
+}
+
+func (suite *CORSTestSuite) request(method, origin string, headers map[string]string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(method, "/auth/me", nil)
+	if origin != "" {
+		req.Header.Set("Origin", origin)
+	}
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+	return w
+}
+
+func (suite *CORSTestSuite) preflight(origin string) *httptest.ResponseRecorder {
+	return suite.request("OPTIONS", origin, map[string]string{
+		"Access-Control-Request-Method":  "PATCH",
+		"Access-Control-Request-Headers": "content-type, x-csrf-token",
+	})
+}
+
+func (suite *CORSTestSuite) TestAllowedOrigin() {
+	w := suite.request("GET", "https://app.company.io", nil)
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	assert.Equal(suite.T(), "https://app.company.io", w.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(suite.T(), "true", w.Header().Get("Access-Control-Allow-Credentials"))
+	assert.Equal(suite.T(), "Retry-After", w.Header().Get("Access-Control-Expose-Headers"))
+	assert.Contains(suite.T(), w.Header().Values("Vary"), "Origin")
+}
+
+func (suite *CORSTestSuite) TestWildcardSubdomain() {
+	for _, origin := range []string{"https://grafana.tools.company.io", "https://a.b.tools.company.io"} {
+		w := suite.request("GET", origin, nil)
+		assert.Equal(suite.T(), origin, w.Header().Get("Access-Control-Allow-Origin"), origin)
+	}
+
+	for _, origin := range []string{
+		"https://tools.company.io",         // the parent domain itself is not a subdomain
+		"http://grafana.tools.company.io",  // scheme must match
+		"https://eviltools.company.io",     // label boundary
+		"https://tools.company.io.evil.io", // suffix must be the end of the host
+	} {
+		w := suite.request("GET", origin, nil)
+		assert.Empty(suite.T(), w.Header().Get("Access-Control-Allow-Origin"), origin)
+	}
+}
+
+func (suite *CORSTestSuite) TestRejectedOrigin() {
+	w := suite.request("POST", "https://evil.example", nil)
+	assert.Empty(suite.T(), w.Header().Get("Access-Control-Allow-Origin"))
+	assert.Empty(suite.T(), w.Header().Get("Access-Control-Allow-Credentials"))
+	assert.Contains(suite.T(), w.Header().Values("Vary"), "Origin")
+
+	w = suite.preflight("https://evil.example")
+	assert.Equal(suite.T(), http.StatusForbidden, w.Code)
+	assert.Empty(suite.T(), w.Header().Get("Access-Control-Allow-Methods"))
+}
+
+func (suite *CORSTestSuite) TestPreflight() {
+	w := suite.preflight("https://app.company.io")
+	assert.Equal(suite.T(), http.StatusNoContent, w.Code)
+	assert.Equal(suite.T(), "https://app.company.io", w.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(suite.T(), "GET, POST, PATCH", w.Header().Get("Access-Control-Allow-Methods"))
+	assert.Equal(suite.T(), "Content-Type, Authorization, X-CSRF-Token", w.Header().Get("Access-Control-Allow-Headers"))
+	assert.Equal(suite.T(), "300", w.Header().Get("Access-Control-Max-Age"))
+	assert.Subset(suite.T(), w.Header().Values("Vary"),
+		[]string{"Origin", "Access-Control-Request-Method", "Access-Control-Request-Headers"})
+}
+
+func (suite *CORSTestSuite) TestSameOriginRequestsUntouched() {
+	w := suite.request("GET", "", nil)
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	assert.Empty(suite.T(), w.Header().Get("Access-Control-Allow-Origin"))
+}
+
+func TestCORSTestSuite(t *testing.T) {
+	suite.Run(t, new(CORSTestSuite))
+}
+
+func TestCORSWildcardOrigin(t *testing.T) {
+	_, err := middleware.NewCORSMiddleware(config.CORSConfig{AllowedOrigins: []string{"*"}, AllowCredentials: true})
+	assert.Error(t, err)
+
+	cors, err := middleware.NewCORSMiddleware(config.CORSConfig{AllowedOrigins: []string{"*"}})
+	assert.NoError(t, err)
+
+	router := gin.New()
+	router.Use(cors)
+	router.GET("/health", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	req, _ := http.NewRequest("GET", "/health", nil)
+	req.Header.Set("Origin", "https://anyone.example")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, "https://anyone.example", w.Header().Get("Access-Control-Allow-Origin"))
+	assert.Empty(t, w.Header().Get("Access-Control-Allow-Credentials"))
+}
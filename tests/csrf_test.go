@@ -0,0 +1,152 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go-auth-system/src/middleware"
+	"go-auth-system/src/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type CSRFTestSuite struct {
+	suite.Suite
+	router *gin.Engine
+}
+
+func (suite *CSRFTestSuite) SetupTest() {
+	gin.SetMode(gin.TestMode)
+	suite.router = gin.New()
+	suite.router.GET("/csrf-token", func(c *gin.Context) {
+		token, err := middleware.NewCSRFToken(c)
+		assert.NoError(suite.T(), err)
+		c.JSON(http.StatusOK, gin.H{"csrf_token": token})
+	})
+	suite.router.POST("/auth/login", middleware.CSRFProtection(), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+}
+
+// fetchToken returns a CSRF token and the session cookie it is bound to
+func (suite *CSRFTestSuite) fetchToken(cookie *http.Cookie) (string, *http.Cookie) {
+	req, _ := http.NewRequest("GET", "/csrf-token", nil)
+	if cookie != nil {
+		req.AddCookie(cookie)
+	}
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+
+	var response struct {
+		CSRFToken string `json:"csrf_token"`
+	}
+	assert.NoError(suite.T(), json.Unmarshal(w.Body.Bytes(), &response))
+
+	if issued := cookiesByName(w)[middleware.CSRFSessionCookie]; issued != nil {
+		cookie = issued
+	}
+	return response.CSRFToken, cookie
+}
+
+func (suite *CSRFTestSuite) post(token string, cookie *http.Cookie, headers map[string]string) int {
+	req, _ := http.NewRequest("POST", "/auth/login", strings.NewReader("{}"))
+	req.Host = "auth.company.io"
+	if token != "" {
+		req.Header.Set("X-CSRF-Token", token)
+	}
+	if cookie != nil {
+		req.AddCookie(cookie)
+	}
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+	return w.Code
+}
+
+func (suite *CSRFTestSuite) TestSignedTokenIsVerified() {
+	token, session := suite.fetchToken(nil)
+	if !assert.NotNil(suite.T(), session) {
+		return
+	}
+	assert.True(suite.T(), session.HttpOnly)
+
+	assert.Equal(suite.T(), http.StatusOK, suite.post(token, session, nil))
+
+	// Further tokens are bound to the same session
+	again, sameSession := suite.fetchToken(session)
+	assert.Equal(suite.T(), session.Value, sameSession.Value)
+	assert.Equal(suite.T(), http.StatusOK, suite.post(again, session, nil))
+}
+
+func (suite *CSRFTestSuite) TestLengthAloneIsNotEnough() {
+	_, session := suite.fetchToken(nil)
+
+	assert.Equal(suite.T(), http.StatusForbidden, suite.post("", session, nil))
+	assert.Equal(suite.T(), http.StatusForbidden, suite.post(strings.Repeat("a", 64), session, nil))
+}
+
+func (suite *CSRFTestSuite) TestTokenIsBoundToSession() {
+	token, session := suite.fetchToken(nil)
+	_, otherSession := suite.fetchToken(nil)
+
+	assert.Equal(suite.T(), http.StatusForbidden, suite.post(token, otherSession, nil))
+	assert.Equal(suite.T(), http.StatusForbidden, suite.post(token, nil, nil))
+
+	// Tampering with the expiry breaks the signature
+	parts := strings.SplitN(token, ".", 2)
+	assert.Equal(suite.T(), http.StatusForbidden, suite.post("9"+parts[0]+"."+parts[1], session, nil))
+}
+
+func (suite *CSRFTestSuite) TestOriginFallback() {
+	// Without a token, a same-origin browser request is still accepted
+	assert.Equal(suite.T(), http.StatusOK, suite.post("", nil, map[string]string{"Origin": "https://auth.company.io"}))
+	assert.Equal(suite.T(), http.StatusOK, suite.post("", nil, map[string]string{"Referer": "https://auth.company.io/login"}))
+	assert.Equal(suite.T(), http.StatusForbidden, suite.post("", nil, map[string]string{"Origin": "https://evil.example"}))
+	assert.Equal(suite.T(), http.StatusForbidden, suite.post("", nil, map[string]string{"Origin": "null"}))
+
+	// A foreign origin is rejected even with a valid token
+	token, session := suite.fetchToken(nil)
+	assert.Equal(suite.T(), http.StatusForbidden, suite.post(token, session, map[string]string{"Origin": "https://evil.example"}))
+}
+
+func (suite *CSRFTestSuite) TestAllowedOriginsFromConfig() {
+	suite.T().Cleanup(func() { loadConfig(suite.T()) })
+	suite.T().Setenv("ALLOWED_ORIGINS", "https://app.company.io/, https://admin.company.io")
+	loadConfig(suite.T())
+
+	assert.Equal(suite.T(), http.StatusOK, suite.post("", nil, map[string]string{"Origin": "https://app.company.io"}))
+	assert.Equal(suite.T(), http.StatusOK, suite.post("", nil, map[string]string{"Origin": "https://admin.company.io"}))
+	assert.Equal(suite.T(), http.StatusForbidden, suite.post("", nil, map[string]string{"Origin": "http://app.company.io"}))
+
+	// Wildcard subdomains are trusted, but a bare "*" only opens up CORS
+	suite.T().Setenv("ALLOWED_ORIGINS", "*, https://*.tools.company.io")
+	loadConfig(suite.T())
+	assert.Equal(suite.T(), http.StatusOK, suite.post("", nil, map[string]string{"Origin": "https://wiki.tools.company.io"}))
+	assert.Equal(suite.T(), http.StatusForbidden, suite.post("", nil, map[string]string{"Origin": "https://evil.example"}))
+}
+
+func TestCSRFTestSuite(t *testing.T) {
+	suite.Run(t, new(CSRFTestSuite))
+}
+
+func TestCSRFTokenSignature(t *testing.T) {
+	utils.SetCSRFSecret([]byte("first-secret"))
+	defer utils.SetCSRFSecret(nil)
+
+	token, err := utils.GenerateCSRFToken("session-a")
+	assert.NoError(t, err)
+	assert.NoError(t, utils.ValidateCSRFToken(token, "session-a"))
+	assert.ErrorIs(t, utils.ValidateCSRFToken(token, "session-b"), utils.ErrInvalidCSRFToken)
+
+	// Rotating the secret invalidates outstanding tokens
+	utils.SetCSRFSecret([]byte("second-secret"))
+	assert.ErrorIs(t, utils.ValidateCSRFToken(token, "session-a"), utils.ErrInvalidCSRFToken)
+}
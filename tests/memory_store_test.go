@@ -0,0 +1,155 @@
+package tests
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"go-auth-system/src/services"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryStoreExpiry(t *testing.T) {
+	store := services.NewMemoryStore(services.MemoryStoreJanitorInterval)
+	defer store.Close()
+
+	assert.NoError(t, store.BlacklistToken("short-lived", 50*time.Millisecond))
+	assert.NoError(t, store.RevokeSession("session-1", time.Hour))
+
+	blacklisted, _ := store.IsTokenBlacklisted("short-lived")
+	assert.True(t, blacklisted)
+	blacklisted, _ = store.IsTokenBlacklisted("never-seen")
+	assert.False(t, blacklisted)
+
+	time.Sleep(80 * time.Millisecond)
+	blacklisted, _ = store.IsTokenBlacklisted("short-lived")
+	assert.False(t, blacklisted, "expired entries are ignored before the janitor runs")
+
+	revoked, _ := store.IsSessionRevoked("session-1")
+	assert.True(t, revoked)
+}
+
+func TestMemoryStoreJanitorSweepsExpiredEntries(t *testing.T) {
+	store := services.NewMemoryStore(10 * time.Millisecond)
+	defer store.Close()
+
+	for i := 0; i < 100; i++ {
+		assert.NoError(t, store.BlacklistToken(fmt.Sprintf("token-%d", i), 20*time.Millisecond))
+	}
+	assert.NoError(t, store.BlacklistToken("long-lived", time.Hour))
+	assert.Equal(t, 101, store.Len())
+
+	assert.Eventually(t, func() bool { return store.Len() == 1 }, time.Second, 10*time.Millisecond)
+}
+
+func TestMemoryStoreSlidingLog(t *testing.T) {
+	store := services.NewMemoryStore(services.MemoryStoreJanitorInterval)
+	defer store.Close()
+
+	limit := services.RateLimit{Strategy: services.SlidingLog, Limit: 3, Window: time.Minute}
+	start := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	allow := func(at time.Duration) services.RateLimitResult {
+		result, err := store.AllowRequest("rate_limit:ip:203.0.113.7", limit, start.Add(at))
+		assert.NoError(t, err)
+		return result
+	}
+
+	assert.True(t, allow(0).Allowed)
+	assert.True(t, allow(50*time.Second).Allowed)
+	result := allow(59 * time.Second)
+	assert.True(t, result.Allowed)
+	assert.Equal(t, 0, result.Remaining)
+
+	// A fixed window would start over at 60s; the log still holds the last two requests
+	result = allow(61 * time.Second)
+	assert.True(t, result.Allowed, "the request at 0s has left the window")
+	result = allow(62 * time.Second)
+	assert.False(t, result.Allowed)
+	assert.Equal(t, 48*time.Second, result.RetryAfter, "until the request at 50s leaves the window")
+	assert.Equal(t, 59*time.Second, result.Reset)
+
+	// Rejected requests are not logged, so waiting is enough
+	assert.True(t, allow(110*time.Second).Allowed)
+}
+
+func TestMemoryStoreTokenBucket(t *testing.T) {
+	store := services.NewMemoryStore(services.MemoryStoreJanitorInterval)
+	defer store.Close()
+
+	// One token per second, bursts of up to four
+	limit := services.RateLimit{Strategy: services.TokenBucket, Limit: 4, Window: 4 * time.Second}
+	start := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	allow := func(at time.Duration) services.RateLimitResult {
+		result, err := store.AllowRequest("rate_limit:ip:203.0.113.7", limit, start.Add(at))
+		assert.NoError(t, err)
+		return result
+	}
+
+	for i := 0; i < 4; i++ {
+		assert.True(t, allow(0).Allowed)
+	}
+	result := allow(0)
+	assert.False(t, result.Allowed)
+	assert.Equal(t, time.Second, result.RetryAfter)
+	assert.Equal(t, 4*time.Second, result.Reset)
+
+	result = allow(500 * time.Millisecond)
+	assert.False(t, result.Allowed)
+	assert.Equal(t, 500*time.Millisecond, result.RetryAfter)
+
+	assert.True(t, allow(time.Second).Allowed)
+	assert.False(t, allow(time.Second).Allowed)
+
+	// A bucket that had time to refill allows a full burst again, but no more
+	result = allow(time.Minute)
+	assert.True(t, result.Allowed)
+	assert.Equal(t, 3, result.Remaining)
+}
+
+func TestMemoryStoreRateLimitIsAtomic(t *testing.T) {
+	store := services.NewMemoryStore(services.MemoryStoreJanitorInterval)
+	defer store.Close()
+
+	for _, strategy := range []services.RateLimitStrategy{services.SlidingLog, services.TokenBucket} {
+		limit := services.RateLimit{Strategy: strategy, Limit: 20, Window: time.Hour}
+		now := time.Now()
+
+		var wg sync.WaitGroup
+		var mu sync.Mutex
+		allowed := 0
+		for i := 0; i < 50; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				result, err := store.AllowRequest("rate_limit:"+string(strategy), limit, now)
+				assert.NoError(t, err)
+				if result.Allowed {
+					mu.Lock()
+					allowed++
+					mu.Unlock()
+				}
+			}()
+		}
+		wg.Wait()
+		assert.Equal(t, 20, allowed, strategy)
+	}
+}
+
+func TestMemoryStoreSocialStateIsConsumedOnce(t *testing.T) {
+	store := services.NewMemoryStore(services.MemoryStoreJanitorInterval)
+	defer store.Close()
+	states := store.SocialStates()
+
+	assert.NoError(t, states.Save("state-1", services.SocialLoginState{Provider: "corp", Nonce: "n"}, time.Minute))
+
+	data, err := states.Consume("state-1")
+	if assert.NoError(t, err) && assert.NotNil(t, data) {
+		assert.Equal(t, "corp", data.Provider)
+	}
+
+	data, err = states.Consume("state-1")
+	assert.NoError(t, err)
+	assert.Nil(t, data)
+}
@@ -0,0 +1,263 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go-auth-system/src/handlers"
+	"go-auth-system/src/models"
+	"go-auth-system/src/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+type MFATestSuite struct {
+	suite.Suite
+	db       *gorm.DB
+	handler  *handlers.AuthHandler
+	router   *gin.Engine
+	testUser models.User
+}
+
+func (suite *MFATestSuite) SetupTest() {
+	// Fresh in-memory database per test so enrollment state does not leak between tests
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	assert.NoError(suite.T(), err)
+
+	err = db.AutoMigrate(
+		&models.User{},
+		&models.RefreshToken{},
+		&models.MFARecoveryCode{},
+		&models.Role{},
+		&models.Permission{},
+		&models.UserRole{},
+	)
+	assert.NoError(suite.T(), err)
+	seedRoles(suite.T(), db)
+
+	suite.db = db
+	suite.handler = handlers.NewAuthHandler(db, newFakeTokenStore())
+
+	gin.SetMode(gin.TestMode)
+	suite.router = gin.New()
+
+	user := models.User{
+		Email:     "mfa.user@company.io",
+		FirstName: "Mfa",
+		LastName:  "User",
+	}
+	assert.NoError(suite.T(), user.SetPassword("TestPassword123!"))
+	assert.NoError(suite.T(), db.Create(&user).Error)
+	suite.testUser = user
+
+	// Stand-in for AuthMiddleware: authenticate every protected request as the test user
+	authenticated := func(c *gin.Context) {
+		c.Set("userID", suite.testUser.ID)
+		c.Next()
+	}
+
+	suite.router.POST("/auth/login", suite.handler.Login)
+	suite.router.POST("/auth/mfa/verify", suite.handler.VerifyMFA)
+	suite.router.POST("/auth/mfa/enroll", authenticated, suite.handler.EnrollMFA)
+	suite.router.POST("/auth/mfa/confirm", authenticated, suite.handler.ConfirmMFA)
+	suite.router.POST("/auth/mfa/recovery-codes", authenticated, suite.handler.RegenerateRecoveryCodes)
+	suite.router.GET("/auth/me", authenticated, suite.handler.Me)
+}
+
+func (suite *MFATestSuite) postJSON(path string, body interface{}) (*httptest.ResponseRecorder, map[string]interface{}) {
+	jsonData, _ := json.Marshal(body)
+	req, _ := http.NewRequest("POST", path, bytes.NewBuffer(jsonData))
+	req.Header.Set("Content-Type", "application/json")
+
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+
+	var response map[string]interface{}
+	_ = json.Unmarshal(w.Body.Bytes(), &response)
+	return w, response
+}
+
+func (suite *MFATestSuite) login() string {
+	w, response := suite.postJSON("/auth/login", map[string]string{
+		"email":    "mfa.user@company.io",
+		"password": "TestPassword123!",
+	})
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	return response["mfa_token"].(string)
+}
+
+func (suite *MFATestSuite) recoveryCodesRemaining() float64 {
+	req, _ := http.NewRequest("GET", "/auth/me", nil)
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+
+	var response map[string]interface{}
+	_ = json.Unmarshal(w.Body.Bytes(), &response)
+	return response["recovery_codes_remaining"].(float64)
+}
+
+func (suite *MFATestSuite) enroll() (string, []string) {
+	w, response := suite.postJSON("/auth/mfa/enroll", nil)
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	assert.Contains(suite.T(), response["otpauth_uri"], "otpauth://totp/")
+
+	secret := response["secret"].(string)
+	code, err := utils.GenerateTOTPCode(secret, time.Now())
+	assert.NoError(suite.T(), err)
+
+	w, response = suite.postJSON("/auth/mfa/confirm", map[string]string{"code": code})
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+
+	var recoveryCodes []string
+	for _, rc := range response["recovery_codes"].([]interface{}) {
+		recoveryCodes = append(recoveryCodes, rc.(string))
+	}
+	return secret, recoveryCodes
+}
+
+func (suite *MFATestSuite) TestLoginWithoutMFAIssuesTokens() {
+	w, response := suite.postJSON("/auth/login", map[string]string{
+		"email":    "mfa.user@company.io",
+		"password": "TestPassword123!",
+	})
+
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	assert.Contains(suite.T(), response, "access_token")
+	assert.NotContains(suite.T(), response, "mfa_required")
+}
+
+func (suite *MFATestSuite) TestConfirmRejectsInvalidCode() {
+	w, _ := suite.postJSON("/auth/mfa/enroll", nil)
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+
+	w, _ = suite.postJSON("/auth/mfa/confirm", map[string]string{"code": "000000"})
+	assert.Equal(suite.T(), http.StatusUnauthorized, w.Code)
+
+	var user models.User
+	suite.db.First(&user, suite.testUser.ID)
+	assert.False(suite.T(), user.MFAEnabled)
+}
+
+func (suite *MFATestSuite) TestLoginWithMFARequiresSecondFactor() {
+	secret, _ := suite.enroll()
+
+	w, response := suite.postJSON("/auth/login", map[string]string{
+		"email":    "mfa.user@company.io",
+		"password": "TestPassword123!",
+	})
+
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	assert.Equal(suite.T(), true, response["mfa_required"])
+	assert.NotContains(suite.T(), response, "access_token")
+	assert.NotContains(suite.T(), response, "refresh_token")
+
+	mfaToken := response["mfa_token"].(string)
+
+	// The challenge token must not be usable as an access token
+	_, err := utils.ValidateToken(mfaToken, utils.AccessToken)
+	assert.Error(suite.T(), err)
+
+	// Wrong code
+	w, _ = suite.postJSON("/auth/mfa/verify", map[string]string{"mfa_token": mfaToken, "code": "000000"})
+	assert.Equal(suite.T(), http.StatusUnauthorized, w.Code)
+
+	// Correct code, from the step after the one used to confirm enrollment
+	code, _ := utils.GenerateTOTPCode(secret, time.Now().Add(30*time.Second))
+	w, response = suite.postJSON("/auth/mfa/verify", map[string]string{"mfa_token": mfaToken, "code": code})
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	assert.Contains(suite.T(), response, "access_token")
+	assert.Contains(suite.T(), response, "refresh_token")
+}
+
+func (suite *MFATestSuite) TestRecoveryCodeIsSingleUse() {
+	_, recoveryCodes := suite.enroll()
+	assert.Len(suite.T(), recoveryCodes, 10)
+	assert.Equal(suite.T(), float64(10), suite.recoveryCodesRemaining())
+
+	// Only hashes are persisted
+	var stored []models.MFARecoveryCode
+	suite.db.Where("user_id = ?", suite.testUser.ID).Find(&stored)
+	for _, record := range stored {
+		assert.NotContains(suite.T(), recoveryCodes, record.CodeHash)
+	}
+
+	w, response := suite.postJSON("/auth/mfa/verify", map[string]string{
+		"mfa_token":     suite.login(),
+		"recovery_code": recoveryCodes[0],
+	})
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	assert.Contains(suite.T(), response, "access_token")
+	assert.Equal(suite.T(), float64(9), suite.recoveryCodesRemaining())
+
+	// Replaying the same code fails
+	w, _ = suite.postJSON("/auth/mfa/verify", map[string]string{
+		"mfa_token":     suite.login(),
+		"recovery_code": recoveryCodes[0],
+	})
+	assert.Equal(suite.T(), http.StatusUnauthorized, w.Code)
+}
+
+func (suite *MFATestSuite) TestRegenerateRecoveryCodesInvalidatesOldSet() {
+	secret, oldCodes := suite.enroll()
+
+	code, _ := utils.GenerateTOTPCode(secret, time.Now().Add(30*time.Second))
+	w, response := suite.postJSON("/auth/mfa/recovery-codes", map[string]string{"code": code})
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	assert.Len(suite.T(), response["recovery_codes"], 10)
+
+	w, _ = suite.postJSON("/auth/mfa/verify", map[string]string{
+		"mfa_token":     suite.login(),
+		"recovery_code": oldCodes[0],
+	})
+	assert.Equal(suite.T(), http.StatusUnauthorized, w.Code)
+}
+
+func (suite *MFATestSuite) TestTOTPCodeIsSingleUse() {
+	secret, _ := suite.enroll()
+
+	var user models.User
+	suite.db.First(&user, suite.testUser.ID)
+	if !assert.NotNil(suite.T(), user.MFALastStep) {
+		return
+	}
+	codeAt := func(step int64) string {
+		code, _ := utils.GenerateTOTPCode(secret, time.Unix(step*30, 0))
+		return code
+	}
+	confirmed := *user.MFALastStep
+
+	// The code that confirmed enrollment cannot be replayed at login
+	w, _ := suite.postJSON("/auth/mfa/verify", map[string]string{"mfa_token": suite.login(), "code": codeAt(confirmed)})
+	assert.Equal(suite.T(), http.StatusUnauthorized, w.Code)
+
+	w, _ = suite.postJSON("/auth/mfa/verify", map[string]string{"mfa_token": suite.login(), "code": codeAt(confirmed + 1)})
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+
+	// Neither can a code that was accepted, nor one from an earlier step still inside the window
+	w, _ = suite.postJSON("/auth/mfa/verify", map[string]string{"mfa_token": suite.login(), "code": codeAt(confirmed + 1)})
+	assert.Equal(suite.T(), http.StatusUnauthorized, w.Code)
+	w, _ = suite.postJSON("/auth/mfa/recovery-codes", map[string]string{"code": codeAt(confirmed)})
+	assert.Equal(suite.T(), http.StatusUnauthorized, w.Code)
+}
+
+func (suite *MFATestSuite) TestVerifyRejectsAccessToken() {
+	suite.enroll()
+
+	accessToken, err := utils.GenerateAccessToken(suite.testUser.ID)
+	assert.NoError(suite.T(), err)
+
+	w, _ := suite.postJSON("/auth/mfa/verify", map[string]string{"mfa_token": accessToken, "code": "123456"})
+	assert.Equal(suite.T(), http.StatusUnauthorized, w.Code)
+}
+
+func TestMFATestSuite(t *testing.T) {
+	suite.Run(t, new(MFATestSuite))
+}
@@ -0,0 +1,388 @@
+package tests
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"go-auth-system/src/handlers"
+	"go-auth-system/src/middleware"
+	"go-auth-system/src/models"
+	"go-auth-system/src/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+const (
+	oidcRedirectURI  = "https://app.company.io/callback"
+	oidcCodeVerifier = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+)
+
+type OIDCTestSuite struct {
+	suite.Suite
+	db       *gorm.DB
+	router   *gin.Engine
+	testUser models.User
+	signing  *utils.SigningKey
+}
+
+func (suite *OIDCTestSuite) SetupTest() {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	assert.NoError(suite.T(), err)
+
+	err = db.AutoMigrate(
+		&models.User{},
+		&models.RefreshToken{},
+		&models.OAuthClient{},
+		&models.OAuthAuthorizationCode{},
+	)
+	assert.NoError(suite.T(), err)
+	suite.db = db
+
+	// ID tokens are verified by relying parties through the JWKS, so sign them asymmetrically
+	suite.signing, err = utils.GenerateEd25519SigningKey("oidc-test")
+	assert.NoError(suite.T(), err)
+	utils.SetKeyRing(utils.NewKeyRing(suite.signing))
+
+	user := models.User{
+		Email:           "oidc.user@company.io",
+		FirstName:       "Ada",
+		LastName:        "Lovelace",
+		IsEmailVerified: true,
+	}
+	assert.NoError(suite.T(), user.SetPassword("TestPassword123!"))
+	assert.NoError(suite.T(), db.Create(&user).Error)
+	suite.testUser = user
+
+	publicClient := models.OAuthClient{
+		ClientID:      "spa",
+		Name:          "Internal SPA",
+		RedirectURIs:  oidcRedirectURI,
+		AllowedScopes: "openid profile email",
+		IsPublic:      true,
+	}
+	assert.NoError(suite.T(), db.Create(&publicClient).Error)
+
+	confidentialClient := models.OAuthClient{
+		ClientID:      "backend-app",
+		Name:          "Internal backend",
+		RedirectURIs:  oidcRedirectURI,
+		AllowedScopes: "openid email",
+	}
+	assert.NoError(suite.T(), confidentialClient.SetSecret("backend-secret"))
+	assert.NoError(suite.T(), db.Create(&confidentialClient).Error)
+
+	machineClient := models.OAuthClient{
+		ClientID:      "nightly-report",
+		Name:          "Nightly report job",
+		RedirectURIs:  oidcRedirectURI,
+		AllowedScopes: "users:read reports:write",
+		GrantTypes:    "client_credentials",
+	}
+	assert.NoError(suite.T(), machineClient.SetSecret("job-secret"))
+	assert.NoError(suite.T(), db.Create(&machineClient).Error)
+
+	store := newFakeTokenStore()
+	handler := handlers.NewOIDCHandler(db, store)
+	wellKnown := handlers.NewWellKnownHandler()
+
+	// Stand-in for AuthMiddleware that trusts the bearer token like the real one does
+	authenticated := func(c *gin.Context) {
+		claims, err := utils.ValidateToken(strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer "), utils.AccessToken)
+		if err != nil {
+			c.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+		c.Set("userID", claims.UserID)
+		c.Set("scope", claims.Scope)
+		c.Next()
+	}
+
+	gin.SetMode(gin.TestMode)
+	suite.router = gin.New()
+	suite.router.GET("/.well-known/openid-configuration", wellKnown.OpenIDConfiguration)
+	suite.router.POST("/oauth/token", handler.Token)
+	suite.router.GET("/oauth/authorize", authenticated, handler.Authorize)
+	suite.router.GET("/userinfo", middleware.AuthMiddleware(store), middleware.RequireScope("openid"), handler.UserInfo)
+
+	// Routes guarded by the real middleware, telling users and machines apart
+	suite.router.GET("/me-only", middleware.AuthMiddleware(store), middleware.RequireUser(), func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"user_id": c.GetUint("userID")})
+	})
+	suite.router.GET("/service/users/:id", middleware.AuthMiddleware(store), middleware.RequireClient(),
+		middleware.RequireScope(models.PermissionUsersRead), handlers.NewAdminHandler(db).GetUser)
+}
+
+func (suite *OIDCTestSuite) TearDownTest() {
+	utils.SetKeyRing(nil)
+}
+
+func codeChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func (suite *OIDCTestSuite) authorize(params url.Values) *httptest.ResponseRecorder {
+	accessToken, err := utils.GenerateAccessToken(suite.testUser.ID)
+	assert.NoError(suite.T(), err)
+
+	req, _ := http.NewRequest("GET", "/oauth/authorize?"+params.Encode(), nil)
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+	return w
+}
+
+func (suite *OIDCTestSuite) authorizeParams(clientID string) url.Values {
+	return url.Values{
+		"response_type":         {"code"},
+		"client_id":             {clientID},
+		"redirect_uri":          {oidcRedirectURI},
+		"scope":                 {"openid email"},
+		"state":                 {"xyz"},
+		"nonce":                 {"n-0S6_WzA2Mj"},
+		"code_challenge":        {codeChallenge(oidcCodeVerifier)},
+		"code_challenge_method": {"S256"},
+	}
+}
+
+func (suite *OIDCTestSuite) obtainCode(clientID string) string {
+	w := suite.authorize(suite.authorizeParams(clientID))
+	assert.Equal(suite.T(), http.StatusFound, w.Code)
+
+	location, err := url.Parse(w.Header().Get("Location"))
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), "xyz", location.Query().Get("state"))
+	return location.Query().Get("code")
+}
+
+func (suite *OIDCTestSuite) exchange(form url.Values, basicUser, basicPassword string) (*httptest.ResponseRecorder, map[string]interface{}) {
+	req, _ := http.NewRequest("POST", "/oauth/token", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if basicUser != "" {
+		req.SetBasicAuth(basicUser, basicPassword)
+	}
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+
+	var response map[string]interface{}
+	_ = json.Unmarshal(w.Body.Bytes(), &response)
+	return w, response
+}
+
+func (suite *OIDCTestSuite) codeForm(clientID, code string) url.Values {
+	return url.Values{
+		"grant_type":    {"authorization_code"},
+		"client_id":     {clientID},
+		"code":          {code},
+		"redirect_uri":  {oidcRedirectURI},
+		"code_verifier": {oidcCodeVerifier},
+	}
+}
+
+func (suite *OIDCTestSuite) TestDiscoveryDocument() {
+	req, _ := http.NewRequest("GET", "/.well-known/openid-configuration", nil)
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+
+	var doc map[string]interface{}
+	assert.NoError(suite.T(), json.Unmarshal(w.Body.Bytes(), &doc))
+	assert.Contains(suite.T(), doc, "authorization_endpoint")
+	assert.Contains(suite.T(), doc, "jwks_uri")
+	assert.Equal(suite.T(), []interface{}{"S256"}, doc["code_challenge_methods_supported"])
+	assert.Equal(suite.T(), []interface{}{"EdDSA"}, doc["id_token_signing_alg_values_supported"])
+}
+
+func (suite *OIDCTestSuite) TestAuthorizationCodeFlowWithPKCE() {
+	code := suite.obtainCode("spa")
+
+	w, response := suite.exchange(suite.codeForm("spa", code), "", "")
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	assert.Equal(suite.T(), "no-store", w.Header().Get("Cache-Control"))
+
+	// The ID token is verifiable with the published key and carries the requested claims
+	idClaims := &utils.IDTokenClaims{}
+	_, err := jwt.ParseWithClaims(response["id_token"].(string), idClaims, func(token *jwt.Token) (interface{}, error) {
+		return suite.signing.PublicKey, nil
+	})
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), jwt.ClaimStrings{"spa"}, idClaims.Audience)
+	assert.Equal(suite.T(), "n-0S6_WzA2Mj", idClaims.Nonce)
+	assert.Equal(suite.T(), "oidc.user@company.io", idClaims.Email)
+	assert.Empty(suite.T(), idClaims.GivenName, "profile scope was not requested")
+
+	// The access token works at the userinfo endpoint and is limited to its scope
+	req, _ := http.NewRequest("GET", "/userinfo", nil)
+	req.Header.Set("Authorization", "Bearer "+response["access_token"].(string))
+	w = httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	var userInfo map[string]interface{}
+	assert.NoError(suite.T(), json.Unmarshal(w.Body.Bytes(), &userInfo))
+	assert.Equal(suite.T(), "oidc.user@company.io", userInfo["email"])
+	assert.Equal(suite.T(), true, userInfo["email_verified"])
+	assert.NotContains(suite.T(), userInfo, "given_name")
+
+	// But it gives the client no control over the account
+	w = suite.get("/me-only", response["access_token"].(string))
+	assert.Equal(suite.T(), http.StatusForbidden, w.Code)
+
+	// First-party tokens have /auth/me instead of /userinfo
+	firstParty, _ := utils.GenerateAccessToken(suite.testUser.ID)
+	w = suite.get("/userinfo", firstParty)
+	assert.Equal(suite.T(), http.StatusForbidden, w.Code)
+
+	// Codes are single use
+	w, response = suite.exchange(suite.codeForm("spa", code), "", "")
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+	assert.Equal(suite.T(), "invalid_grant", response["error"])
+}
+
+func (suite *OIDCTestSuite) TestAuthorizationCodesAreHashedAndRevocable() {
+	code := suite.obtainCode("spa")
+
+	// Only the digest is stored
+	var stored models.OAuthAuthorizationCode
+	assert.NoError(suite.T(), suite.db.Where("code_hash = ?", utils.HashToken(code)).First(&stored).Error)
+	assert.NotEqual(suite.T(), code, stored.CodeHash)
+
+	// Revoking the user's tokens also takes back the codes not yet exchanged
+	assert.NoError(suite.T(), models.RevokeUserTokens(suite.db, suite.testUser.ID))
+	w, response := suite.exchange(suite.codeForm("spa", code), "", "")
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+	assert.Equal(suite.T(), "invalid_grant", response["error"])
+}
+
+func (suite *OIDCTestSuite) TestWrongCodeVerifierIsRejected() {
+	code := suite.obtainCode("spa")
+
+	form := suite.codeForm("spa", code)
+	form.Set("code_verifier", strings.Repeat("a", 43))
+	w, response := suite.exchange(form, "", "")
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+	assert.Equal(suite.T(), "invalid_grant", response["error"])
+}
+
+func (suite *OIDCTestSuite) TestConfidentialClientMustAuthenticate() {
+	code := suite.obtainCode("backend-app")
+
+	w, response := suite.exchange(suite.codeForm("backend-app", code), "backend-app", "wrong-secret")
+	assert.Equal(suite.T(), http.StatusUnauthorized, w.Code)
+	assert.Equal(suite.T(), "invalid_client", response["error"])
+
+	w, _ = suite.exchange(suite.codeForm("backend-app", code), "backend-app", "backend-secret")
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+}
+
+func (suite *OIDCTestSuite) TestAuthorizeValidation() {
+	// Unregistered redirect URIs are never redirected to
+	params := suite.authorizeParams("spa")
+	params.Set("redirect_uri", "https://evil.io/callback")
+	w := suite.authorize(params)
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+
+	// Missing PKCE is reported back to the client
+	params = suite.authorizeParams("spa")
+	params.Del("code_challenge")
+	w = suite.authorize(params)
+	assert.Equal(suite.T(), http.StatusFound, w.Code)
+	assert.Contains(suite.T(), w.Header().Get("Location"), "error=invalid_request")
+
+	// Scopes beyond the client's allowance are refused
+	params = suite.authorizeParams("backend-app")
+	params.Set("scope", "openid profile")
+	w = suite.authorize(params)
+	assert.Contains(suite.T(), w.Header().Get("Location"), "error=invalid_scope")
+
+	// Clients registered only for client_credentials cannot start the flow
+	w = suite.authorize(suite.authorizeParams("nightly-report"))
+	assert.Equal(suite.T(), http.StatusFound, w.Code)
+	assert.Contains(suite.T(), w.Header().Get("Location"), "error=unauthorized_client")
+}
+
+func (suite *OIDCTestSuite) get(path, accessToken string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest("GET", path, nil)
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+	return w
+}
+
+func (suite *OIDCTestSuite) TestClientCredentialsGrant() {
+	form := url.Values{"grant_type": {"client_credentials"}, "scope": {"users:read"}}
+	w, response := suite.exchange(form, "nightly-report", "job-secret")
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	assert.Equal(suite.T(), "users:read", response["scope"])
+	assert.NotContains(suite.T(), response, "refresh_token")
+
+	machineToken := response["access_token"].(string)
+	claims, err := utils.ValidateToken(machineToken, utils.AccessToken)
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), claims.IsClient())
+	assert.Equal(suite.T(), uint(0), claims.UserID)
+	assert.Equal(suite.T(), "nightly-report", claims.Subject)
+
+	// Machine tokens reach the service routes their scope allows, but never user routes
+	servicePath := fmt.Sprintf("/service/users/%d", suite.testUser.ID)
+	w = suite.get(servicePath, machineToken)
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	assert.Contains(suite.T(), w.Body.String(), suite.testUser.Email)
+	w = suite.get("/me-only", machineToken)
+	assert.Equal(suite.T(), http.StatusForbidden, w.Code)
+
+	form = url.Values{"grant_type": {"client_credentials"}, "scope": {"reports:write"}}
+	_, response = suite.exchange(form, "nightly-report", "job-secret")
+	w = suite.get(servicePath, response["access_token"].(string))
+	assert.Equal(suite.T(), http.StatusForbidden, w.Code)
+	assert.Contains(suite.T(), w.Body.String(), "insufficient_scope")
+
+	// User tokens stay off the service routes, even when granted the scope
+	userToken, _ := utils.GenerateAccessToken(suite.testUser.ID)
+	w = suite.get("/me-only", userToken)
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	w = suite.get(servicePath, userToken)
+	assert.Equal(suite.T(), http.StatusForbidden, w.Code)
+	delegated, _ := utils.GenerateAccessTokenWithOptions(suite.testUser.ID, utils.AccessTokenOptions{
+		Scope:    models.PermissionUsersRead,
+		Audience: []string{"backend-app"},
+	})
+	w = suite.get(servicePath, delegated)
+	assert.Equal(suite.T(), http.StatusForbidden, w.Code)
+}
+
+func (suite *OIDCTestSuite) TestClientCredentialsValidation() {
+	// Scopes the client was never granted
+	form := url.Values{"grant_type": {"client_credentials"}, "scope": {"users:write"}}
+	w, response := suite.exchange(form, "nightly-report", "job-secret")
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+	assert.Equal(suite.T(), "invalid_scope", response["error"])
+
+	// Wrong secret
+	form = url.Values{"grant_type": {"client_credentials"}}
+	w, response = suite.exchange(form, "nightly-report", "nope")
+	assert.Equal(suite.T(), http.StatusUnauthorized, w.Code)
+	assert.Equal(suite.T(), "invalid_client", response["error"])
+
+	// Clients registered only for the authorization code flow
+	w, response = suite.exchange(form, "backend-app", "backend-secret")
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+	assert.Equal(suite.T(), "unauthorized_client", response["error"])
+}
+
+func TestOIDCTestSuite(t *testing.T) {
+	suite.Run(t, new(OIDCTestSuite))
+}
@@ -0,0 +1,110 @@
+package tests
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+
+	"go-auth-system/src/handlers"
+	"go-auth-system/src/middleware"
+	"go-auth-system/src/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestUserRoutesEnforceOwnership(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	assert.NoError(t, err)
+	assert.NoError(t, db.AutoMigrate(&models.User{}))
+
+	alice := models.User{Email: "alice@company.io", PasswordHash: "x", FirstName: "Alice"}
+	bob := models.User{Email: "bob@company.io", PasswordHash: "x", FirstName: "Bob"}
+	assert.NoError(t, db.Create(&alice).Error)
+	assert.NoError(t, db.Create(&bob).Error)
+
+	userHandler := handlers.NewUserHandler(db)
+
+	// Stand-in for AuthMiddleware: the caller and their permissions come from test headers
+	authenticated := func(c *gin.Context) {
+		id, _ := strconv.ParseUint(c.GetHeader("X-Test-User"), 10, 64)
+		c.Set("userID", uint(id))
+		c.Set("permissions", strings.Fields(c.GetHeader("X-Test-Permissions")))
+		c.Next()
+	}
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/user/profile/:id", authenticated,
+		middleware.RequireSelfOrPermission("id", models.PermissionUsersRead), userHandler.GetUser)
+	router.PUT("/user/update/:id", authenticated,
+		middleware.RequireSelfOrPermission("id", models.PermissionUsersWrite), userHandler.UpdateUser)
+
+	request := func(method string, target models.User, caller models.User, permissions string) int {
+		path := "/user/profile/"
+		if method == "PUT" {
+			path = "/user/update/"
+		}
+		req, _ := http.NewRequest(method, path+strconv.FormatUint(uint64(target.ID), 10), strings.NewReader(`{"first_name":"`+target.FirstName+`"}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Test-User", strconv.FormatUint(uint64(caller.ID), 10))
+		req.Header.Set("X-Test-Permissions", permissions)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+
+	tests := []struct {
+		name        string
+		method      string
+		target      models.User
+		permissions string
+		expected    int
+	}{
+		{name: "read own profile", method: "GET", target: alice, expected: http.StatusOK},
+		{name: "read other profile", method: "GET", target: bob, expected: http.StatusForbidden},
+		{name: "read other profile with users:read", method: "GET", target: bob, permissions: "users:read", expected: http.StatusOK},
+		{name: "update own profile", method: "PUT", target: alice, expected: http.StatusOK},
+		{name: "update other profile", method: "PUT", target: bob, expected: http.StatusForbidden},
+		{name: "update other profile with only users:read", method: "PUT", target: bob, permissions: "users:read", expected: http.StatusForbidden},
+		{name: "update other profile with users:write", method: "PUT", target: bob, permissions: "users:write", expected: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logs.Reset()
+			assert.Equal(t, tt.expected, request(tt.method, tt.target, alice, tt.permissions))
+			if tt.expected == http.StatusForbidden {
+				assert.Contains(t, logs.String(), "unauthorized_user_access")
+			}
+		})
+	}
+
+	// Unknown ids are indistinguishable from other users' ids for non-admins
+	assert.Equal(t, http.StatusForbidden, request("GET", models.User{ID: 999}, alice, ""))
+	assert.Equal(t, http.StatusNotFound, request("GET", models.User{ID: 999}, alice, "users:read"))
+
+	// Ids that are not numbers never reach the database, whatever the caller may do
+	for _, id := range []string{"1=1", "1%20OR%201=1", "-1"} {
+		req, _ := http.NewRequest("PUT", "/user/update/"+id, strings.NewReader(`{"first_name":"Mallory"}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Test-User", strconv.FormatUint(uint64(alice.ID), 10))
+		req.Header.Set("X-Test-Permissions", "users:write")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusBadRequest, w.Code, id)
+	}
+	assert.NoError(t, db.First(&bob, bob.ID).Error)
+	assert.Equal(t, "Bob", bob.FirstName)
+}
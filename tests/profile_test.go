@@ -0,0 +1,130 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"go-auth-system/src/handlers"
+	"go-auth-system/src/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+type ProfileTestSuite struct {
+	suite.Suite
+	db     *gorm.DB
+	router *gin.Engine
+	user   models.User
+}
+
+func (suite *ProfileTestSuite) SetupTest() {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	assert.NoError(suite.T(), err)
+	assert.NoError(suite.T(), db.AutoMigrate(&models.User{}))
+	suite.db = db
+
+	suite.user = models.User{Email: "carol@company.io", FirstName: "Carol", LastName: "Smith", IsEmailVerified: true}
+	assert.NoError(suite.T(), suite.user.SetPassword("TestPassword123!"))
+	assert.NoError(suite.T(), db.Create(&suite.user).Error)
+	assert.NoError(suite.T(), db.First(&suite.user, suite.user.ID).Error)
+
+	gin.SetMode(gin.TestMode)
+	suite.router = gin.New()
+	// Stand-in for AuthMiddleware: the profile owner is the caller
+	authenticated := func(c *gin.Context) {
+		c.Set("userID", suite.user.ID)
+		c.Next()
+	}
+	suite.router.PATCH("/user/profile/:id", authenticated, handlers.NewUserHandler(db).UpdateUser)
+}
+
+func (suite *ProfileTestSuite) patch(body interface{}) (*httptest.ResponseRecorder, map[string]interface{}) {
+	jsonData, _ := json.Marshal(body)
+	req, _ := http.NewRequest("PATCH", "/user/profile/"+strconv.FormatUint(uint64(suite.user.ID), 10), bytes.NewBuffer(jsonData))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+
+	var response map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &response)
+	return w, response
+}
+
+func (suite *ProfileTestSuite) reload() models.User {
+	var user models.User
+	assert.NoError(suite.T(), suite.db.First(&user, suite.user.ID).Error)
+	return user
+}
+
+func (suite *ProfileTestSuite) TestPartialUpdateKeepsOmittedFields() {
+	w, response := suite.patch(gin.H{"first_name": "  Caroline "})
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	assert.Equal(suite.T(), "Caroline", response["user"].(map[string]interface{})["first_name"])
+
+	user := suite.reload()
+	assert.Equal(suite.T(), "Caroline", user.FirstName)
+	assert.Equal(suite.T(), "Smith", user.LastName)
+	assert.Equal(suite.T(), "carol@company.io", user.Email)
+}
+
+func (suite *ProfileTestSuite) TestProtectedFieldsCannotBeSet() {
+	w, _ := suite.patch(map[string]interface{}{
+		"last_name":          "Jones",
+		"Email":              "mallory@company.io",
+		"PasswordHash":       "attacker-controlled",
+		"IsEmailVerified":    false,
+		"FailedLoginCount":   0,
+		"LockedUntil":        nil,
+		"password_hash":      "attacker-controlled",
+		"is_email_verified":  false,
+		"failed_login_count": 0,
+	})
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+
+	user := suite.reload()
+	assert.Equal(suite.T(), "Jones", user.LastName)
+	assert.Equal(suite.T(), suite.user.Email, user.Email)
+	assert.Equal(suite.T(), suite.user.PasswordHash, user.PasswordHash)
+	assert.True(suite.T(), user.IsEmailVerified)
+}
+
+func (suite *ProfileTestSuite) TestInvalidInput() {
+	w, _ := suite.patch(gin.H{"first_name": "<script>"})
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+
+	w, _ = suite.patch(gin.H{"Email": "mallory@company.io"})
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+
+	assert.Equal(suite.T(), "Carol", suite.reload().FirstName)
+}
+
+func (suite *ProfileTestSuite) TestConcurrentEditsConflict() {
+	seen := suite.user.UpdatedAt
+
+	// First tab saves with the version it loaded
+	w, response := suite.patch(gin.H{"first_name": "Caroline", "updated_at": seen})
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	assert.NotEmpty(suite.T(), response["user"].(map[string]interface{})["updated_at"])
+
+	// Second tab still holds the old version and must not overwrite the first edit
+	w, response = suite.patch(gin.H{"first_name": "Carrie", "updated_at": seen})
+	assert.Equal(suite.T(), http.StatusConflict, w.Code)
+	assert.Equal(suite.T(), "Caroline", suite.reload().FirstName)
+
+	// Retrying with the version from the conflict response succeeds
+	w, _ = suite.patch(gin.H{"first_name": "Carrie", "updated_at": response["updated_at"]})
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	assert.Equal(suite.T(), "Carrie", suite.reload().FirstName)
+}
+
+func TestProfileTestSuite(t *testing.T) {
+	suite.Run(t, new(ProfileTestSuite))
+}
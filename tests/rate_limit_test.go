@@ -0,0 +1,204 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"go-auth-system/src/config"
+	"go-auth-system/src/middleware"
+	"go-auth-system/src/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeClock only moves when a test advances it
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Now()}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// rateLimitPolicies parses rules the way RATE_LIMIT_<NAME> settings are parsed
+func rateLimitPolicies(t *testing.T, rules map[string]string) map[string]config.RateLimitPolicy {
+	policies := make(map[string]config.RateLimitPolicy, len(rules))
+	for name, rule := range rules {
+		policy, err := config.ParseRateLimitPolicy(name, rule)
+		assert.NoError(t, err)
+		policies[name] = policy
+	}
+	return policies
+}
+
+// newRateLimitedRouter serves GET / behind the named policy, counted on the clock. Requests come
+// from one logged-in user, so per-user policies count them as well.
+func newRateLimitedRouter(store services.TokenStore, policies map[string]config.RateLimitPolicy, name string, clock *fakeClock) *gin.Engine {
+	rateLimiter := middleware.NewRateLimiter(store, policies)
+	rateLimiter.Clock = clock.Now
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	authenticated := func(c *gin.Context) { c.Set("userID", uint(7)) }
+	router.GET("/", authenticated, rateLimiter.Limit(name), func(c *gin.Context) { c.Status(http.StatusOK) })
+	return router
+}
+
+func rateLimitedGet(router *gin.Engine) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "203.0.113.7:4711"
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+// TestRateLimitPoliciesHoldForTheirWindow walks a fake clock through every default policy, so a
+// window given in the wrong unit shows up as a limit that lets everything through.
+func TestRateLimitPoliciesHoldForTheirWindow(t *testing.T) {
+	clearConfigEnv(t)
+	loadConfig(t)
+
+	for name, policy := range config.GetRateLimits() {
+		t.Run(name, func(t *testing.T) {
+			store := services.NewMemoryStore(services.MemoryStoreJanitorInterval)
+			defer store.Close()
+			clock := newFakeClock()
+			router := newRateLimitedRouter(store, config.GetRateLimits(), name, clock)
+
+			allowed := func() bool { return rateLimitedGet(router).Code == http.StatusOK }
+			burst := func() int {
+				count := 0
+				for i := 0; i <= policy.Limit; i++ {
+					if allowed() {
+						count++
+					}
+				}
+				return count
+			}
+
+			assert.Equal(t, policy.Limit, burst(), "the full limit is available at first")
+
+			switch policy.Strategy {
+			case "sliding-log":
+				clock.Advance(policy.Window - time.Millisecond)
+				assert.False(t, allowed(), "still limited just before the window has passed")
+				clock.Advance(time.Millisecond)
+				assert.Equal(t, policy.Limit, burst(), "the full limit is back once the window has passed")
+			case "token-bucket":
+				refill := policy.Window / time.Duration(policy.Limit)
+				clock.Advance(refill - time.Millisecond)
+				assert.False(t, allowed(), "no token before one has been refilled")
+				clock.Advance(time.Millisecond)
+				assert.True(t, allowed(), "one token is refilled every window/limit")
+				assert.False(t, allowed())
+				clock.Advance(policy.Window)
+				assert.Equal(t, policy.Limit, burst(), "the bucket is full again after a window")
+			default:
+				t.Fatalf("unexpected strategy %q", policy.Strategy)
+			}
+		})
+	}
+}
+
+func TestRateLimitHeaders(t *testing.T) {
+	store := services.NewMemoryStore(services.MemoryStoreJanitorInterval)
+	defer store.Close()
+	rateLimiter := middleware.NewRateLimiter(store, rateLimitPolicies(t, map[string]string{
+		config.RateLimitPublic: "100/1h per ip token-bucket",
+		config.RateLimitLogin:  "2/1h per ip sliding-log",
+	}))
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/auth/login",
+		rateLimiter.Limit(config.RateLimitPublic),
+		rateLimiter.Limit(config.RateLimitLogin),
+		func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	login := func() *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("POST", "/auth/login", nil)
+		req.RemoteAddr = "203.0.113.7:4711"
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// The stricter login limit is the one reported
+	w := login()
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "2", w.Header().Get("RateLimit-Limit"))
+	assert.Equal(t, "1", w.Header().Get("RateLimit-Remaining"))
+	assert.Equal(t, "3600", w.Header().Get("RateLimit-Reset"))
+	assert.Empty(t, w.Header().Get("Retry-After"))
+
+	login()
+	w = login()
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "0", w.Header().Get("RateLimit-Remaining"))
+	assert.NotEmpty(t, w.Header().Get("Retry-After"))
+
+	var body map[string]interface{}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	assert.Equal(t, map[string]interface{}{"error": "Too many login attempts"}, body)
+}
+
+func TestRateLimitPerUser(t *testing.T) {
+	store := services.NewMemoryStore(services.MemoryStoreJanitorInterval)
+	defer store.Close()
+	rateLimiter := middleware.NewRateLimiter(store, rateLimitPolicies(t, map[string]string{
+		"api": "1/1m per user",
+	}))
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/", func(c *gin.Context) {
+		if user := c.Query("user"); user != "" {
+			c.Set("userID", user)
+		}
+	}, rateLimiter.Limit("api"), func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	get := func(target string) int {
+		req, _ := http.NewRequest("GET", target, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusOK, get("/?user=1"))
+	assert.Equal(t, http.StatusTooManyRequests, get("/?user=1"))
+	assert.Equal(t, http.StatusOK, get("/?user=2"), "each user has their own budget")
+	assert.Equal(t, http.StatusOK, get("/"), "anonymous requests are not limited per user")
+	assert.Equal(t, http.StatusOK, get("/"))
+}
+
+func TestRateLimiterPolicies(t *testing.T) {
+	policies := rateLimitPolicies(t, map[string]string{config.RateLimitPublic: "off"})
+
+	assert.Panics(t, func() { middleware.NewRateLimiter(newFakeTokenStore(), policies).Limit("unknown") })
+
+	// A disabled policy never reaches the store
+	store := newFakeTokenStore()
+	router := newRateLimitedRouter(store, policies, config.RateLimitPublic, newFakeClock())
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, http.StatusOK, rateLimitedGet(router).Code)
+	}
+	assert.Equal(t, 0, store.calls)
+}
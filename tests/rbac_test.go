@@ -0,0 +1,177 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"go-auth-system/src/handlers"
+	"go-auth-system/src/middleware"
+	"go-auth-system/src/models"
+	"go-auth-system/src/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// seedRoles mirrors the roles and permissions created by migration 011
+func seedRoles(t *testing.T, db *gorm.DB) {
+	var permissions []models.Permission
+	for _, name := range []string{models.PermissionUsersRead, models.PermissionUsersWrite, models.PermissionRolesRead, models.PermissionRolesWrite} {
+		permissions = append(permissions, models.Permission{Name: name})
+	}
+	assert.NoError(t, db.Create(&permissions).Error)
+	assert.NoError(t, db.Create(&models.Role{Name: models.RoleAdmin, Permissions: permissions}).Error)
+	assert.NoError(t, db.Create(&models.Role{Name: models.RoleUser}).Error)
+}
+
+type RBACTestSuite struct {
+	suite.Suite
+	db     *gorm.DB
+	router *gin.Engine
+	admin  models.User
+	member models.User
+}
+
+func (suite *RBACTestSuite) SetupTest() {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	assert.NoError(suite.T(), err)
+	err = db.AutoMigrate(
+		&models.User{},
+		&models.RefreshToken{},
+		&models.Role{},
+		&models.Permission{},
+		&models.UserRole{},
+	)
+	assert.NoError(suite.T(), err)
+	seedRoles(suite.T(), db)
+	suite.db = db
+
+	suite.admin = suite.createUser("admin@company.io", models.RoleUser, models.RoleAdmin)
+	suite.member = suite.createUser("member@company.io", models.RoleUser)
+
+	store := newFakeTokenStore()
+	authHandler := handlers.NewAuthHandler(db, store)
+	adminHandler := handlers.NewAdminHandler(db)
+
+	gin.SetMode(gin.TestMode)
+	suite.router = gin.New()
+	suite.router.POST("/auth/login", authHandler.Login)
+	admin := suite.router.Group("/admin", middleware.AuthMiddleware(store), middleware.RequireUser())
+	{
+		admin.GET("/roles", middleware.RequirePermission(models.PermissionRolesRead), adminHandler.ListRoles)
+		admin.GET("/users/:id/roles", middleware.RequirePermission(models.PermissionRolesRead), adminHandler.GetUserRoles)
+		admin.POST("/users/:id/roles", middleware.RequirePermission(models.PermissionRolesWrite), adminHandler.AssignUserRole)
+		admin.DELETE("/users/:id/roles/:role", middleware.RequirePermission(models.PermissionRolesWrite), adminHandler.RemoveUserRole)
+	}
+}
+
+func (suite *RBACTestSuite) createUser(email string, roles ...string) models.User {
+	user := models.User{Email: email, IsEmailVerified: true}
+	assert.NoError(suite.T(), user.SetPassword("TestPassword123!"))
+	assert.NoError(suite.T(), suite.db.Create(&user).Error)
+	for _, role := range roles {
+		assert.NoError(suite.T(), models.AssignRole(suite.db, user.ID, role))
+	}
+	return user
+}
+
+func (suite *RBACTestSuite) login(email string) string {
+	w := suite.request("POST", "/auth/login", "", gin.H{"email": email, "password": "TestPassword123!"})
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+
+	var response map[string]interface{}
+	assert.NoError(suite.T(), json.Unmarshal(w.Body.Bytes(), &response))
+	return response["access_token"].(string)
+}
+
+func (suite *RBACTestSuite) request(method, path, accessToken string, body interface{}) *httptest.ResponseRecorder {
+	jsonData, _ := json.Marshal(body)
+	req, _ := http.NewRequest(method, path, bytes.NewBuffer(jsonData))
+	req.Header.Set("Content-Type", "application/json")
+	if accessToken != "" {
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+	}
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+	return w
+}
+
+func (suite *RBACTestSuite) userRolesPath(user models.User) string {
+	return "/admin/users/" + strconv.FormatUint(uint64(user.ID), 10) + "/roles"
+}
+
+func (suite *RBACTestSuite) TestAccessTokenCarriesRolesAndPermissions() {
+	claims, err := utils.ValidateToken(suite.login("admin@company.io"), utils.AccessToken)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), []string{"admin", "user"}, claims.Roles)
+	assert.Contains(suite.T(), claims.Permissions, models.PermissionRolesWrite)
+
+	claims, err = utils.ValidateToken(suite.login("member@company.io"), utils.AccessToken)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), []string{"user"}, claims.Roles)
+	assert.Empty(suite.T(), claims.Permissions)
+}
+
+func (suite *RBACTestSuite) TestRequirePermission() {
+	w := suite.request("GET", "/admin/roles", suite.login("member@company.io"), nil)
+	assert.Equal(suite.T(), http.StatusForbidden, w.Code)
+
+	w = suite.request("GET", "/admin/roles", suite.login("admin@company.io"), nil)
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	assert.Contains(suite.T(), w.Body.String(), models.PermissionUsersWrite)
+
+	// Machine tokens never hold user permissions
+	clientToken, _ := utils.GenerateClientAccessToken("nightly-report", "roles:read")
+	w = suite.request("GET", "/admin/roles", clientToken, nil)
+	assert.Equal(suite.T(), http.StatusForbidden, w.Code)
+}
+
+func (suite *RBACTestSuite) TestAdminAssignsAndRemovesRoles() {
+	adminToken := suite.login("admin@company.io")
+
+	w := suite.request("POST", suite.userRolesPath(suite.member), adminToken, gin.H{"role": "admin"})
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+
+	// The new role shows up in the member's next token
+	claims, err := utils.ValidateToken(suite.login("member@company.io"), utils.AccessToken)
+	assert.NoError(suite.T(), err)
+	assert.Contains(suite.T(), claims.Roles, "admin")
+
+	w = suite.request("POST", suite.userRolesPath(suite.member), adminToken, gin.H{"role": "superuser"})
+	assert.Equal(suite.T(), http.StatusNotFound, w.Code)
+
+	w = suite.request("DELETE", suite.userRolesPath(suite.member)+"/admin", adminToken, nil)
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	w = suite.request("GET", suite.userRolesPath(suite.member), adminToken, nil)
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	assert.JSONEq(suite.T(), `{"user_id":`+strconv.FormatUint(uint64(suite.member.ID), 10)+`,"roles":["user"],"permissions":[]}`, w.Body.String())
+}
+
+func (suite *RBACTestSuite) TestLastAdminCannotBeRemoved() {
+	w := suite.request("DELETE", suite.userRolesPath(suite.admin)+"/admin", suite.login("admin@company.io"), nil)
+	assert.Equal(suite.T(), http.StatusConflict, w.Code)
+
+	access, err := models.LoadUserAccess(suite.db, suite.admin.ID)
+	assert.NoError(suite.T(), err)
+	assert.Contains(suite.T(), access.Roles, "admin")
+}
+
+func (suite *RBACTestSuite) TestMalformedUserIDIsRejected() {
+	adminToken := suite.login("admin@company.io")
+
+	for _, id := range []string{"1=1", "1%20OR%201=1", "abc", "-1"} {
+		w := suite.request("GET", "/admin/users/"+id+"/roles", adminToken, nil)
+		assert.Equal(suite.T(), http.StatusBadRequest, w.Code, id)
+	}
+}
+
+func TestRBACTestSuite(t *testing.T) {
+	suite.Run(t, new(RBACTestSuite))
+}
@@ -0,0 +1,290 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+
+	"go-auth-system/src/handlers"
+	"go-auth-system/src/middleware"
+	"go-auth-system/src/models"
+	"go-auth-system/src/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+type ReferenceTokenTestSuite struct {
+	suite.Suite
+	db     *gorm.DB
+	router *gin.Engine
+	user   models.User
+}
+
+func (suite *ReferenceTokenTestSuite) SetupTest() {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	assert.NoError(suite.T(), err)
+	err = db.AutoMigrate(
+		&models.User{},
+		&models.RefreshToken{},
+		&models.AccessToken{},
+		&models.OAuthClient{},
+		&models.MFARecoveryCode{},
+		&models.Role{},
+		&models.Permission{},
+		&models.UserRole{},
+	)
+	assert.NoError(suite.T(), err)
+	seedRoles(suite.T(), db)
+	suite.db = db
+
+	suite.user = models.User{Email: "frank@company.io", IsEmailVerified: true}
+	assert.NoError(suite.T(), suite.user.SetPassword("TestPassword123!"))
+	assert.NoError(suite.T(), db.Create(&suite.user).Error)
+
+	resourceServer := models.OAuthClient{ClientID: "orders-api", Name: "Orders API", GrantTypes: "client_credentials"}
+	assert.NoError(suite.T(), resourceServer.SetSecret("orders-secret"))
+	assert.NoError(suite.T(), db.Create(&resourceServer).Error)
+	assert.NoError(suite.T(), db.Create(&models.OAuthClient{
+		ClientID:     "spa",
+		Name:         "Internal SPA",
+		RedirectURIs: oidcRedirectURI,
+		IsPublic:     true,
+	}).Error)
+
+	utils.SetReferenceTokenStore(models.NewReferenceTokenStore(db))
+
+	store := newFakeTokenStore()
+	authHandler := handlers.NewAuthHandler(db, store)
+	oidcHandler := handlers.NewOIDCHandler(db, store)
+
+	gin.SetMode(gin.TestMode)
+	suite.router = gin.New()
+	suite.router.POST("/auth/login", authHandler.Login)
+	suite.router.POST("/auth/refresh", authHandler.RefreshToken)
+	suite.router.POST("/oauth/introspect", oidcHandler.Introspect)
+	suite.router.POST("/oauth/revoke", authHandler.Revoke)
+	protected := suite.router.Group("/", middleware.AuthMiddleware(store), middleware.RequireUser())
+	{
+		protected.POST("/auth/logout", authHandler.Logout)
+		protected.DELETE("/auth/sessions/:id", authHandler.RevokeSession)
+		protected.GET("/me-only", func(c *gin.Context) {
+			c.JSON(http.StatusOK, gin.H{"user_id": c.GetUint("userID")})
+		})
+	}
+}
+
+func (suite *ReferenceTokenTestSuite) TearDownTest() {
+	utils.SetReferenceTokenStore(nil)
+}
+
+func (suite *ReferenceTokenTestSuite) request(method, path, accessToken string, body interface{}) *httptest.ResponseRecorder {
+	jsonData, _ := json.Marshal(body)
+	req, _ := http.NewRequest(method, path, bytes.NewBuffer(jsonData))
+	req.Header.Set("Content-Type", "application/json")
+	if accessToken != "" {
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+	}
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+	return w
+}
+
+func (suite *ReferenceTokenTestSuite) login() loginTokens {
+	w := suite.request("POST", "/auth/login", "", gin.H{"email": suite.user.Email, "password": "TestPassword123!"})
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+
+	var tokens loginTokens
+	assert.NoError(suite.T(), json.Unmarshal(w.Body.Bytes(), &tokens))
+	return tokens
+}
+
+func (suite *ReferenceTokenTestSuite) introspect(clientID, secret string, form url.Values) (int, map[string]interface{}) {
+	req, _ := http.NewRequest("POST", "/oauth/introspect", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(clientID, secret)
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+
+	var response map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &response)
+	return w.Code, response
+}
+
+func (suite *ReferenceTokenTestSuite) revoke(form url.Values) int {
+	req, _ := http.NewRequest("POST", "/oauth/revoke", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+	return w.Code
+}
+
+func (suite *ReferenceTokenTestSuite) TestLoginIssuesOpaqueAccessToken() {
+	tokens := suite.login()
+	assert.True(suite.T(), strings.HasPrefix(tokens.AccessToken, "at_"))
+	assert.Equal(suite.T(), 0, strings.Count(tokens.AccessToken, "."))
+
+	// Only the digest is kept server-side
+	var record models.AccessToken
+	assert.NoError(suite.T(), suite.db.Where("token_hash = ?", utils.HashToken(tokens.AccessToken)).First(&record).Error)
+	assert.Equal(suite.T(), suite.user.ID, *record.UserID)
+	assert.NotEmpty(suite.T(), record.SessionID)
+
+	w := suite.request("GET", "/me-only", tokens.AccessToken, nil)
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+}
+
+func (suite *ReferenceTokenTestSuite) TestLogoutRevokesOpaqueAccessToken() {
+	tokens := suite.login()
+
+	w := suite.request("POST", "/auth/logout", tokens.AccessToken, gin.H{"refresh_token": tokens.RefreshToken})
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+
+	// Revocation lives in the database, so it holds even without Redis
+	w = suite.request("GET", "/me-only", tokens.AccessToken, nil)
+	assert.Equal(suite.T(), http.StatusUnauthorized, w.Code)
+}
+
+func (suite *ReferenceTokenTestSuite) TestRevokingSessionRevokesItsAccessTokens() {
+	laptop := suite.login()
+	phone := suite.login()
+
+	claims, err := utils.ValidateToken(phone.AccessToken, utils.AccessToken)
+	assert.NoError(suite.T(), err)
+
+	w := suite.request("DELETE", "/auth/sessions/"+claims.SessionID, laptop.AccessToken, nil)
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+
+	w = suite.request("GET", "/me-only", phone.AccessToken, nil)
+	assert.Equal(suite.T(), http.StatusUnauthorized, w.Code)
+	w = suite.request("GET", "/me-only", laptop.AccessToken, nil)
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+}
+
+func (suite *ReferenceTokenTestSuite) TestIntrospectActiveAccessToken() {
+	tokens := suite.login()
+
+	code, response := suite.introspect("orders-api", "orders-secret", url.Values{"token": {tokens.AccessToken}})
+	assert.Equal(suite.T(), http.StatusOK, code)
+	assert.Equal(suite.T(), true, response["active"])
+	assert.Equal(suite.T(), strconv.FormatUint(uint64(suite.user.ID), 10), response["sub"])
+	assert.Equal(suite.T(), "Bearer", response["token_type"])
+	assert.NotNil(suite.T(), response["exp"])
+}
+
+func (suite *ReferenceTokenTestSuite) TestIntrospectRefreshTokenWithHint() {
+	tokens := suite.login()
+
+	code, response := suite.introspect("orders-api", "orders-secret", url.Values{
+		"token":           {tokens.RefreshToken},
+		"token_type_hint": {"refresh_token"},
+	})
+	assert.Equal(suite.T(), http.StatusOK, code)
+	assert.Equal(suite.T(), true, response["active"])
+	assert.Equal(suite.T(), "refresh_token", response["token_type"])
+
+	// A rotated refresh token is no longer active
+	w := suite.request("POST", "/auth/refresh", "", gin.H{"refresh_token": tokens.RefreshToken})
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	_, response = suite.introspect("orders-api", "orders-secret", url.Values{"token": {tokens.RefreshToken}})
+	assert.Equal(suite.T(), map[string]interface{}{"active": false}, response)
+}
+
+func (suite *ReferenceTokenTestSuite) TestIntrospectRevokedOrUnknownToken() {
+	tokens := suite.login()
+	suite.request("POST", "/auth/logout", tokens.AccessToken, nil)
+
+	_, response := suite.introspect("orders-api", "orders-secret", url.Values{"token": {tokens.AccessToken}})
+	assert.Equal(suite.T(), map[string]interface{}{"active": false}, response)
+
+	_, response = suite.introspect("orders-api", "orders-secret", url.Values{"token": {"at_not-a-real-token"}})
+	assert.Equal(suite.T(), map[string]interface{}{"active": false}, response)
+}
+
+func (suite *ReferenceTokenTestSuite) TestIntrospectRequiresConfidentialClient() {
+	tokens := suite.login()
+
+	code, _ := suite.introspect("orders-api", "wrong-secret", url.Values{"token": {tokens.AccessToken}})
+	assert.Equal(suite.T(), http.StatusUnauthorized, code)
+
+	req, _ := http.NewRequest("POST", "/oauth/introspect", strings.NewReader(url.Values{
+		"client_id": {"spa"},
+		"token":     {tokens.AccessToken},
+	}.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+	assert.Equal(suite.T(), http.StatusUnauthorized, w.Code)
+	assert.NotContains(suite.T(), w.Body.String(), "active")
+}
+
+func (suite *ReferenceTokenTestSuite) TestRevokeAccessTokenWithoutAuthentication() {
+	tokens := suite.login()
+
+	assert.Equal(suite.T(), http.StatusOK, suite.revoke(url.Values{"token": {tokens.AccessToken}}))
+
+	w := suite.request("GET", "/me-only", tokens.AccessToken, nil)
+	assert.Equal(suite.T(), http.StatusUnauthorized, w.Code)
+
+	// Revoking an access token leaves the session's refresh token alone
+	w = suite.request("POST", "/auth/refresh", "", gin.H{"refresh_token": tokens.RefreshToken})
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+}
+
+func (suite *ReferenceTokenTestSuite) TestRevokeRefreshTokenEndsSession() {
+	tokens := suite.login()
+
+	code := suite.revoke(url.Values{"token": {tokens.RefreshToken}, "token_type_hint": {"refresh_token"}})
+	assert.Equal(suite.T(), http.StatusOK, code)
+
+	var count int64
+	suite.db.Model(&models.RefreshToken{}).Where("user_id = ?", suite.user.ID).Count(&count)
+	assert.Equal(suite.T(), int64(0), count)
+
+	w := suite.request("POST", "/auth/refresh", "", gin.H{"refresh_token": tokens.RefreshToken})
+	assert.Equal(suite.T(), http.StatusUnauthorized, w.Code)
+
+	// The access tokens issued for the session go with it
+	w = suite.request("GET", "/me-only", tokens.AccessToken, nil)
+	assert.Equal(suite.T(), http.StatusUnauthorized, w.Code)
+}
+
+func (suite *ReferenceTokenTestSuite) TestRevokeWrongHintStillRevokes() {
+	tokens := suite.login()
+
+	code := suite.revoke(url.Values{"token": {tokens.RefreshToken}, "token_type_hint": {"access_token"}})
+	assert.Equal(suite.T(), http.StatusOK, code)
+
+	w := suite.request("POST", "/auth/refresh", "", gin.H{"refresh_token": tokens.RefreshToken})
+	assert.Equal(suite.T(), http.StatusUnauthorized, w.Code)
+}
+
+func (suite *ReferenceTokenTestSuite) TestRevokeInvalidToken() {
+	assert.Equal(suite.T(), http.StatusOK, suite.revoke(url.Values{"token": {"at_not-a-real-token"}}))
+	assert.Equal(suite.T(), http.StatusOK, suite.revoke(url.Values{"token": {"not.a.jwt"}}))
+	assert.Equal(suite.T(), http.StatusBadRequest, suite.revoke(url.Values{}))
+}
+
+func (suite *ReferenceTokenTestSuite) TestJWTRemainsDefault() {
+	utils.SetReferenceTokenStore(nil)
+
+	tokens := suite.login()
+	assert.False(suite.T(), utils.IsReferenceToken(tokens.AccessToken))
+	assert.Equal(suite.T(), 2, strings.Count(tokens.AccessToken, "."))
+
+	// Introspection works for self-contained tokens too
+	_, response := suite.introspect("orders-api", "orders-secret", url.Values{"token": {tokens.AccessToken}})
+	assert.Equal(suite.T(), true, response["active"])
+}
+
+func TestReferenceTokenTestSuite(t *testing.T) {
+	suite.Run(t, new(ReferenceTokenTestSuite))
+}
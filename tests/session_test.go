@@ -0,0 +1,264 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"testing"
+
+	"go-auth-system/src/handlers"
+	"go-auth-system/src/middleware"
+	"go-auth-system/src/models"
+	"go-auth-system/src/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+const (
+	firefoxOnWindows = "Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:128.0) Gecko/20100101 Firefox/128.0"
+	safariOnIPhone   = "Mozilla/5.0 (iPhone; CPU iPhone OS 17_5 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.5 Mobile/15E148 Safari/604.1"
+)
+
+type SessionTestSuite struct {
+	suite.Suite
+	db     *gorm.DB
+	store  *fakeTokenStore
+	router *gin.Engine
+	user   models.User
+}
+
+type loginTokens struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+func (suite *SessionTestSuite) SetupTest() {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	assert.NoError(suite.T(), err)
+	err = db.AutoMigrate(
+		&models.User{},
+		&models.RefreshToken{},
+		&models.MFARecoveryCode{},
+		&models.Role{},
+		&models.Permission{},
+		&models.UserRole{},
+	)
+	assert.NoError(suite.T(), err)
+	seedRoles(suite.T(), db)
+	suite.db = db
+
+	suite.user = models.User{Email: "erin@company.io", IsEmailVerified: true}
+	assert.NoError(suite.T(), suite.user.SetPassword("TestPassword123!"))
+	assert.NoError(suite.T(), db.Create(&suite.user).Error)
+
+	store := newFakeTokenStore()
+	suite.store = store
+	authHandler := handlers.NewAuthHandler(db, store)
+
+	gin.SetMode(gin.TestMode)
+	suite.router = gin.New()
+	suite.router.POST("/auth/login", authHandler.Login)
+	suite.router.POST("/auth/refresh", authHandler.RefreshToken)
+	protected := suite.router.Group("/auth", middleware.AuthMiddleware(store), middleware.RequireUser())
+	{
+		protected.GET("/sessions", authHandler.ListSessions)
+		protected.DELETE("/sessions/:id", authHandler.RevokeSession)
+		protected.POST("/sessions/revoke-others", authHandler.RevokeOtherSessions)
+	}
+}
+
+func (suite *SessionTestSuite) request(method, path, accessToken, userAgent string, body interface{}) *httptest.ResponseRecorder {
+	jsonData, _ := json.Marshal(body)
+	req, _ := http.NewRequest(method, path, bytes.NewBuffer(jsonData))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", userAgent)
+	req.RemoteAddr = "203.0.113.7:51000"
+	if accessToken != "" {
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+	}
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+	return w
+}
+
+func (suite *SessionTestSuite) login(userAgent string) loginTokens {
+	w := suite.request("POST", "/auth/login", "", userAgent, gin.H{"email": suite.user.Email, "password": "TestPassword123!"})
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+
+	var tokens loginTokens
+	assert.NoError(suite.T(), json.Unmarshal(w.Body.Bytes(), &tokens))
+	return tokens
+}
+
+func (suite *SessionTestSuite) sessions(accessToken string) []models.Session {
+	w := suite.request("GET", "/auth/sessions", accessToken, firefoxOnWindows, nil)
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	assert.NotContains(suite.T(), w.Body.String(), "token")
+
+	var response struct {
+		Sessions []models.Session `json:"sessions"`
+	}
+	assert.NoError(suite.T(), json.Unmarshal(w.Body.Bytes(), &response))
+	return response.Sessions
+}
+
+func (suite *SessionTestSuite) refresh(tokens loginTokens) int {
+	return suite.request("POST", "/auth/refresh", "", firefoxOnWindows, gin.H{"refresh_token": tokens.RefreshToken}).Code
+}
+
+func (suite *SessionTestSuite) TestListSessionsShowsDevices() {
+	laptop := suite.login(firefoxOnWindows)
+	suite.login(safariOnIPhone)
+
+	sessions := suite.sessions(laptop.AccessToken)
+	assert.Len(suite.T(), sessions, 2)
+
+	labels := map[string]bool{}
+	for _, session := range sessions {
+		labels[session.Label] = session.Current
+		assert.NotNil(suite.T(), session.LastUsedAt)
+		assert.Equal(suite.T(), "203.0.113.7", session.IPAddress)
+	}
+	assert.Equal(suite.T(), map[string]bool{"Firefox on Windows": true, "Safari on iOS": false}, labels)
+}
+
+func (suite *SessionTestSuite) TestRefreshKeepsSessionID() {
+	tokens := suite.login(safariOnIPhone)
+	before, err := utils.ValidateToken(tokens.AccessToken, utils.AccessToken)
+	assert.NoError(suite.T(), err)
+	assert.NotEmpty(suite.T(), before.SessionID)
+
+	w := suite.request("POST", "/auth/refresh", "", safariOnIPhone, gin.H{"refresh_token": tokens.RefreshToken})
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	var refreshed loginTokens
+	assert.NoError(suite.T(), json.Unmarshal(w.Body.Bytes(), &refreshed))
+
+	after, err := utils.ValidateToken(refreshed.AccessToken, utils.AccessToken)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), before.SessionID, after.SessionID)
+	assert.Len(suite.T(), suite.sessions(refreshed.AccessToken), 1)
+}
+
+func (suite *SessionTestSuite) TestRevokeSingleSession() {
+	laptop := suite.login(firefoxOnWindows)
+	phone := suite.login(safariOnIPhone)
+
+	claims, _ := utils.ValidateToken(phone.AccessToken, utils.AccessToken)
+	w := suite.request("DELETE", "/auth/sessions/"+claims.SessionID, laptop.AccessToken, firefoxOnWindows, nil)
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+
+	assert.Equal(suite.T(), http.StatusUnauthorized, suite.refresh(phone))
+	assert.Len(suite.T(), suite.sessions(laptop.AccessToken), 1)
+}
+
+func (suite *SessionTestSuite) TestCannotRevokeAnotherUsersSession() {
+	other := models.User{Email: "frank@company.io", IsEmailVerified: true}
+	assert.NoError(suite.T(), other.SetPassword("TestPassword123!"))
+	assert.NoError(suite.T(), suite.db.Create(&other).Error)
+	otherSession := models.RefreshToken{UserID: other.ID, TokenHash: utils.HashToken("frank-refresh-token"), ExpiresAt: suite.user.CreatedAt.AddDate(1, 0, 0)}
+	assert.NoError(suite.T(), suite.db.Create(&otherSession).Error)
+
+	tokens := suite.login(firefoxOnWindows)
+	w := suite.request("DELETE", "/auth/sessions/"+strconv.FormatUint(uint64(otherSession.ID), 10), tokens.AccessToken, firefoxOnWindows, nil)
+	assert.Equal(suite.T(), http.StatusNotFound, w.Code)
+
+	var count int64
+	suite.db.Model(&models.RefreshToken{}).Where("id = ?", otherSession.ID).Count(&count)
+	assert.Equal(suite.T(), int64(1), count)
+}
+
+func (suite *SessionTestSuite) TestRevokeOtherSessions() {
+	laptop := suite.login(firefoxOnWindows)
+	phone := suite.login(safariOnIPhone)
+	tablet := suite.login(safariOnIPhone)
+
+	w := suite.request("POST", "/auth/sessions/revoke-others", laptop.AccessToken, firefoxOnWindows, nil)
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	assert.Contains(suite.T(), w.Body.String(), `"revoked":2`)
+
+	assert.Equal(suite.T(), http.StatusUnauthorized, suite.refresh(phone))
+	assert.Equal(suite.T(), http.StatusUnauthorized, suite.refresh(tablet))
+	assert.Equal(suite.T(), http.StatusOK, suite.refresh(laptop))
+}
+
+func (suite *SessionTestSuite) TestRevokeSessionReportsStoreFailure() {
+	// Failed revocation checks let tokens through, so only the revocation write fails
+	clearConfigEnv(suite.T())
+	suite.T().Setenv("REVOCATION_FAILURE_POLICY", "open")
+	loadConfig(suite.T())
+
+	laptop := suite.login(firefoxOnWindows)
+	phone := suite.login(safariOnIPhone)
+	claims, _ := utils.ValidateToken(phone.AccessToken, utils.AccessToken)
+
+	suite.store.err = errRedisDown
+	w := suite.request("DELETE", "/auth/sessions/"+claims.SessionID, laptop.AccessToken, firefoxOnWindows, nil)
+	assert.Equal(suite.T(), http.StatusServiceUnavailable, w.Code)
+	w = suite.request("POST", "/auth/sessions/revoke-others", laptop.AccessToken, firefoxOnWindows, nil)
+	assert.Equal(suite.T(), http.StatusServiceUnavailable, w.Code)
+
+	// The session is still listed, so the user can retry once the store is back
+	suite.store.err = nil
+	assert.Len(suite.T(), suite.sessions(laptop.AccessToken), 2)
+	w = suite.request("DELETE", "/auth/sessions/"+claims.SessionID, laptop.AccessToken, firefoxOnWindows, nil)
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	assert.Equal(suite.T(), http.StatusUnauthorized, suite.refresh(phone))
+}
+
+func (suite *SessionTestSuite) TestReplayedRefreshTokenRevokesFamily() {
+	stolen := suite.login(safariOnIPhone)
+	other := suite.login(firefoxOnWindows)
+
+	// The legitimate client rotates the token
+	w := suite.request("POST", "/auth/refresh", "", safariOnIPhone, gin.H{"refresh_token": stolen.RefreshToken})
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	var rotated loginTokens
+	assert.NoError(suite.T(), json.Unmarshal(w.Body.Bytes(), &rotated))
+
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+
+	// Replaying the rotated token is treated as theft
+	assert.Equal(suite.T(), http.StatusUnauthorized, suite.refresh(stolen))
+	assert.Contains(suite.T(), logs.String(), `"event_type":"refresh_token_reuse"`)
+	assert.Contains(suite.T(), logs.String(), `"risk_level":"high"`)
+
+	// ...so the token the legitimate client holds now is revoked with the rest of the family
+	assert.Equal(suite.T(), http.StatusUnauthorized, suite.refresh(rotated))
+
+	claims, _ := utils.ValidateToken(stolen.AccessToken, utils.AccessToken)
+	var remaining int64
+	suite.db.Model(&models.RefreshToken{}).Where("id = ?", claims.SessionID).Count(&remaining)
+	assert.Equal(suite.T(), int64(0), remaining)
+
+	// Sessions from other logins are untouched
+	assert.Equal(suite.T(), http.StatusOK, suite.refresh(other))
+}
+
+func (suite *SessionTestSuite) TestRotatedTokensAreNotListedAsSessions() {
+	tokens := suite.login(firefoxOnWindows)
+	for i := 0; i < 3; i++ {
+		w := suite.request("POST", "/auth/refresh", "", firefoxOnWindows, gin.H{"refresh_token": tokens.RefreshToken})
+		assert.Equal(suite.T(), http.StatusOK, w.Code)
+		assert.NoError(suite.T(), json.Unmarshal(w.Body.Bytes(), &tokens))
+	}
+
+	assert.Len(suite.T(), suite.sessions(tokens.AccessToken), 1)
+
+	var family int64
+	suite.db.Model(&models.RefreshToken{}).Where("user_id = ?", suite.user.ID).Count(&family)
+	assert.Equal(suite.T(), int64(4), family)
+}
+
+func TestSessionTestSuite(t *testing.T) {
+	suite.Run(t, new(SessionTestSuite))
+}
@@ -0,0 +1,344 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"go-auth-system/src/config"
+	"go-auth-system/src/handlers"
+	"go-auth-system/src/models"
+	"go-auth-system/src/services"
+	"go-auth-system/src/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+const socialClientID = "go-auth-system"
+
+// fakeIssuer is a minimal OIDC provider: discovery, JWKS and a token endpoint that redeems
+// codes handed out by issue
+type fakeIssuer struct {
+	server *httptest.Server
+	key    *utils.SigningKey
+
+	mu    sync.Mutex
+	codes map[string]*utils.IDTokenClaims
+}
+
+func newFakeIssuer(t *testing.T) *fakeIssuer {
+	key, err := utils.GenerateEd25519SigningKey("upstream-1")
+	assert.NoError(t, err)
+
+	issuer := &fakeIssuer{key: key, codes: make(map[string]*utils.IDTokenClaims)}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 issuer.server.URL,
+			"authorization_endpoint": issuer.server.URL + "/authorize",
+			"token_endpoint":         issuer.server.URL + "/token",
+			"jwks_uri":               issuer.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(utils.NewKeyRing(issuer.key).PublicJWKS())
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+		issuer.mu.Lock()
+		claims, ok := issuer.codes[r.PostForm.Get("code")]
+		delete(issuer.codes, r.PostForm.Get("code"))
+		issuer.mu.Unlock()
+		if !ok || r.PostForm.Get("client_id") != socialClientID || r.PostForm.Get("code_verifier") == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			_ = json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+
+		token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, claims)
+		token.Header["kid"] = issuer.key.ID
+		idToken, _ := token.SignedString(issuer.key.PrivateKey)
+		_ = json.NewEncoder(w).Encode(map[string]string{"access_token": "upstream-access", "id_token": idToken})
+	})
+	issuer.server = httptest.NewServer(mux)
+	t.Cleanup(issuer.server.Close)
+	return issuer
+}
+
+// issue returns an authorization code that redeems for an ID token with the given claims.
+// Issuer, audience and expiry default to valid values.
+func (f *fakeIssuer) issue(claims utils.IDTokenClaims) string {
+	if claims.Issuer == "" {
+		claims.Issuer = f.server.URL
+	}
+	if claims.Audience == nil {
+		claims.Audience = jwt.ClaimStrings{socialClientID}
+	}
+	if claims.ExpiresAt == nil {
+		claims.ExpiresAt = jwt.NewNumericDate(time.Now().Add(time.Minute))
+	}
+
+	code, _ := utils.GenerateRandomToken(16)
+	f.mu.Lock()
+	f.codes[code] = &claims
+	f.mu.Unlock()
+	return code
+}
+
+// memoryStateStore stands in for Redis
+type memoryStateStore struct {
+	mu     sync.Mutex
+	states map[string]services.SocialLoginState
+}
+
+func (s *memoryStateStore) Save(state string, data services.SocialLoginState, expiration time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.states[state] = data
+	return nil
+}
+
+func (s *memoryStateStore) Consume(state string) (*services.SocialLoginState, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, ok := s.states[state]
+	if !ok {
+		return nil, nil
+	}
+	delete(s.states, state)
+	return &data, nil
+}
+
+type SocialLoginTestSuite struct {
+	suite.Suite
+	db     *gorm.DB
+	router *gin.Engine
+	issuer *fakeIssuer
+}
+
+// pendingLogin is a started flow as seen by the browser
+type pendingLogin struct {
+	state  string
+	nonce  string
+	cookie *http.Cookie
+}
+
+func (suite *SocialLoginTestSuite) SetupTest() {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	assert.NoError(suite.T(), err)
+	err = db.AutoMigrate(&models.User{}, &models.RefreshToken{}, &models.LinkedIdentity{},
+		&models.Role{}, &models.Permission{}, &models.UserRole{})
+	assert.NoError(suite.T(), err)
+	seedRoles(suite.T(), db)
+	suite.db = db
+
+	suite.issuer = newFakeIssuer(suite.T())
+	providers, err := services.NewProviderRegistry([]config.OAuthProviderConfig{{
+		Name:         "corp",
+		ClientID:     socialClientID,
+		ClientSecret: "upstream-secret",
+		Issuer:       suite.issuer.server.URL,
+		Scopes:       []string{"openid", "email", "profile"},
+		RedirectURL:  "http://localhost:8080/auth/oauth/corp/callback",
+	}}, suite.issuer.server.Client())
+	assert.NoError(suite.T(), err)
+
+	handler := handlers.NewSocialAuthHandler(handlers.NewAuthHandler(db, newFakeTokenStore()), providers,
+		&memoryStateStore{states: make(map[string]services.SocialLoginState)})
+
+	gin.SetMode(gin.TestMode)
+	suite.router = gin.New()
+	suite.router.GET("/auth/oauth/:provider/login", handler.Login)
+	suite.router.GET("/auth/oauth/:provider/callback", handler.Callback)
+	suite.router.POST("/auth/oauth/:provider/link", func(c *gin.Context) {
+		c.Set("userID", uint(1))
+		c.Next()
+	}, handler.Link)
+}
+
+func (suite *SocialLoginTestSuite) startLogin() pendingLogin {
+	req, _ := http.NewRequest("GET", "/auth/oauth/corp/login", nil)
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+	assert.Equal(suite.T(), http.StatusFound, w.Code)
+
+	location, err := url.Parse(w.Header().Get("Location"))
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), suite.issuer.server.URL+"/authorize", location.Scheme+"://"+location.Host+location.Path)
+	assert.Equal(suite.T(), "S256", location.Query().Get("code_challenge_method"))
+
+	cookies := w.Result().Cookies()
+	assert.Len(suite.T(), cookies, 1)
+	return pendingLogin{state: location.Query().Get("state"), nonce: location.Query().Get("nonce"), cookie: cookies[0]}
+}
+
+func (suite *SocialLoginTestSuite) callback(login pendingLogin, code string) (*httptest.ResponseRecorder, map[string]interface{}) {
+	params := url.Values{"state": {login.state}, "code": {code}}
+	req, _ := http.NewRequest("GET", "/auth/oauth/corp/callback?"+params.Encode(), nil)
+	if login.cookie != nil {
+		req.AddCookie(login.cookie)
+	}
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+
+	var response map[string]interface{}
+	_ = json.Unmarshal(w.Body.Bytes(), &response)
+	return w, response
+}
+
+func (suite *SocialLoginTestSuite) upstreamClaims(subject, email, nonce string) utils.IDTokenClaims {
+	verified := true
+	return utils.IDTokenClaims{
+		Email:            email,
+		EmailVerified:    &verified,
+		GivenName:        "Grace",
+		FamilyName:       "Hopper",
+		Nonce:            nonce,
+		RegisteredClaims: jwt.RegisteredClaims{Subject: subject},
+	}
+}
+
+func (suite *SocialLoginTestSuite) TestFirstLoginCreatesLinkedAccount() {
+	login := suite.startLogin()
+	w, response := suite.callback(login, suite.issuer.issue(suite.upstreamClaims("abc-123", "grace@company.io", login.nonce)))
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	assert.NotEmpty(suite.T(), response["access_token"])
+
+	var user models.User
+	assert.NoError(suite.T(), suite.db.Where("email = ?", "grace@company.io").First(&user).Error)
+	assert.True(suite.T(), user.IsEmailVerified)
+	assert.Equal(suite.T(), "Grace", user.FirstName)
+	assert.Empty(suite.T(), user.PasswordHash)
+
+	var identity models.LinkedIdentity
+	assert.NoError(suite.T(), suite.db.Where("provider = ? AND subject = ?", "corp", "abc-123").First(&identity).Error)
+	assert.Equal(suite.T(), user.ID, identity.UserID)
+
+	// Returning users are found by subject, even after changing their email upstream
+	login = suite.startLogin()
+	w, _ = suite.callback(login, suite.issuer.issue(suite.upstreamClaims("abc-123", "grace.hopper@company.io", login.nonce)))
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+
+	var count int64
+	suite.db.Model(&models.User{}).Count(&count)
+	assert.Equal(suite.T(), int64(1), count)
+}
+
+func (suite *SocialLoginTestSuite) TestExistingAccountsAreLinkedOnlyWhenVerified() {
+	verified := models.User{Email: "verified@company.io", IsEmailVerified: true}
+	assert.NoError(suite.T(), verified.SetPassword("TestPassword123!"))
+	assert.NoError(suite.T(), suite.db.Create(&verified).Error)
+	unverified := models.User{Email: "unverified@company.io"}
+	assert.NoError(suite.T(), unverified.SetPassword("TestPassword123!"))
+	assert.NoError(suite.T(), suite.db.Create(&unverified).Error)
+
+	login := suite.startLogin()
+	w, _ := suite.callback(login, suite.issuer.issue(suite.upstreamClaims("sub-1", "verified@company.io", login.nonce)))
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	var identity models.LinkedIdentity
+	assert.NoError(suite.T(), suite.db.Where("subject = ?", "sub-1").First(&identity).Error)
+	assert.Equal(suite.T(), verified.ID, identity.UserID)
+
+	// Whoever registered the unverified account must not keep access to it
+	login = suite.startLogin()
+	w, _ = suite.callback(login, suite.issuer.issue(suite.upstreamClaims("sub-2", "unverified@company.io", login.nonce)))
+	assert.Equal(suite.T(), http.StatusConflict, w.Code)
+
+	// And the provider has to vouch for the address itself
+	login = suite.startLogin()
+	claims := suite.upstreamClaims("sub-3", "new@company.io", login.nonce)
+	claims.EmailVerified = nil
+	w, _ = suite.callback(login, suite.issuer.issue(claims))
+	assert.Equal(suite.T(), http.StatusForbidden, w.Code)
+}
+
+func (suite *SocialLoginTestSuite) TestStateIsSingleUseAndBoundToBrowser() {
+	login := suite.startLogin()
+	withoutCookie := login
+	withoutCookie.cookie = nil
+	w, _ := suite.callback(withoutCookie, suite.issuer.issue(suite.upstreamClaims("abc-123", "grace@company.io", login.nonce)))
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+
+	w, _ = suite.callback(login, suite.issuer.issue(suite.upstreamClaims("abc-123", "grace@company.io", login.nonce)))
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+
+	w, _ = suite.callback(login, suite.issuer.issue(suite.upstreamClaims("abc-123", "grace@company.io", login.nonce)))
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+}
+
+func (suite *SocialLoginTestSuite) TestIDTokenIsVerified() {
+	tests := []struct {
+		name   string
+		modify func(claims *utils.IDTokenClaims)
+	}{
+		{name: "wrong nonce", modify: func(claims *utils.IDTokenClaims) { claims.Nonce = "replayed" }},
+		{name: "wrong audience", modify: func(claims *utils.IDTokenClaims) { claims.Audience = jwt.ClaimStrings{"someone-else"} }},
+		{name: "wrong issuer", modify: func(claims *utils.IDTokenClaims) { claims.Issuer = "https://evil.company.io" }},
+		{name: "expired", modify: func(claims *utils.IDTokenClaims) {
+			claims.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-time.Minute))
+		}},
+	}
+
+	for _, tt := range tests {
+		suite.Run(tt.name, func() {
+			login := suite.startLogin()
+			claims := suite.upstreamClaims("abc-123", "grace@company.io", login.nonce)
+			tt.modify(&claims)
+			w, _ := suite.callback(login, suite.issuer.issue(claims))
+			assert.Equal(suite.T(), http.StatusUnauthorized, w.Code)
+		})
+	}
+
+	var count int64
+	suite.db.Model(&models.User{}).Count(&count)
+	assert.Equal(suite.T(), int64(0), count)
+}
+
+func (suite *SocialLoginTestSuite) TestMFAStillApplies() {
+	user := models.User{Email: "mfa@company.io", IsEmailVerified: true, MFAEnabled: true, MFASecret: "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"}
+	assert.NoError(suite.T(), suite.db.Create(&user).Error)
+	assert.NoError(suite.T(), suite.db.Create(&models.LinkedIdentity{UserID: user.ID, Provider: "corp", Subject: "mfa-sub"}).Error)
+
+	login := suite.startLogin()
+	w, response := suite.callback(login, suite.issuer.issue(suite.upstreamClaims("mfa-sub", "mfa@company.io", login.nonce)))
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	assert.Equal(suite.T(), true, response["mfa_required"])
+	assert.NotContains(suite.T(), response, "access_token")
+}
+
+func (suite *SocialLoginTestSuite) TestLinkIdentityToCurrentUser() {
+	user := models.User{Email: "linker@company.io"}
+	assert.NoError(suite.T(), user.SetPassword("TestPassword123!"))
+	assert.NoError(suite.T(), suite.db.Create(&user).Error)
+
+	req, _ := http.NewRequest("POST", "/auth/oauth/corp/link", nil)
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+
+	var response map[string]string
+	assert.NoError(suite.T(), json.Unmarshal(w.Body.Bytes(), &response))
+	location, _ := url.Parse(response["authorization_url"])
+	login := pendingLogin{state: location.Query().Get("state"), nonce: location.Query().Get("nonce"), cookie: w.Result().Cookies()[0]}
+
+	// The upstream email does not need to match the local account when linking explicitly
+	w, _ = suite.callback(login, suite.issuer.issue(suite.upstreamClaims("gh-42", "someone.else@company.io", login.nonce)))
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+
+	var identity models.LinkedIdentity
+	assert.NoError(suite.T(), suite.db.Where("subject = ?", "gh-42").First(&identity).Error)
+	assert.Equal(suite.T(), user.ID, identity.UserID)
+}
+
+func TestSocialLoginTestSuite(t *testing.T) {
+	suite.Run(t, new(SocialLoginTestSuite))
+}
@@ -0,0 +1,230 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"go-auth-system/src/config"
+	"go-auth-system/src/handlers"
+	"go-auth-system/src/middleware"
+	"go-auth-system/src/models"
+	"go-auth-system/src/services"
+	"go-auth-system/src/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+var errRedisDown = errors.New("dial tcp 10.0.0.5:6379: connect: connection refused")
+
+func TestCircuitBreakerOpensAndRecovers(t *testing.T) {
+	fake := newFakeTokenStore()
+	fake.err = errRedisDown
+	store := services.NewBreakerStore(fake, services.NewCircuitBreaker("redis", 3, 50*time.Millisecond))
+
+	for i := 0; i < 3; i++ {
+		_, err := store.IsTokenBlacklisted("token")
+		assert.ErrorIs(t, err, errRedisDown)
+	}
+
+	// Once open, calls fail fast without reaching the store
+	_, err := store.IsTokenBlacklisted("token")
+	assert.ErrorIs(t, err, services.ErrCircuitOpen)
+	assert.Equal(t, 3, fake.calls)
+
+	health := store.Health()
+	assert.Equal(t, services.BreakerOpen, health.State)
+	assert.Equal(t, 3, health.ConsecutiveFailures)
+	assert.NotNil(t, health.OpenSince)
+
+	// After the cooldown a failing trial call reopens it straight away
+	time.Sleep(60 * time.Millisecond)
+	_, err = store.AllowRequest("rate_limit:ip:203.0.113.7", services.RateLimit{Strategy: services.SlidingLog, Limit: 5, Window: time.Minute}, time.Now())
+	assert.ErrorIs(t, err, errRedisDown)
+	assert.Equal(t, services.BreakerOpen, store.Health().State)
+
+	// A successful trial call closes it again
+	fake.err = nil
+	time.Sleep(60 * time.Millisecond)
+	_, err = store.IsTokenBlacklisted("token")
+	assert.NoError(t, err)
+	assert.Equal(t, services.BreakerClosed, store.Health().State)
+	assert.Equal(t, 0, store.Health().ConsecutiveFailures)
+}
+
+func TestRateLimiterStoreFailurePolicy(t *testing.T) {
+	clearConfigEnv(t)
+	store := newFakeTokenStore()
+	store.err = errRedisDown
+	rateLimiter := middleware.NewRateLimiter(store, rateLimitPolicies(t, map[string]string{
+		config.RateLimitPublic: "2/1m per ip token-bucket",
+	}))
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/ping", rateLimiter.Limit(config.RateLimitPublic), func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	get := func() int {
+		req, _ := http.NewRequest("GET", "/ping", nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// Public endpoints stay up by default
+	loadConfig(t)
+	assert.Equal(t, http.StatusOK, get())
+
+	t.Setenv("RATE_LIMIT_FAILURE_POLICY", "closed")
+	loadConfig(t)
+	assert.Equal(t, http.StatusServiceUnavailable, get())
+}
+
+func TestAuthMiddlewareRevocationFailurePolicy(t *testing.T) {
+	clearConfigEnv(t)
+	store := newFakeTokenStore()
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/me-only", middleware.AuthMiddleware(store), func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	accessToken, err := utils.GenerateAccessToken(42)
+	assert.NoError(t, err)
+	get := func() int {
+		req, _ := http.NewRequest("GET", "/me-only", nil)
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	loadConfig(t)
+	assert.Equal(t, http.StatusOK, get())
+
+	// A revoked token must not work again just because the blacklist is unreachable
+	store.err = errRedisDown
+	assert.Equal(t, http.StatusServiceUnavailable, get())
+
+	t.Setenv("REVOCATION_FAILURE_POLICY", "open")
+	loadConfig(t)
+	assert.Equal(t, http.StatusOK, get())
+
+	t.Setenv("REVOCATION_FAILURE_POLICY", "sometimes")
+	_, err = config.Load()
+	assert.ErrorContains(t, err, "REVOCATION_FAILURE_POLICY must be open or closed")
+}
+
+func TestRevocationWriteFailuresAreReported(t *testing.T) {
+	clearConfigEnv(t)
+	// Even when failed revocation checks let tokens through, failed revocations are not hidden
+	t.Setenv("REVOCATION_FAILURE_POLICY", "open")
+	loadConfig(t)
+
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	assert.NoError(t, err)
+	assert.NoError(t, db.AutoMigrate(&models.User{}, &models.RefreshToken{}, &models.MFARecoveryCode{}, &models.Role{}, &models.Permission{}, &models.UserRole{}))
+	seedRoles(t, db)
+	user := models.User{Email: "grace@company.io", IsEmailVerified: true}
+	assert.NoError(t, user.SetPassword("TestPassword123!"))
+	assert.NoError(t, db.Create(&user).Error)
+
+	store := newFakeTokenStore()
+	authHandler := handlers.NewAuthHandler(db, store)
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/auth/login", authHandler.Login)
+	router.POST("/auth/refresh", authHandler.RefreshToken)
+	router.POST("/auth/revoke", authHandler.Revoke)
+	router.POST("/auth/logout", middleware.AuthMiddleware(store), authHandler.Logout)
+
+	post := func(path, accessToken string, body interface{}) *httptest.ResponseRecorder {
+		jsonData, _ := json.Marshal(body)
+		req, _ := http.NewRequest("POST", path, bytes.NewBuffer(jsonData))
+		req.Header.Set("Content-Type", "application/json")
+		if accessToken != "" {
+			req.Header.Set("Authorization", "Bearer "+accessToken)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := post("/auth/login", "", gin.H{"email": user.Email, "password": "TestPassword123!"})
+	assert.Equal(t, http.StatusOK, w.Code)
+	var tokens loginTokens
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &tokens))
+
+	store.err = errRedisDown
+	assert.Equal(t, http.StatusServiceUnavailable, post("/auth/logout", tokens.AccessToken, gin.H{"refresh_token": tokens.RefreshToken}).Code)
+	assert.Equal(t, http.StatusServiceUnavailable, post("/auth/refresh", "", gin.H{"refresh_token": tokens.RefreshToken}).Code)
+
+	req, _ := http.NewRequest("POST", "/auth/revoke", bytes.NewBufferString("token="+tokens.AccessToken))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+
+	// Nothing was torn down halfway, so retrying once the store is back completes the logout
+	store.err = nil
+	assert.Equal(t, http.StatusOK, post("/auth/logout", tokens.AccessToken, gin.H{"refresh_token": tokens.RefreshToken}).Code)
+	assert.Equal(t, http.StatusUnauthorized, post("/auth/refresh", "", gin.H{"refresh_token": tokens.RefreshToken}).Code)
+	claims, _ := utils.ValidateToken(tokens.AccessToken, utils.AccessToken)
+	revoked, _ := store.IsSessionRevoked(claims.SessionID)
+	assert.True(t, revoked)
+}
+
+func TestHealthReportsDegradedStore(t *testing.T) {
+	clearConfigEnv(t)
+	loadConfig(t)
+
+	fake := newFakeTokenStore()
+	store := services.NewBreakerStore(fake, services.NewCircuitBreaker("redis", 2, time.Minute))
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/health", handlers.NewHealthHandler(store).Health)
+
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+
+	health := func() map[string]interface{} {
+		req, _ := http.NewRequest("GET", "/health", nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var body map[string]interface{}
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+		return body
+	}
+
+	assert.Equal(t, "healthy", health()["status"])
+
+	// A failing store is degraded before enough failures have opened the breaker
+	fake.err = errRedisDown
+	_, _ = store.IsSessionRevoked("session-1")
+
+	body := health()
+	assert.Equal(t, "degraded", body["status"])
+	assert.Equal(t, "closed", body["token_store"].(map[string]interface{})["state"])
+	assert.Equal(t, map[string]interface{}{"rate_limit": "open", "revocation": "closed"}, body["failure_policy"])
+
+	_, _ = store.IsSessionRevoked("session-1")
+	body = health()
+	assert.Equal(t, "degraded", body["status"])
+	assert.Equal(t, "open", body["token_store"].(map[string]interface{})["state"])
+
+	// The error names the Redis host, so it is logged rather than served
+	assert.NotContains(t, body["token_store"], "last_error")
+	assert.Contains(t, logs.String(), errRedisDown.Error())
+}
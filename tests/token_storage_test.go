@@ -0,0 +1,202 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go-auth-system/src/handlers"
+	"go-auth-system/src/models"
+	"go-auth-system/src/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+type TokenStorageTestSuite struct {
+	suite.Suite
+	db     *gorm.DB
+	router *gin.Engine
+}
+
+func (suite *TokenStorageTestSuite) SetupTest() {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	assert.NoError(suite.T(), err)
+	err = db.AutoMigrate(
+		&models.User{},
+		&models.RefreshToken{},
+		&models.PasswordResetToken{},
+		&models.EmailVerificationToken{},
+		&models.AccessToken{},
+		&models.OAuthAuthorizationCode{},
+		&models.Role{},
+		&models.Permission{},
+		&models.UserRole{},
+	)
+	assert.NoError(suite.T(), err)
+	seedRoles(suite.T(), db)
+	suite.db = db
+
+	handler := handlers.NewAuthHandler(db, newFakeTokenStore())
+
+	gin.SetMode(gin.TestMode)
+	suite.router = gin.New()
+	suite.router.POST("/auth/register", handler.Register)
+	suite.router.GET("/auth/verify", handler.VerifyEmail)
+	suite.router.POST("/auth/login", handler.Login)
+	suite.router.POST("/auth/refresh", handler.RefreshToken)
+	suite.router.POST("/auth/password/forgot", handler.ForgotPassword)
+	suite.router.POST("/auth/password/reset", handler.ResetPassword)
+}
+
+func (suite *TokenStorageTestSuite) request(method, path string, body interface{}) (*httptest.ResponseRecorder, map[string]interface{}) {
+	jsonData, _ := json.Marshal(body)
+	req, _ := http.NewRequest(method, path, bytes.NewBuffer(jsonData))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+
+	var response map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &response)
+	return w, response
+}
+
+// assertNotRecoverable checks that no column of any row in the table holds the token, or any
+// part of it long enough to matter, while its digest is there to look it up by
+func (suite *TokenStorageTestSuite) assertNotRecoverable(table, token string) {
+	var rows []map[string]interface{}
+	assert.NoError(suite.T(), suite.db.Table(table).Find(&rows).Error)
+	assert.NotEmpty(suite.T(), rows)
+
+	found := false
+	for _, row := range rows {
+		for column, value := range row {
+			stored := fmt.Sprint(value)
+			assert.NotContains(suite.T(), stored, token[:16], "%s.%s holds the token", table, column)
+			if column == "token_hash" && stored == utils.HashToken(token) {
+				found = true
+			}
+		}
+	}
+	assert.True(suite.T(), found, "%s has no row for the token digest", table)
+}
+
+func (suite *TokenStorageTestSuite) register() string {
+	w, response := suite.request("POST", "/auth/register", gin.H{
+		"email":      "grace@company.io",
+		"password":   "Correct-Horse9!",
+		"first_name": "Grace",
+		"last_name":  "Hopper",
+	})
+	assert.Equal(suite.T(), http.StatusCreated, w.Code)
+	return response["verification_token"].(string)
+}
+
+func (suite *TokenStorageTestSuite) TestEmailVerificationTokenIsHashed() {
+	token := suite.register()
+	suite.assertNotRecoverable("email_verification_tokens", token)
+
+	// Knowing the digest is not enough to verify
+	w, _ := suite.request("GET", "/auth/verify?token="+utils.HashToken(token), nil)
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+
+	w, _ = suite.request("GET", "/auth/verify?token="+token, nil)
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+}
+
+func (suite *TokenStorageTestSuite) TestRefreshTokenIsHashed() {
+	suite.register()
+	w, response := suite.request("POST", "/auth/login", gin.H{"email": "grace@company.io", "password": "Correct-Horse9!"})
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	token := response["refresh_token"].(string)
+	suite.assertNotRecoverable("refresh_tokens", token)
+
+	w, response = suite.request("POST", "/auth/refresh", gin.H{"refresh_token": token})
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	suite.assertNotRecoverable("refresh_tokens", response["refresh_token"].(string))
+}
+
+func (suite *TokenStorageTestSuite) TestPasswordResetTokenIsHashed() {
+	suite.register()
+	w, response := suite.request("POST", "/auth/password/forgot", gin.H{"email": "grace@company.io"})
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+
+	// Without an SMTP server the token comes back in the response
+	token, ok := response["reset_token"].(string)
+	if !ok {
+		suite.T().Skip("password reset email was sent, token not returned")
+	}
+	suite.assertNotRecoverable("password_reset_tokens", token)
+
+	w, _ = suite.request("POST", "/auth/password/reset", gin.H{"token": utils.HashToken(token), "new_password": "Battery-Staple7!"})
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+
+	w, _ = suite.request("POST", "/auth/password/reset", gin.H{"token": token, "new_password": "Battery-Staple7!"})
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+}
+
+func (suite *TokenStorageTestSuite) TestExpiredTokensArePurged() {
+	suite.register()
+	w, response := suite.request("POST", "/auth/login", gin.H{"email": "grace@company.io", "password": "Correct-Horse9!"})
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	// Rotation leaves the old token behind to detect replays
+	w, _ = suite.request("POST", "/auth/refresh", gin.H{"refresh_token": response["refresh_token"]})
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+
+	now := time.Now()
+	for i, expiresAt := range []time.Time{now.Add(-time.Minute), now.Add(time.Minute)} {
+		assert.NoError(suite.T(), suite.db.Create(&models.AccessToken{
+			TokenHash:   utils.HashToken(fmt.Sprintf("at_%d", i)),
+			SubjectType: string(utils.SubjectClient),
+			ClientID:    "nightly-report",
+			IssuedAt:    expiresAt.Add(-utils.AccessTokenTTL),
+			ExpiresAt:   expiresAt,
+		}).Error)
+	}
+
+	for i, expiresAt := range []time.Time{now.Add(-time.Minute), now.Add(time.Minute)} {
+		assert.NoError(suite.T(), suite.db.Create(&models.OAuthAuthorizationCode{
+			CodeHash:      utils.HashToken(fmt.Sprintf("code_%d", i)),
+			ClientID:      "spa",
+			UserID:        1,
+			RedirectURI:   "https://app.company.io/callback",
+			Scope:         "openid",
+			CodeChallenge: "challenge",
+			ExpiresAt:     expiresAt,
+		}).Error)
+	}
+
+	count := func(model interface{}) int64 {
+		var n int64
+		suite.db.Model(model).Count(&n)
+		return n
+	}
+
+	purged, err := models.PurgeExpiredTokens(suite.db, now)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), int64(2), purged)
+	assert.Equal(suite.T(), int64(2), count(&models.RefreshToken{}))
+	assert.Equal(suite.T(), int64(1), count(&models.AccessToken{}))
+	assert.Equal(suite.T(), int64(1), count(&models.OAuthAuthorizationCode{}))
+
+	// Once the refresh tokens have expired, the rotated one goes with the session. Each
+	// connection to :memory: is a database of its own, so the sweeper has to share this one.
+	sqlDB, err := suite.db.DB()
+	assert.NoError(suite.T(), err)
+	sqlDB.SetMaxOpenConns(1)
+	stop := models.StartTokenCleanup(suite.db, 10*time.Millisecond)
+	defer stop()
+	suite.db.Model(&models.RefreshToken{}).Where("1 = 1").Update("expires_at", now.Add(-time.Second))
+	assert.Eventually(suite.T(), func() bool { return count(&models.RefreshToken{}) == 0 }, time.Second, 10*time.Millisecond)
+}
+
+func TestTokenStorageTestSuite(t *testing.T) {
+	suite.Run(t, new(TokenStorageTestSuite))
+}
@@ -0,0 +1,185 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"go-auth-system/src/config"
+	"go-auth-system/src/handlers"
+	"go-auth-system/src/middleware"
+	"go-auth-system/src/models"
+	"go-auth-system/src/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// fakeTokenStore stands in for Redis. Expirations are ignored, tests do not outlive them.
+// Setting err makes every call fail as if Redis was down; calls counts what reached it.
+type fakeTokenStore struct {
+	mu        sync.Mutex
+	blacklist map[string]bool
+	revoked   map[string]bool
+	counters  map[string]int64
+	states    *memoryStateStore
+	err       error
+	calls     int
+}
+
+func newFakeTokenStore() *fakeTokenStore {
+	return &fakeTokenStore{
+		blacklist: make(map[string]bool),
+		revoked:   make(map[string]bool),
+		counters:  make(map[string]int64),
+		states:    &memoryStateStore{states: make(map[string]services.SocialLoginState)},
+	}
+}
+
+func (s *fakeTokenStore) BlacklistToken(token string, expiration time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls++
+	if s.err != nil {
+		return s.err
+	}
+	s.blacklist[token] = true
+	return nil
+}
+
+func (s *fakeTokenStore) IsTokenBlacklisted(token string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls++
+	if s.err != nil {
+		return false, s.err
+	}
+	return s.blacklist[token], nil
+}
+
+func (s *fakeTokenStore) RevokeSession(sessionID string, expiration time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls++
+	if s.err != nil {
+		return s.err
+	}
+	s.revoked[sessionID] = true
+	return nil
+}
+
+func (s *fakeTokenStore) IsSessionRevoked(sessionID string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls++
+	if s.err != nil {
+		return false, s.err
+	}
+	return s.revoked[sessionID], nil
+}
+
+func (s *fakeTokenStore) DeleteUserSession(userID uint) error {
+	return nil
+}
+
+// AllowRequest counts requests without ever forgetting them, whatever the strategy
+func (s *fakeTokenStore) AllowRequest(key string, limit services.RateLimit, now time.Time) (services.RateLimitResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls++
+	if s.err != nil {
+		return services.RateLimitResult{}, s.err
+	}
+	s.counters[key]++
+	allowed := s.counters[key] <= int64(limit.Limit)
+	return services.RateLimitResult{
+		Allowed:   allowed,
+		Limit:     limit.Limit,
+		Remaining: max(limit.Limit-int(s.counters[key]), 0),
+	}, nil
+}
+
+func (s *fakeTokenStore) SocialStates() services.SocialStateStore {
+	return s.states
+}
+
+func (s *fakeTokenStore) Close() error {
+	return nil
+}
+
+func TestLogoutBlacklistsAccessTokenInSharedStore(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	assert.NoError(t, err)
+	assert.NoError(t, db.AutoMigrate(&models.User{}, &models.RefreshToken{}, &models.MFARecoveryCode{},
+		&models.Role{}, &models.Permission{}, &models.UserRole{}))
+	seedRoles(t, db)
+
+	user := models.User{Email: "jules@company.io", IsEmailVerified: true}
+	assert.NoError(t, user.SetPassword("TestPassword123!"))
+	assert.NoError(t, db.Create(&user).Error)
+
+	// The handler writes to the same store the middleware reads from
+	store := newFakeTokenStore()
+	authHandler := handlers.NewAuthHandler(db, store)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/auth/login", authHandler.Login)
+	protected := router.Group("/", middleware.AuthMiddleware(store), middleware.RequireUser())
+	protected.POST("/auth/logout", authHandler.Logout)
+	protected.GET("/me-only", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	body, _ := json.Marshal(gin.H{"email": user.Email, "password": "TestPassword123!"})
+	req, _ := http.NewRequest("POST", "/auth/login", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	var tokens loginTokens
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &tokens))
+
+	get := func() int {
+		req, _ := http.NewRequest("GET", "/me-only", nil)
+		req.Header.Set("Authorization", "Bearer "+tokens.AccessToken)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+	assert.Equal(t, http.StatusOK, get())
+
+	req, _ = http.NewRequest("POST", "/auth/logout", nil)
+	req.Header.Set("Authorization", "Bearer "+tokens.AccessToken)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	assert.True(t, store.blacklist[tokens.AccessToken])
+	assert.Equal(t, http.StatusUnauthorized, get())
+}
+
+func TestRateLimiterCountsInSharedStore(t *testing.T) {
+	store := newFakeTokenStore()
+	rateLimiter := middleware.NewRateLimiter(store, rateLimitPolicies(t, map[string]string{
+		config.RateLimitPublic: "2/1m per ip sliding-log",
+	}))
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/health", rateLimiter.Limit(config.RateLimitPublic), func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	codes := make([]int, 0, 3)
+	for i := 0; i < 3; i++ {
+		req, _ := http.NewRequest("GET", "/health", nil)
+		req.RemoteAddr = "203.0.113.7:4711"
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		codes = append(codes, w.Code)
+	}
+	assert.Equal(t, []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests}, codes)
+	assert.Equal(t, int64(3), store.counters["rate_limit:sliding-log:public:ip:203.0.113.7"])
+}
@@ -0,0 +1,237 @@
+package tests
+
+import (
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"strings"
+	"testing"
+	"time"
+
+	"go-auth-system/src/config"
+	"go-auth-system/src/utils"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+func useKeyRing(t *testing.T, kr *utils.KeyRing) {
+	utils.SetKeyRing(kr)
+	t.Cleanup(func() { utils.SetKeyRing(nil) })
+}
+
+func tokenHeader(t *testing.T, tokenString string) map[string]interface{} {
+	token, _, err := jwt.NewParser().ParseUnverified(tokenString, &utils.Claims{})
+	assert.NoError(t, err)
+	return token.Header
+}
+
+func TestAsymmetricSigning(t *testing.T) {
+	rsaKey, err := utils.GenerateRSASigningKey("rsa-1", 2048)
+	assert.NoError(t, err)
+	edKey, err := utils.GenerateEd25519SigningKey("ed-1")
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name string
+		key  *utils.SigningKey
+		alg  string
+	}{
+		{name: "RS256", key: rsaKey, alg: "RS256"},
+		{name: "EdDSA", key: edKey, alg: "EdDSA"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useKeyRing(t, utils.NewKeyRing(tt.key))
+
+			tokenString, err := utils.GenerateAccessToken(42)
+			assert.NoError(t, err)
+
+			header := tokenHeader(t, tokenString)
+			assert.Equal(t, tt.alg, header["alg"])
+			assert.Equal(t, tt.key.ID, header["kid"])
+
+			claims, err := utils.ValidateToken(tokenString, utils.AccessToken)
+			assert.NoError(t, err)
+			assert.Equal(t, uint(42), claims.UserID)
+		})
+	}
+}
+
+func TestKeyRotationKeepsOutstandingTokensValid(t *testing.T) {
+	oldKey, _ := utils.GenerateEd25519SigningKey("old")
+	newKey, _ := utils.GenerateEd25519SigningKey("new")
+
+	useKeyRing(t, utils.NewKeyRing(oldKey))
+
+	oldToken, err := utils.GenerateAccessToken(7)
+	assert.NoError(t, err)
+
+	// The restarted service signs with the new key and keeps the old one until its retirement
+	kr := utils.NewKeyRing(newKey)
+	kr.AddRetiringKey(oldKey, time.Now().Add(time.Hour))
+	useKeyRing(t, kr)
+
+	newToken, err := utils.GenerateAccessToken(7)
+	assert.NoError(t, err)
+	assert.Equal(t, "new", tokenHeader(t, newToken)["kid"])
+
+	_, err = utils.ValidateToken(oldToken, utils.AccessToken)
+	assert.NoError(t, err, "tokens signed by a retiring key must still validate")
+	_, err = utils.ValidateToken(newToken, utils.AccessToken)
+	assert.NoError(t, err)
+
+	jwks := kr.PublicJWKS()
+	assert.Len(t, jwks.Keys, 2)
+}
+
+func TestExpiredAndUnknownKeysAreRejected(t *testing.T) {
+	retired, _ := utils.GenerateEd25519SigningKey("retired")
+	useKeyRing(t, utils.NewKeyRing(retired))
+	tokenString, err := utils.GenerateAccessToken(7)
+	assert.NoError(t, err)
+
+	// Ring where the signing key has already passed its retirement date
+	active, _ := utils.GenerateEd25519SigningKey("active")
+	kr := utils.NewKeyRing(active)
+	kr.AddRetiringKey(retired, time.Now().Add(-time.Minute))
+	useKeyRing(t, kr)
+
+	_, err = utils.ValidateToken(tokenString, utils.AccessToken)
+	assert.Error(t, err)
+	jwks := kr.PublicJWKS()
+	assert.Len(t, jwks.Keys, 1)
+	assert.Equal(t, "active", jwks.Keys[0].KeyID)
+
+	// Ring that has never seen the key
+	useKeyRing(t, utils.NewKeyRing(active))
+	_, err = utils.ValidateToken(tokenString, utils.AccessToken)
+	assert.Error(t, err)
+}
+
+func TestAlgorithmConfusionIsRejected(t *testing.T) {
+	rsaKey, _ := utils.GenerateRSASigningKey("rsa-1", 2048)
+	useKeyRing(t, utils.NewKeyRing(rsaKey))
+
+	// Forge an HS256 token using the public key bytes as the HMAC secret, claiming the RSA kid
+	publicKey := rsaKey.PublicKey.(*rsa.PublicKey)
+	forged := jwt.NewWithClaims(jwt.SigningMethodHS256, &utils.Claims{
+		UserID:    1,
+		TokenType: utils.AccessToken,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+		},
+	})
+	forged.Header["kid"] = "rsa-1"
+	tokenString, err := forged.SignedString(publicKey.N.Bytes())
+	assert.NoError(t, err)
+
+	_, err = utils.ValidateToken(tokenString, utils.AccessToken)
+	assert.Error(t, err)
+}
+
+func TestJWKSNeverPublishesSecrets(t *testing.T) {
+	hmacKey := utils.NewHMACSigningKey("", []byte("super-secret-value"))
+	rsaKey, _ := utils.GenerateRSASigningKey("", 2048)
+
+	kr := utils.NewKeyRing(rsaKey)
+	kr.AddRetiringKey(hmacKey, time.Now().Add(time.Hour))
+	useKeyRing(t, kr)
+
+	jwks := utils.CurrentJWKS()
+	assert.Len(t, jwks.Keys, 1)
+	assert.Equal(t, "RSA", jwks.Keys[0].KeyType)
+	assert.Equal(t, rsaKey.ID, jwks.Keys[0].KeyID)
+
+	body, err := json.Marshal(jwks)
+	assert.NoError(t, err)
+	assert.False(t, strings.Contains(string(body), "super-secret-value"))
+	assert.NotContains(t, string(body), `"d"`)
+}
+
+func TestLegacyTokensWithoutKidStillValidate(t *testing.T) {
+	// Tokens issued before the key ring existed were HS256 with no kid header
+	legacy := jwt.NewWithClaims(jwt.SigningMethodHS256, &utils.Claims{
+		UserID:    9,
+		TokenType: utils.AccessToken,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+		},
+	})
+	tokenString, err := legacy.SignedString([]byte("your-super-secret-jwt-key-change-in-production"))
+	assert.NoError(t, err)
+
+	hmacKey := utils.NewHMACSigningKey("", []byte("your-super-secret-jwt-key-change-in-production"))
+	kr := utils.NewKeyRing(hmacKey)
+	kr.SetLegacyKey(hmacKey)
+	useKeyRing(t, kr)
+
+	claims, err := utils.ValidateToken(tokenString, utils.AccessToken)
+	assert.NoError(t, err)
+	assert.Equal(t, uint(9), claims.UserID)
+}
+
+func TestKeyRingFromConfigRetiresKeysAtConfiguredTime(t *testing.T) {
+	clearConfigEnv(t)
+
+	retired, _ := utils.GenerateEd25519SigningKey("retired")
+	der, err := x509.MarshalPKCS8PrivateKey(retired.PrivateKey)
+	assert.NoError(t, err)
+	retiredFile := writeConfigFile(t, "retired.pem", string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})))
+	useKeyRing(t, utils.NewKeyRing(retired))
+	retiredToken, err := utils.GenerateAccessToken(7)
+	assert.NoError(t, err)
+
+	legacy := jwt.NewWithClaims(jwt.SigningMethodHS256, &utils.Claims{
+		UserID:    9,
+		TokenType: utils.AccessToken,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+		},
+	})
+	legacyToken, err := legacy.SignedString([]byte(config.DefaultJWTSecret))
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name        string
+		notAfter    time.Time
+		legacyValid bool
+	}{
+		{name: "no retirement time", legacyValid: false},
+		{name: "before retirement", notAfter: time.Now().Add(time.Hour), legacyValid: true},
+		{name: "after retirement", notAfter: time.Now().Add(-time.Minute), legacyValid: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("JWT_SIGNING_ALG", "EdDSA")
+			t.Setenv("JWT_SECRET_NOT_AFTER", "")
+			t.Setenv("JWT_RETIRING_KEY_FILES", "")
+			if !tt.notAfter.IsZero() {
+				t.Setenv("JWT_SECRET_NOT_AFTER", tt.notAfter.Format(time.RFC3339))
+				t.Setenv("JWT_RETIRING_KEY_FILES", "retired="+retiredFile+"@"+tt.notAfter.Format(time.RFC3339))
+			}
+			loadConfig(t)
+
+			kr, err := utils.NewKeyRingFromConfig()
+			if !assert.NoError(t, err) {
+				return
+			}
+			useKeyRing(t, kr)
+
+			_, err = utils.ValidateToken(legacyToken, utils.AccessToken)
+			assert.Equal(t, tt.legacyValid, err == nil, "legacy HS256 token: %v", err)
+			_, err = utils.ValidateToken(retiredToken, utils.AccessToken)
+			assert.Equal(t, tt.legacyValid, err == nil, "retiring key token: %v", err)
+
+			// Building the ring again, as a restart does, must not extend the retirement
+			kr, err = utils.NewKeyRingFromConfig()
+			assert.NoError(t, err)
+			useKeyRing(t, kr)
+			_, err = utils.ValidateToken(legacyToken, utils.AccessToken)
+			assert.Equal(t, tt.legacyValid, err == nil)
+		})
+	}
+}
@@ -0,0 +1,237 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"go-auth-system/src/handlers"
+	"go-auth-system/src/middleware"
+	"go-auth-system/src/models"
+	"go-auth-system/src/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+type TokenWatermarkTestSuite struct {
+	suite.Suite
+	db     *gorm.DB
+	router *gin.Engine
+	user   models.User
+	admin  models.User
+}
+
+func (suite *TokenWatermarkTestSuite) SetupTest() {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	assert.NoError(suite.T(), err)
+	err = db.AutoMigrate(
+		&models.User{},
+		&models.RefreshToken{},
+		&models.PasswordResetToken{},
+		&models.OAuthAuthorizationCode{},
+		&models.MFARecoveryCode{},
+		&models.Role{},
+		&models.Permission{},
+		&models.UserRole{},
+	)
+	assert.NoError(suite.T(), err)
+	seedRoles(suite.T(), db)
+	suite.db = db
+
+	suite.user = models.User{Email: "grace@company.io", IsEmailVerified: true}
+	assert.NoError(suite.T(), suite.user.SetPassword("TestPassword123!"))
+	assert.NoError(suite.T(), db.Create(&suite.user).Error)
+
+	suite.admin = models.User{Email: "helpdesk@company.io", IsEmailVerified: true}
+	assert.NoError(suite.T(), suite.admin.SetPassword("TestPassword123!"))
+	assert.NoError(suite.T(), db.Create(&suite.admin).Error)
+	assert.NoError(suite.T(), models.AssignRole(db, suite.admin.ID, models.RoleAdmin))
+
+	utils.SetTokenWatermarkStore(models.NewTokenWatermarkStore(db))
+
+	store := newFakeTokenStore()
+	authHandler := handlers.NewAuthHandler(db, store)
+	adminHandler := handlers.NewAdminHandler(db)
+
+	gin.SetMode(gin.TestMode)
+	suite.router = gin.New()
+	suite.router.POST("/auth/login", authHandler.Login)
+	suite.router.POST("/auth/refresh", authHandler.RefreshToken)
+	suite.router.POST("/auth/password/reset", authHandler.ResetPassword)
+	protected := suite.router.Group("/", middleware.AuthMiddleware(store), middleware.RequireUser())
+	{
+		protected.GET("/me-only", func(c *gin.Context) {
+			c.JSON(http.StatusOK, gin.H{"user_id": c.GetUint("userID")})
+		})
+		protected.POST("/admin/users/:id/revoke-tokens",
+			middleware.RequirePermission(models.PermissionUsersWrite), adminHandler.RevokeUserTokens)
+	}
+}
+
+func (suite *TokenWatermarkTestSuite) TearDownTest() {
+	utils.SetTokenWatermarkStore(nil)
+}
+
+func (suite *TokenWatermarkTestSuite) request(method, path, accessToken string, body interface{}) *httptest.ResponseRecorder {
+	jsonData, _ := json.Marshal(body)
+	req, _ := http.NewRequest(method, path, bytes.NewBuffer(jsonData))
+	req.Header.Set("Content-Type", "application/json")
+	if accessToken != "" {
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+	}
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+	return w
+}
+
+func (suite *TokenWatermarkTestSuite) login(email, password string) loginTokens {
+	w := suite.request("POST", "/auth/login", "", gin.H{"email": email, "password": password})
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+
+	var tokens loginTokens
+	assert.NoError(suite.T(), json.Unmarshal(w.Body.Bytes(), &tokens))
+	return tokens
+}
+
+func (suite *TokenWatermarkTestSuite) resetPassword(newPassword string) {
+	token, err := utils.GeneratePasswordResetToken()
+	assert.NoError(suite.T(), err)
+	assert.NoError(suite.T(), suite.db.Create(&models.PasswordResetToken{
+		UserID:    suite.user.ID,
+		TokenHash: utils.HashToken(token),
+		ExpiresAt: time.Now().Add(time.Hour),
+	}).Error)
+
+	w := suite.request("POST", "/auth/password/reset", "", gin.H{"token": token, "new_password": newPassword})
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+}
+
+// waitForWatermark moves past the second of the user's watermark, since issue times are whole
+// seconds and tokens issued within it count as revoked
+func (suite *TokenWatermarkTestSuite) waitForWatermark() {
+	var user models.User
+	assert.NoError(suite.T(), suite.db.First(&user, suite.user.ID).Error)
+	if assert.NotNil(suite.T(), user.TokensValidAfter) {
+		time.Sleep(time.Until(user.TokensValidAfter.Add(time.Second)))
+	}
+}
+
+func (suite *TokenWatermarkTestSuite) TestPasswordResetRevokesExistingTokens() {
+	laptop := suite.login(suite.user.Email, "TestPassword123!")
+	phone := suite.login(suite.user.Email, "TestPassword123!")
+
+	suite.resetPassword("Changed-Secret-42")
+
+	for _, tokens := range []loginTokens{laptop, phone} {
+		w := suite.request("GET", "/me-only", tokens.AccessToken, nil)
+		assert.Equal(suite.T(), http.StatusUnauthorized, w.Code)
+		w = suite.request("POST", "/auth/refresh", "", gin.H{"refresh_token": tokens.RefreshToken})
+		assert.Equal(suite.T(), http.StatusUnauthorized, w.Code)
+	}
+
+	// Logging in again with the new password works
+	suite.waitForWatermark()
+	fresh := suite.login(suite.user.Email, "Changed-Secret-42")
+	w := suite.request("GET", "/me-only", fresh.AccessToken, nil)
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	w = suite.request("POST", "/auth/refresh", "", gin.H{"refresh_token": fresh.RefreshToken})
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+}
+
+func (suite *TokenWatermarkTestSuite) TestAdminRevokesUserTokens() {
+	tokens := suite.login(suite.user.Email, "TestPassword123!")
+	adminTokens := suite.login(suite.admin.Email, "TestPassword123!")
+
+	// Users cannot use the admin action on themselves or anyone else
+	w := suite.request("POST", "/admin/users/"+strconv.Itoa(int(suite.admin.ID))+"/revoke-tokens", tokens.AccessToken, nil)
+	assert.Equal(suite.T(), http.StatusForbidden, w.Code)
+
+	w = suite.request("POST", "/admin/users/"+strconv.Itoa(int(suite.user.ID))+"/revoke-tokens", adminTokens.AccessToken, nil)
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+
+	w = suite.request("GET", "/me-only", tokens.AccessToken, nil)
+	assert.Equal(suite.T(), http.StatusUnauthorized, w.Code)
+
+	// Only the target user is affected
+	w = suite.request("GET", "/me-only", adminTokens.AccessToken, nil)
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+
+	w = suite.request("POST", "/admin/users/9999/revoke-tokens", adminTokens.AccessToken, nil)
+	assert.Equal(suite.T(), http.StatusNotFound, w.Code)
+}
+
+func (suite *TokenWatermarkTestSuite) TestWatermarkCoversTheCurrentSecond() {
+	// A token issued in the same second as the revocation, just before it, must not survive
+	tokens := suite.login(suite.user.Email, "TestPassword123!")
+	assert.NoError(suite.T(), models.RevokeUserTokens(suite.db, suite.user.ID))
+
+	var user models.User
+	assert.NoError(suite.T(), suite.db.First(&user, suite.user.ID).Error)
+	if assert.NotNil(suite.T(), user.TokensValidAfter) {
+		assert.Equal(suite.T(), user.TokensValidAfter.Truncate(time.Second), *user.TokensValidAfter)
+		assert.True(suite.T(), user.TokensValidAfter.After(time.Now()))
+	}
+
+	w := suite.request("GET", "/me-only", tokens.AccessToken, nil)
+	assert.Equal(suite.T(), http.StatusUnauthorized, w.Code)
+
+	// Tokens issued before the watermark's second has passed are still covered by it
+	early := suite.login(suite.user.Email, "TestPassword123!")
+	w = suite.request("GET", "/me-only", early.AccessToken, nil)
+	assert.Equal(suite.T(), http.StatusUnauthorized, w.Code)
+
+	suite.waitForWatermark()
+	late := suite.login(suite.user.Email, "TestPassword123!")
+	w = suite.request("GET", "/me-only", late.AccessToken, nil)
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+}
+
+func TestTokenWatermarkTestSuite(t *testing.T) {
+	suite.Run(t, new(TokenWatermarkTestSuite))
+}
+
+type countingWatermarkStore struct {
+	validAfter time.Time
+	lookups    int
+}
+
+func (s *countingWatermarkStore) TokensValidAfter(userID uint) (time.Time, error) {
+	s.lookups++
+	return s.validAfter, nil
+}
+
+func TestTokenWatermarkIsCached(t *testing.T) {
+	store := &countingWatermarkStore{}
+	utils.SetTokenWatermarkStore(store)
+	defer utils.SetTokenWatermarkStore(nil)
+
+	claims := &utils.Claims{
+		UserID:           7,
+		TokenType:        utils.AccessToken,
+		RegisteredClaims: jwt.RegisteredClaims{IssuedAt: jwt.NewNumericDate(time.Now().Add(-time.Minute))},
+	}
+	for i := 0; i < 5; i++ {
+		assert.False(t, utils.IssuedBeforeWatermark(claims))
+	}
+	assert.Equal(t, 1, store.lookups)
+
+	// Raising the watermark takes effect once the cached value is forgotten
+	store.validAfter = time.Now()
+	assert.False(t, utils.IssuedBeforeWatermark(claims))
+	utils.ForgetTokenWatermark(7)
+	assert.True(t, utils.IssuedBeforeWatermark(claims))
+	assert.Equal(t, 2, store.lookups)
+
+	// Machine tokens never have a watermark
+	client := &utils.Claims{SubjectType: utils.SubjectClient, ClientID: "nightly-report", TokenType: utils.AccessToken}
+	assert.False(t, utils.IssuedBeforeWatermark(client))
+}
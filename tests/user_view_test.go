@@ -0,0 +1,151 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"go-auth-system/src/handlers"
+	"go-auth-system/src/middleware"
+	"go-auth-system/src/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// Fields that must never leave the server, whoever is asking
+var secretUserFields = []string{"password", "PasswordHash", "mfa_secret", "MFASecret"}
+
+func lockedUser(t *testing.T) models.User {
+	user := models.User{
+		Email:            "dave@company.io",
+		FirstName:        "Dave",
+		LastName:         "Brown",
+		FailedLoginCount: 3,
+		MFAEnabled:       true,
+		MFASecret:        "JBSWY3DPEHPK3PXP",
+	}
+	assert.NoError(t, user.SetPassword("TestPassword123!"))
+	user.LockAccount(time.Hour)
+	return user
+}
+
+func assertNoSecrets(t *testing.T, body string, user models.User) {
+	for _, field := range secretUserFields {
+		assert.NotContains(t, body, field)
+	}
+	assert.NotContains(t, body, user.PasswordHash)
+	assert.NotContains(t, body, user.MFASecret)
+}
+
+func TestUserViewsNeverExposeSecrets(t *testing.T) {
+	user := lockedUser(t)
+
+	for _, visibility := range []models.UserVisibility{models.VisibilityPublic, models.VisibilitySelf, models.VisibilityAdmin} {
+		body, err := json.Marshal(user.View(visibility))
+		assert.NoError(t, err)
+		assertNoSecrets(t, string(body), user)
+	}
+
+	// The model itself must not leak the hash either, e.g. when embedded in another record
+	body, err := json.Marshal(user)
+	assert.NoError(t, err)
+	assertNoSecrets(t, string(body), user)
+}
+
+func TestUserViewFieldVisibility(t *testing.T) {
+	user := lockedUser(t)
+
+	fields := func(view interface{}) map[string]interface{} {
+		body, _ := json.Marshal(view)
+		var decoded map[string]interface{}
+		assert.NoError(t, json.Unmarshal(body, &decoded))
+		return decoded
+	}
+
+	public := fields(user.View(models.VisibilityPublic))
+	assert.Equal(t, "Dave", public["first_name"])
+	assert.NotContains(t, public, "email")
+	assert.NotContains(t, public, "failed_login_count")
+
+	self := fields(user.View(models.VisibilitySelf))
+	assert.Equal(t, "dave@company.io", self["email"])
+	assert.NotContains(t, self, "failed_login_count")
+	assert.NotContains(t, self, "locked_until")
+
+	admin := fields(user.View(models.VisibilityAdmin))
+	assert.Equal(t, "dave@company.io", admin["email"])
+	assert.Equal(t, float64(3), admin["failed_login_count"])
+	assert.Equal(t, true, admin["locked"])
+}
+
+func TestGetUserRespondsWithCallerView(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	assert.NoError(t, err)
+	assert.NoError(t, db.AutoMigrate(&models.User{}, &models.MFARecoveryCode{}))
+
+	user := lockedUser(t)
+	assert.NoError(t, db.Create(&user).Error)
+
+	// Stand-in for AuthMiddleware: the caller and their permissions come from test headers
+	authenticated := func(c *gin.Context) {
+		id, _ := strconv.ParseUint(c.GetHeader("X-Test-User"), 10, 64)
+		c.Set("userID", uint(id))
+		c.Set("permissions", strings.Fields(c.GetHeader("X-Test-Permissions")))
+		c.Next()
+	}
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/user/profile/:id", authenticated, handlers.NewUserHandler(db).GetUser)
+	router.GET("/auth/me", authenticated, handlers.NewAuthHandler(db, newFakeTokenStore()).Me)
+	router.GET("/admin/users/:id", authenticated,
+		middleware.RequirePermission(models.PermissionUsersRead), handlers.NewAdminHandler(db).GetUser)
+
+	get := func(path string, caller uint, permissions string) map[string]interface{} {
+		req, _ := http.NewRequest("GET", path, nil)
+		req.Header.Set("X-Test-User", strconv.FormatUint(uint64(caller), 10))
+		req.Header.Set("X-Test-Permissions", permissions)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assertNoSecrets(t, w.Body.String(), user)
+
+		var response map[string]interface{}
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		return response
+	}
+
+	profilePath := "/user/profile/" + strconv.FormatUint(uint64(user.ID), 10)
+
+	self := get(profilePath, user.ID, "")
+	assert.Equal(t, "dave@company.io", self["email"])
+	assert.NotContains(t, self, "failed_login_count")
+
+	other := get(profilePath, user.ID+1, "")
+	assert.NotContains(t, other, "email")
+
+	admin := get(profilePath, user.ID+1, "users:read")
+	assert.Equal(t, float64(3), admin["failed_login_count"])
+
+	me := get("/auth/me", user.ID, "")
+	assert.Equal(t, "dave@company.io", me["email"])
+	assert.Contains(t, me, "recovery_codes_remaining")
+	assert.NotContains(t, me, "failed_login_count")
+
+	adminView := get("/admin/users/"+strconv.FormatUint(uint64(user.ID), 10), user.ID+1, "users:read")
+	assert.Equal(t, true, adminView["locked"])
+
+	// The id is parsed before the lookup, so SQL in the path never reaches the query
+	req, _ := http.NewRequest("GET", "/user/profile/1=1", nil)
+	req.Header.Set("X-Test-User", strconv.FormatUint(uint64(user.ID), 10))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
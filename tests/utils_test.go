@@ -1,7 +1,9 @@
 package tests
 
 import (
+	"strings"
 	"testing"
+	"time"
 
 	"go-auth-system/src/utils"
 
@@ -337,3 +339,83 @@ func TestCheckPasswordHash(t *testing.T) {
 	// Test empty hash
 	assert.False(t, utils.CheckPasswordHash(password, ""))
 }
+
+func TestGenerateTOTPCode(t *testing.T) {
+	// RFC 6238 appendix B SHA1 vectors, truncated to 6 digits
+	secret := "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ" // base32("12345678901234567890")
+
+	tests := []struct {
+		name     string
+		unix     int64
+		expected string
+	}{
+		{name: "T=59", unix: 59, expected: "287082"},
+		{name: "T=1111111109", unix: 1111111109, expected: "081804"},
+		{name: "T=1111111111", unix: 1111111111, expected: "050471"},
+		{name: "T=1234567890", unix: 1234567890, expected: "005924"},
+		{name: "T=2000000000", unix: 2000000000, expected: "279037"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, err := utils.GenerateTOTPCode(secret, time.Unix(tt.unix, 0))
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, code)
+		})
+	}
+}
+
+func TestValidateTOTPCode(t *testing.T) {
+	secret, err := utils.GenerateTOTPSecret()
+	assert.NoError(t, err)
+
+	valid := func(secret, code string) bool {
+		_, ok := utils.ValidateTOTPCode(secret, code)
+		return ok
+	}
+
+	now := time.Now()
+	code, err := utils.GenerateTOTPCode(secret, now)
+	assert.NoError(t, err)
+	step, ok := utils.ValidateTOTPCode(secret, code)
+	assert.True(t, ok)
+	assert.Equal(t, now.Unix()/30, step)
+
+	// One step of clock drift is tolerated, more is not
+	previous, _ := utils.GenerateTOTPCode(secret, now.Add(-30*time.Second))
+	step, ok = utils.ValidateTOTPCode(secret, previous)
+	assert.True(t, ok)
+	assert.Equal(t, now.Unix()/30-1, step)
+	stale, _ := utils.GenerateTOTPCode(secret, now.Add(-5*time.Minute))
+	assert.False(t, valid(secret, stale))
+
+	assert.False(t, valid(secret, ""))
+	assert.False(t, valid(secret, "12345"))
+	assert.False(t, valid("not base32!", code))
+}
+
+func TestTOTPProvisioningURI(t *testing.T) {
+	uri := utils.TOTPProvisioningURI("JBSWY3DPEHPK3PXP", "jane@company.io", "go-auth-system")
+
+	assert.True(t, strings.HasPrefix(uri, "otpauth://totp/go-auth-system:jane@company.io?"))
+	assert.Contains(t, uri, "secret=JBSWY3DPEHPK3PXP")
+	assert.Contains(t, uri, "issuer=go-auth-system")
+}
+
+func TestDeviceLabel(t *testing.T) {
+	tests := []struct {
+		userAgent string
+		expected  string
+	}{
+		{"Mozilla/5.0 (Macintosh; Intel Mac OS X 14_5) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/126.0.0.0 Safari/537.36", "Chrome on macOS"},
+		{"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/126.0.0.0 Safari/537.36 Edg/126.0.0.0", "Edge on Windows"},
+		{"Mozilla/5.0 (Linux; Android 14; Pixel 8) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/126.0.0.0 Mobile Safari/537.36", "Chrome on Android"},
+		{"Mozilla/5.0 (iPhone; CPU iPhone OS 17_5 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.5 Mobile/15E148 Safari/604.1", "Safari on iOS"},
+		{"curl/8.7.1", "curl"},
+		{"", "Unknown device"},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.expected, utils.DeviceLabel(tt.userAgent))
+	}
+}